@@ -1,13 +1,27 @@
-package main
-
-import (
-	"github.com/wilsonth122/money-tracker-api/pkg/app"
-)
-
-func init() {
-	app.Setup()
-}
-
-func main() {
-	app.Start()
-}
+package main
+
+import (
+	"os"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/app"
+)
+
+func init() {
+	if !migrating() {
+		app.Setup()
+	}
+}
+
+func main() {
+	if migrating() {
+		app.Migrate()
+		return
+	}
+
+	app.Start()
+}
+
+// `application migrate` applies pending schema migrations and exits, without setting up the rest of the API
+func migrating() bool {
+	return len(os.Args) > 1 && os.Args[1] == "migrate"
+}
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// accountBalance - An account and what it held at a point in time
+type accountBalance struct {
+	Account model.Account `json:"account"`
+	Balance model.Money   `json:"balance"`
+	At      time.Time     `json:"at"`
+}
+
+// accountStatement - Response of GET /api/accounts/{id}/statement
+type accountStatement struct {
+	Account model.Account `json:"account"`
+	// Opening is the balance at the start of the range and Closing at its end
+	Opening model.Money      `json:"opening"`
+	Closing model.Money      `json:"closing"`
+	Entries []statementEntry `json:"entries"`
+}
+
+// statementEntry - A transaction with the account's balance straight after it
+type statementEntry struct {
+	model.Expense
+	Balance model.Money `json:"balance"`
+}
+
+// AllAccounts - Endpoint to retrieve all of the user's accounts
+func (s *Server) AllAccounts(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	accounts, err := s.Accounts.FindAccounts(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if accounts == nil {
+		accounts = []model.Account{}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, accounts)
+}
+
+// GetAccount - Endpoint to get a specific account by id
+func (s *Server) GetAccount(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	account, err := s.ownedAccount(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Account ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, account)
+}
+
+// CreateAccount - Endpoint to create an account
+func (s *Server) CreateAccount(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var account model.Account
+
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	account.ID = model.NewID()
+	account.UserID = user
+
+	if resp, ok := validateAccount(&account, s.userSettings(r.Context(), user)); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if err := s.Accounts.InsertAccount(r.Context(), account); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusCreated, account)
+}
+
+// UpdateAccount - Endpoint to update an account. Its currency is fixed once it has transactions.
+func (s *Server) UpdateAccount(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var account model.Account
+
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	existing, err := s.ownedAccount(r.Context(), user, account.ID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Account ID")
+		return
+	}
+
+	account.UserID = user
+
+	if resp, ok := validateAccount(&account, s.userSettings(r.Context(), user)); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if account.Currency != existing.Currency {
+		used, err := s.accountUsed(r.Context(), existing)
+		if err != nil {
+			log.Println(err)
+			u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if used {
+			u.RespondWithError(w, http.StatusConflict, "The currency of an account with transactions can't be changed")
+			return
+		}
+	}
+
+	if err := s.Accounts.UpdateAccount(r.Context(), account); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// DeleteAccount - Endpoint to delete an account, only once nothing is linked to it
+func (s *Server) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	account, err := s.ownedAccount(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Account ID")
+		return
+	}
+
+	used, err := s.accountUsed(r.Context(), account)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if used {
+		u.RespondWithError(w, http.StatusConflict, "Account still has transactions or recurring expenses")
+		return
+	}
+
+	if err := s.Accounts.RemoveAccountByID(r.Context(), account.ID); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Account ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// AccountBalances - Endpoint returning every account's balance at the end of the calendar date ?at=,
+// or at an RFC 3339 timestamp. Defaults to now.
+func (s *Server) AccountBalances(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	loc := s.userSettings(r.Context(), user).Location()
+
+	at := time.Now()
+	if v := r.URL.Query().Get("at"); v != "" {
+		parsed, err := model.ParseDate(v)
+		if err != nil {
+			u.RespondWithError(w, http.StatusBadRequest, "Invalid at: "+err.Error())
+			return
+		}
+		at = parsed.Resolve(loc).Time
+		if parsed.IsCalendarDate() {
+			at = at.In(loc).AddDate(0, 0, 1)
+		}
+	}
+
+	accounts, err := s.Accounts.FindAccounts(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	balances := []accountBalance{}
+	for _, account := range accounts {
+		entries, _, err := s.Expenses.FindExpenses(r.Context(), user, dao.ExpenseQuery{AccountID: account.ID, To: at})
+		if err != nil {
+			log.Println(err)
+			u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		balance := account.OpeningBalance
+		for _, entry := range entries {
+			balance += entry.Flow()
+		}
+
+		balances = append(balances, accountBalance{Account: account, Balance: balance, At: at})
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, balances)
+}
+
+// AccountStatement - Endpoint listing an account's transactions in date order with the running balance
+// after each. The range is given as for GET /api/expenses, by default everything up to now.
+func (s *Server) AccountStatement(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	account, err := s.ownedAccount(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Account ID")
+		return
+	}
+
+	from, to, msg, ok := parseDateRange(r.URL.Query(), s.userSettings(r.Context(), user).Location())
+	if !ok {
+		u.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	// Everything before the range is needed for the opening balance
+	entries, _, err := s.Expenses.FindExpenses(r.Context(), user, dao.ExpenseQuery{
+		AccountID: account.ID,
+		To:        to,
+		Sort:      dao.SortByDate,
+	})
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	statement := accountStatement{Account: account, Entries: []statementEntry{}}
+	balance := account.OpeningBalance
+	for _, entry := range entries {
+		balance += entry.Flow()
+		if entry.Date.Before(from) {
+			continue
+		}
+
+		statement.Entries = append(statement.Entries, statementEntry{Expense: entry, Balance: balance})
+	}
+
+	statement.Closing = balance
+	statement.Opening = balance
+	if len(statement.Entries) > 0 {
+		first := statement.Entries[0]
+		statement.Opening = first.Balance - first.Flow()
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, statement)
+}
+
+// Finds the account, treating one owned by someone else as not found
+func (s *Server) ownedAccount(ctx context.Context, user string, id string) (model.Account, error) {
+	if id == "" {
+		return model.Account{}, dao.ErrNotFound
+	}
+
+	account, err := s.Accounts.FindAccountByID(ctx, id)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	if account.UserID != user {
+		return model.Account{}, dao.ErrNotFound
+	}
+
+	return account, nil
+}
+
+// Whether any transaction or recurring expense is linked to the account
+func (s *Server) accountUsed(ctx context.Context, account model.Account) (bool, error) {
+	entries, _, err := s.Expenses.FindExpenses(ctx, account.UserID, dao.ExpenseQuery{AccountID: account.ID, Limit: 1})
+	if err != nil || len(entries) > 0 {
+		return len(entries) > 0, err
+	}
+
+	recurrences, err := s.Recurrences.FindRecurrences(ctx, account.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, recurrence := range recurrences {
+		if recurrence.AccountID == account.ID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Validate account details, filling in the currency when left out
+func validateAccount(account *model.Account, user model.User) (string, bool) {
+	account.Name = strings.TrimSpace(account.Name)
+	if account.Name == "" {
+		return "Account name is required", false
+	}
+
+	if !model.ValidAccountType(account.Type) {
+		return "Type must be cash, current, savings or credit", false
+	}
+
+	account.Currency = strings.ToUpper(strings.TrimSpace(account.Currency))
+	if account.Currency == "" {
+		account.Currency = user.Currency
+	}
+	if !model.ValidCurrency(account.Currency) {
+		return "Currency must be an ISO 4217 code with two decimal places, such as GBP", false
+	}
+
+	return "Requirement passed", true
+}
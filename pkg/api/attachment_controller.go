@@ -0,0 +1,332 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/blob"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// Most files that can be attached to one expense
+const maxAttachments = 10
+
+// Longest file name kept for an attachment
+const maxFileNameLength = 255
+
+// Kinds of file that can be attached, as detected from their content
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// AllAttachments - Endpoint to list the files attached to an expense, oldest first
+func (s *Server) AllAttachments(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	expense, _, err := s.visibleExpense(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Expense ID")
+		return
+	}
+
+	attachments, err := s.Attachments.FindAttachments(r.Context(), expense.ID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if attachments == nil {
+		attachments = []model.Attachment{}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, attachments)
+}
+
+// UploadAttachment - Endpoint to attach a receipt or other file to an expense, sent as the "file" field
+// of a multipart/form-data body. Only images and PDFs up to the configured size are accepted, judged by
+// their content rather than the type the client claims.
+func (s *Server) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	expense, role, err := s.visibleExpense(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Expense ID")
+		return
+	}
+
+	if !model.CanEdit(role) {
+		u.RespondWithError(w, http.StatusForbidden, "Viewers can't change the ledger's expenses")
+		return
+	}
+
+	existing, err := s.Attachments.FindAttachments(r.Context(), expense.ID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(existing) >= maxAttachments {
+		u.RespondWithError(w, http.StatusBadRequest, "An expense can have at most "+strconv.Itoa(maxAttachments)+" attachments")
+		return
+	}
+
+	// Leave room for the multipart headers and boundaries around the file
+	r.Body = http.MaxBytesReader(w, r.Body, s.MaxAttachmentSize+64<<10)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Attachments must be uploaded as multipart/form-data")
+		return
+	}
+
+	part, err := filePart(reader)
+	if err != nil {
+		log.Println(err)
+		respondWithUploadError(w, err, "Upload must include a file field")
+		return
+	}
+	defer part.Close()
+
+	content, err := io.ReadAll(io.LimitReader(part, s.MaxAttachmentSize+1))
+	if err != nil {
+		log.Println(err)
+		respondWithUploadError(w, err, "Couldn't read the uploaded file")
+		return
+	}
+
+	if int64(len(content)) > s.MaxAttachmentSize {
+		u.RespondWithError(w, http.StatusRequestEntityTooLarge, "Attachments can be at most "+strconv.FormatInt(s.MaxAttachmentSize, 10)+" bytes")
+		return
+	}
+
+	if len(content) == 0 {
+		u.RespondWithError(w, http.StatusBadRequest, "Uploaded file is empty")
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(content))
+	if !attachmentTypes[contentType] {
+		u.RespondWithError(w, http.StatusUnsupportedMediaType, "Attachments must be JPEG, PNG, GIF or WebP images or PDFs")
+		return
+	}
+
+	attachment := model.Attachment{
+		ID:          model.NewID(),
+		ExpenseID:   expense.ID,
+		UserID:      expense.UserID,
+		FileName:    attachmentFileName(part.FileName()),
+		ContentType: contentType,
+		Size:        int64(len(content)),
+		Created:     time.Now().UTC(),
+	}
+
+	if err := s.Blobs.Put(r.Context(), attachment.Key(), bytes.NewReader(content), attachment.Size, contentType); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, "Couldn't store the attachment")
+		return
+	}
+
+	if err := s.Attachments.InsertAttachment(r.Context(), attachment); err != nil {
+		log.Println(err)
+		s.deleteAttachmentContent(r.Context(), []model.Attachment{attachment})
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusCreated, attachment)
+}
+
+// GetAttachment - Endpoint to download a file attached to an expense
+func (s *Server) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	attachment, _, ok := s.expenseAttachment(w, r, user)
+	if !ok {
+		return
+	}
+
+	content, err := s.Blobs.Get(r.Context(), attachment.Key())
+	if err != nil {
+		log.Println(err)
+		if err == blob.ErrNotFound {
+			u.RespondWithError(w, http.StatusNotFound, "Attachment content is missing")
+			return
+		}
+		u.RespondWithError(w, http.StatusInternalServerError, "Couldn't read the attachment")
+		return
+	}
+	defer content.Close()
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, content); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeleteAttachment - Endpoint to remove a file attached to an expense
+func (s *Server) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	attachment, role, ok := s.expenseAttachment(w, r, user)
+	if !ok {
+		return
+	}
+
+	if !model.CanEdit(role) {
+		u.RespondWithError(w, http.StatusForbidden, "Viewers can't change the ledger's expenses")
+		return
+	}
+
+	if err := s.Attachments.RemoveAttachmentByID(r.Context(), attachment.ID); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Attachment ID")
+		return
+	}
+
+	s.deleteAttachmentContent(r.Context(), []model.Attachment{attachment})
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// Finds the attachment named in the path along with the user's role for its expense,
+// responding with an error when either can't be found
+func (s *Server) expenseAttachment(w http.ResponseWriter, r *http.Request, user string) (model.Attachment, string, bool) {
+	params := mux.Vars(r)
+
+	expense, role, err := s.visibleExpense(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Expense ID")
+		return model.Attachment{}, "", false
+	}
+
+	attachment, err := s.Attachments.FindAttachmentByID(r.Context(), params["attachment"])
+	if err != nil || attachment.ExpenseID != expense.ID {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Attachment ID")
+		return model.Attachment{}, "", false
+	}
+
+	return attachment, role, true
+}
+
+// Attachments of the expenses, looked up before they are removed as some backends remove the attachments with them
+func (s *Server) expenseAttachments(ctx context.Context, expenses []model.Expense) []model.Attachment {
+	var attachments []model.Attachment
+	for _, expense := range expenses {
+		found, err := s.Attachments.FindAttachments(ctx, expense.ID)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		attachments = append(attachments, found...)
+	}
+
+	return attachments
+}
+
+// Removes the attachments of expenses that have just been removed, as found by expenseAttachments
+func (s *Server) removeAttachments(ctx context.Context, expenses []model.Expense, attachments []model.Attachment) {
+	for _, expense := range expenses {
+		if err := s.Attachments.RemoveExpenseAttachments(ctx, expense.ID); err != nil {
+			log.Println(err)
+		}
+	}
+
+	s.deleteAttachmentContent(ctx, attachments)
+}
+
+// Deletes what the attachments hold from blob storage. Failures are only logged, as the attachments
+// are already gone and what is left behind can't be reached any more.
+func (s *Server) deleteAttachmentContent(ctx context.Context, attachments []model.Attachment) {
+	for _, attachment := range attachments {
+		if err := s.Blobs.Delete(ctx, attachment.Key()); err != nil {
+			log.Printf("Attachment %s: %v", attachment.ID, err)
+		}
+	}
+}
+
+// Skips to the "file" field of the multipart body
+func filePart(reader *multipart.Reader) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// Keeps the name the file was uploaded with, without any directories or control characters
+func attachmentFileName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+
+	if len(name) > maxFileNameLength {
+		name = strings.ToValidUTF8(name[:maxFileNameLength], "")
+	}
+
+	if name == "" || name == "." || name == ".." {
+		return "attachment"
+	}
+
+	return name
+}
+
+// Responds to a failed read of an upload, telling bodies that were too large apart from malformed ones
+func respondWithUploadError(w http.ResponseWriter, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		u.RespondWithError(w, http.StatusRequestEntityTooLarge, "Upload is too large")
+		return
+	}
+
+	u.RespondWithError(w, http.StatusBadRequest, msg)
+}
@@ -0,0 +1,476 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	"github.com/wilsonth122/money-tracker-api/pkg/stream"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+const (
+	defaultReportPeriods = 6
+	maxReportPeriods     = 60
+)
+
+// budgetReport - Response of GET /api/budgets/{id}/report
+type budgetReport struct {
+	Budget model.Budget `json:"budget"`
+	// Periods start with the current one and go back in time
+	Periods []budgetPeriod `json:"periods"`
+}
+
+// budgetPeriod - Spending against a budget over one of its periods
+type budgetPeriod struct {
+	Start     time.Time   `json:"start"`
+	End       time.Time   `json:"end"`
+	Spent     model.Money `json:"spent"`
+	Remaining model.Money `json:"remaining"`
+	Percent   int         `json:"percent"`
+	Exceeded  bool        `json:"exceeded"`
+	// Unconverted counts expenses in other currencies left out because no rate was available
+	Unconverted int `json:"unconverted,omitempty"`
+}
+
+// budgetSpend - What a budget had spent in one period, kept to spot thresholds being crossed
+type budgetSpend struct {
+	budget model.Budget
+	start  time.Time
+	end    time.Time
+	spent  model.Money
+}
+
+// AllBudgets - Endpoint to retrieve all of the user's budgets
+func (s *Server) AllBudgets(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	budgets, err := s.Budgets.FindBudgets(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if budgets == nil {
+		budgets = []model.Budget{}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, budgets)
+}
+
+// GetBudget - Endpoint to get a specific budget by id
+func (s *Server) GetBudget(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	budget, err := s.ownedBudget(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Budget ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, budget)
+}
+
+// CreateBudget - Endpoint to create a budget
+func (s *Server) CreateBudget(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var budget model.Budget
+
+	if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	budget.ID = model.NewID()
+	budget.UserID = user
+
+	if resp, ok := s.validateBudget(r.Context(), &budget, s.userSettings(r.Context(), user)); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if err := s.Budgets.InsertBudget(r.Context(), budget); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusCreated, budget)
+}
+
+// UpdateBudget - Endpoint to update a budget
+func (s *Server) UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var budget model.Budget
+
+	if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	if _, err := s.ownedBudget(r.Context(), user, budget.ID); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Budget ID")
+		return
+	}
+
+	budget.UserID = user
+
+	if resp, ok := s.validateBudget(r.Context(), &budget, s.userSettings(r.Context(), user)); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if err := s.Budgets.UpdateBudget(r.Context(), budget); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// DeleteBudget - Endpoint to delete a budget
+func (s *Server) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	if _, err := s.ownedBudget(r.Context(), user, params["id"]); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Budget ID")
+		return
+	}
+
+	if err := s.Budgets.RemoveBudgetByID(r.Context(), params["id"]); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Budget ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// BudgetReport - Endpoint reporting spent and remaining amounts for the current period and the ones
+// before it, ?periods= in all (default 6). Periods follow the user's timezone.
+func (s *Server) BudgetReport(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	budget, err := s.ownedBudget(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Budget ID")
+		return
+	}
+
+	count := defaultReportPeriods
+	if v := r.URL.Query().Get("periods"); v != "" {
+		count, err = strconv.Atoi(v)
+		if err != nil || count < 1 || count > maxReportPeriods {
+			u.RespondWithError(w, http.StatusBadRequest, "Invalid periods, expected 1 to "+strconv.Itoa(maxReportPeriods))
+			return
+		}
+	}
+
+	// Work out every period first, then fetch their expenses in one go
+	report := budgetReport{Budget: budget}
+	at := time.Now().In(s.userSettings(r.Context(), user).Location())
+	for i := 0; i < count; i++ {
+		start, end := budget.Range(at)
+		report.Periods = append(report.Periods, budgetPeriod{Start: start, End: end})
+		at = start.AddDate(0, 0, -1)
+	}
+
+	oldest := report.Periods[len(report.Periods)-1].Start
+	expenses, err := s.budgetExpenses(r.Context(), budget, oldest, report.Periods[0].End)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, expense := range expenses {
+		for i := range report.Periods {
+			period := &report.Periods[i]
+			if expense.Date.Before(period.Start) || !expense.Date.Before(period.End) {
+				continue
+			}
+
+			amount, ok := s.budgetAmount(r.Context(), budget, expense)
+			if !ok {
+				period.Unconverted++
+				break
+			}
+			period.Spent += amount
+			break
+		}
+	}
+
+	for i := range report.Periods {
+		period := &report.Periods[i]
+		period.Remaining = budget.Amount - period.Spent
+		period.Percent = percentOf(period.Spent, budget.Amount)
+		period.Exceeded = period.Spent > budget.Amount
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// Finds the budget, treating one owned by someone else as not found
+func (s *Server) ownedBudget(ctx context.Context, user string, id string) (model.Budget, error) {
+	if id == "" {
+		return model.Budget{}, dao.ErrNotFound
+	}
+
+	budget, err := s.Budgets.FindBudgetByID(ctx, id)
+	if err != nil {
+		return model.Budget{}, err
+	}
+
+	if budget.UserID != user {
+		return model.Budget{}, dao.ErrNotFound
+	}
+
+	return budget, nil
+}
+
+// Validate budget details, filling in the currency and alert threshold when left out
+func (s *Server) validateBudget(ctx context.Context, budget *model.Budget, user model.User) (string, bool) {
+	budget.Name = strings.TrimSpace(budget.Name)
+	if budget.Name == "" {
+		return "Budget name is required", false
+	}
+
+	if budget.Amount <= 0 {
+		return "Budget amount must be more than zero", false
+	}
+
+	budget.Currency = strings.ToUpper(strings.TrimSpace(budget.Currency))
+	if budget.Currency == "" {
+		budget.Currency = user.Currency
+	}
+	if !model.ValidCurrency(budget.Currency) {
+		return "Currency must be an ISO 4217 code with two decimal places, such as GBP", false
+	}
+
+	if !model.ValidBudgetPeriod(budget.Period) {
+		return "Period must be weekly, monthly or yearly", false
+	}
+
+	if budget.CategoryID != "" && budget.CategoryID != dao.NoCategory {
+		if _, err := s.ownedCategory(ctx, budget.UserID, budget.CategoryID); err != nil {
+			return "Invalid Category ID", false
+		}
+	}
+
+	if budget.Tag != "" {
+		tag, err := model.NormaliseTag(budget.Tag)
+		if err != nil {
+			return err.Error(), false
+		}
+		budget.Tag = tag
+	}
+
+	if budget.AlertPercent == 0 {
+		budget.AlertPercent = model.DefaultAlertPercent
+	}
+	if budget.AlertPercent < 1 || budget.AlertPercent > 100 {
+		return "Alert percent must be between 1 and 100", false
+	}
+
+	return "Requirement passed", true
+}
+
+// Saves every budget of the user that change modifies, used when categories or tags go away
+func (s *Server) rescopeBudgets(ctx context.Context, user string, change func(budget *model.Budget) bool) error {
+	budgets, err := s.Budgets.FindBudgets(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	for _, budget := range budgets {
+		if !change(&budget) {
+			continue
+		}
+		if err := s.Budgets.UpdateBudget(ctx, budget); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The expenses counted against the budget between from and to
+func (s *Server) budgetExpenses(ctx context.Context, budget model.Budget, from time.Time, to time.Time) ([]model.Expense, error) {
+	q := dao.ExpenseQuery{From: from, To: to, Types: []string{model.TypeExpense}, CategoryID: budget.CategoryID}
+	if budget.Tag != "" {
+		q.Tags = []string{budget.Tag}
+	}
+
+	expenses, _, err := s.Expenses.FindExpenses(ctx, budget.UserID, q)
+
+	return expenses, err
+}
+
+// The part of the expense counted against the budget in the budget's currency, false when it can't be converted
+func (s *Server) budgetAmount(ctx context.Context, budget model.Budget, expense model.Expense) (model.Money, bool) {
+	return s.amountIn(ctx, budgetShare(budget, expense), expense.Currency, budget.Currency)
+}
+
+// The split lines of the expense in the budget's category added up, the whole price for a budget
+// without a category
+func budgetShare(budget model.Budget, expense model.Expense) model.Money {
+	var share model.Money
+	for _, line := range expense.Lines() {
+		switch budget.CategoryID {
+		case "":
+		case dao.NoCategory:
+			if line.CategoryID != "" {
+				continue
+			}
+		default:
+			if line.CategoryID != budget.CategoryID {
+				continue
+			}
+		}
+
+		share += line.Amount
+	}
+
+	return share
+}
+
+// Whether the expense is counted against the budget, whatever its date
+func budgetCounts(budget model.Budget, expense model.Expense) bool {
+	if expense.Type != model.TypeExpense {
+		return false
+	}
+
+	if budgetShare(budget, expense) == 0 {
+		return false
+	}
+
+	if budget.Tag != "" {
+		for _, tag := range expense.Tags {
+			if tag == budget.Tag {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// Records what each budget counting the expense has spent in the period the expense falls in.
+// Taken before the expense is written so sendBudgetAlerts can tell which thresholds it crossed.
+func (s *Server) budgetSpending(ctx context.Context, user model.User, expense model.Expense) []budgetSpend {
+	budgets, err := s.Budgets.FindBudgets(ctx, user.Email)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	var spending []budgetSpend
+	for _, budget := range budgets {
+		if !budgetCounts(budget, expense) {
+			continue
+		}
+
+		start, end := budget.Range(expense.Date.In(user.Location()))
+		spend := budgetSpend{budget: budget, start: start, end: end}
+
+		if spend.spent, err = s.spentBetween(ctx, budget, start, end); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		spending = append(spending, spend)
+	}
+
+	return spending
+}
+
+// Sends an alert for every budget the expense took past its alert threshold or its amount
+func (s *Server) sendBudgetAlerts(ctx context.Context, before []budgetSpend) {
+	for _, spend := range before {
+		budget := spend.budget
+
+		spent, err := s.spentBetween(ctx, budget, spend.start, spend.end)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		// Only the highest threshold crossed is worth telling the user about
+		percent := 0
+		for _, threshold := range []int{budget.AlertPercent, 100} {
+			limit := budget.Amount * model.Money(threshold) / 100
+			if spend.spent < limit && spent >= limit {
+				percent = threshold
+			}
+		}
+		if percent == 0 {
+			continue
+		}
+
+		go stream.Alert(&model.BudgetAlert{
+			Type:     "budgetAlert",
+			UserID:   budget.UserID,
+			BudgetID: budget.ID,
+			Name:     budget.Name,
+			Start:    spend.start,
+			End:      spend.end,
+			Amount:   budget.Amount,
+			Spent:    spent,
+			Currency: budget.Currency,
+			Percent:  percent,
+			Exceeded: spent > budget.Amount,
+		})
+	}
+}
+
+// Total spent against the budget between from and to, leaving out amounts that can't be converted
+func (s *Server) spentBetween(ctx context.Context, budget model.Budget, from time.Time, to time.Time) (model.Money, error) {
+	expenses, err := s.budgetExpenses(ctx, budget, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	var spent model.Money
+	for _, expense := range expenses {
+		if amount, ok := s.budgetAmount(ctx, budget, expense); ok {
+			spent += amount
+		}
+	}
+
+	return spent, nil
+}
+
+// Share of total that part makes up, rounded down
+func percentOf(part model.Money, total model.Money) int {
+	if total <= 0 {
+		return 0
+	}
+
+	return int(part * 100 / total)
+}
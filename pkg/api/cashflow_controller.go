@@ -0,0 +1,154 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+const (
+	defaultCashFlowPeriods = 12
+	maxCashFlowPeriods     = 366
+)
+
+// cashFlowReport - Response of GET /api/cashflow
+type cashFlowReport struct {
+	Currency string `json:"currency"`
+	Interval string `json:"interval"`
+	// Periods run from the oldest to the newest
+	Periods []cashFlowPeriod `json:"periods"`
+	Total   cashFlowPeriod   `json:"total"`
+}
+
+// cashFlowPeriod - Money coming in and going out over one interval.
+// Savings and transfers only move money between the user's own accounts, so they are left out.
+type cashFlowPeriod struct {
+	Start  time.Time   `json:"start"`
+	End    time.Time   `json:"end"`
+	Income model.Money `json:"income"`
+	Spent  model.Money `json:"spent"`
+	Net    model.Money `json:"net"`
+	// Unconverted counts entries in other currencies left out because no rate was available
+	Unconverted int `json:"unconverted,omitempty"`
+}
+
+// CashFlow - Endpoint reporting income, spend and net per ?interval= of day, week or month (default month).
+// The range is given as for GET /api/expenses, by default the last 12 intervals up to today, and ?ledger=
+// reports on a shared ledger instead of the user's own expenses.
+// Amounts are in ?currency=, or the user's currency, and periods follow the user's timezone.
+func (s *Server) CashFlow(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := r.URL.Query()
+	settings := s.userSettings(r.Context(), user)
+	loc := settings.Location()
+
+	currency, ok := requestedCurrency(r)
+	if !ok {
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid currency code")
+		return
+	}
+	if currency == "" {
+		currency = settings.Currency
+	}
+
+	interval := params.Get("interval")
+	switch interval {
+	case "":
+		interval = "month"
+	case "day", "week", "month":
+	default:
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid interval, expected day, week or month")
+		return
+	}
+
+	from, to, msg, ok := parseDateRange(params, loc)
+	if !ok {
+		u.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if to.IsZero() {
+		_, to, _ = model.PeriodRange(interval, time.Now().In(loc))
+	}
+	if from.IsZero() {
+		from, _, _ = model.PeriodRange(interval, to.Add(-time.Nanosecond).In(loc))
+		for i := 1; i < defaultCashFlowPeriods; i++ {
+			from, _, _ = model.PeriodRange(interval, from.Add(-time.Nanosecond))
+		}
+	}
+	if !from.Before(to) {
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid range, from must be before to")
+		return
+	}
+
+	// Periods line up with the interval, except that the first and last are cut down to the range
+	report := cashFlowReport{Currency: currency, Interval: interval, Total: cashFlowPeriod{Start: from, End: to}}
+	for start := from.In(loc); start.Before(to); {
+		if len(report.Periods) == maxCashFlowPeriods {
+			u.RespondWithError(w, http.StatusBadRequest, "Invalid range, at most "+strconv.Itoa(maxCashFlowPeriods)+" periods can be reported")
+			return
+		}
+
+		_, end, _ := model.PeriodRange(interval, start)
+		if end.After(to) {
+			end = to
+		}
+		report.Periods = append(report.Periods, cashFlowPeriod{Start: start, End: end})
+		start = end
+	}
+
+	ledger := params.Get("ledger")
+	if !s.canViewLedger(w, r, user, ledger) {
+		return
+	}
+
+	expenses, _, err := s.Expenses.FindExpenses(r.Context(), user, dao.ExpenseQuery{
+		LedgerID: ledger,
+		From:     from,
+		To:       to,
+		Types:    []string{model.TypeExpense, model.TypeIncome},
+		Sort:     dao.SortByDate,
+	})
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Both are in date order, so each expense falls in the current period or a later one
+	i := 0
+	for _, expense := range expenses {
+		for !expense.Date.Before(report.Periods[i].End) {
+			i++
+		}
+		period := &report.Periods[i]
+
+		amount, ok := s.amountIn(r.Context(), expense.Price, expense.Currency, currency)
+		if !ok {
+			period.Unconverted++
+			report.Total.Unconverted++
+			continue
+		}
+
+		if expense.Type == model.TypeIncome {
+			period.Income += amount
+			report.Total.Income += amount
+		} else {
+			period.Spent += amount
+			report.Total.Spent += amount
+		}
+	}
+
+	for i := range report.Periods {
+		period := &report.Periods[i]
+		period.Net = period.Income - period.Spent
+	}
+	report.Total.Net = report.Total.Income - report.Total.Spent
+
+	u.RespondWithJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// AllCategories - Endpoint to retrieve all of the user's categories
+func (s *Server) AllCategories(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	categories, err := s.Categories.FindCategories(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if categories == nil {
+		categories = []model.Category{}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, categories)
+}
+
+// GetCategory - Endpoint to get a specific category by id
+func (s *Server) GetCategory(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	category, err := s.ownedCategory(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Category ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, category)
+}
+
+// CreateCategory - Endpoint to create a category
+func (s *Server) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var category model.Category
+
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	category.ID = model.NewID()
+	category.UserID = user
+
+	if resp, ok := s.validateCategory(r.Context(), &category); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if err := s.Categories.InsertCategory(r.Context(), category); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusCreated, category)
+}
+
+// UpdateCategory - Endpoint to update a category
+func (s *Server) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var category model.Category
+
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if _, err := s.ownedCategory(r.Context(), user, category.ID); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Category ID")
+		return
+	}
+
+	category.UserID = user
+
+	if resp, ok := s.validateCategory(r.Context(), &category); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if err := s.Categories.UpdateCategory(r.Context(), category); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// DeleteCategory - Endpoint to delete a category. Its expenses and budgets move to the ?fallback=
+// category, or become uncategorised, and its subcategories move up to its parent.
+func (s *Server) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	category, err := s.ownedCategory(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Category ID")
+		return
+	}
+
+	fallback := r.URL.Query().Get("fallback")
+	if fallback != "" {
+		if fallback == category.ID {
+			u.RespondWithError(w, http.StatusBadRequest, "Fallback category must differ from the deleted category")
+			return
+		}
+		if _, err := s.ownedCategory(r.Context(), user, fallback); err != nil {
+			log.Println(err)
+			u.RespondWithError(w, http.StatusBadRequest, "Invalid fallback Category ID")
+			return
+		}
+	}
+
+	if err := s.Expenses.ReassignExpenseCategory(r.Context(), user, category.ID, fallback); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Budgets keep following the same expenses
+	budgetCategory := fallback
+	if budgetCategory == "" {
+		budgetCategory = dao.NoCategory
+	}
+	if err := s.rescopeBudgets(r.Context(), user, func(budget *model.Budget) bool {
+		if budget.CategoryID != category.ID {
+			return false
+		}
+		budget.CategoryID = budgetCategory
+		return true
+	}); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Recurring expenses create their future expenses where the existing ones went
+	if err := s.rescopeRecurrences(r.Context(), user, func(recurrence *model.Recurrence) bool {
+		if recurrence.CategoryID != category.ID {
+			return false
+		}
+		recurrence.CategoryID = fallback
+		return true
+	}); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	categories, err := s.Categories.FindCategories(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, child := range categories {
+		if child.ParentID != category.ID {
+			continue
+		}
+
+		child.ParentID = category.ParentID
+		if err := s.Categories.UpdateCategory(r.Context(), child); err != nil {
+			log.Println(err)
+			u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := s.Categories.RemoveCategoryByID(r.Context(), category.ID); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Category ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// Gives every new user the default category set. Failures are logged rather than failing sign up.
+func (s *Server) seedCategories(ctx context.Context, user string) {
+	for _, category := range model.DefaultCategories(user) {
+		if err := s.Categories.InsertCategory(ctx, category); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Finds the category, treating one owned by someone else as not found
+func (s *Server) ownedCategory(ctx context.Context, user string, id string) (model.Category, error) {
+	if id == "" {
+		return model.Category{}, dao.ErrNotFound
+	}
+
+	category, err := s.Categories.FindCategoryByID(ctx, id)
+	if err != nil {
+		return model.Category{}, err
+	}
+
+	if category.UserID != user {
+		return model.Category{}, dao.ErrNotFound
+	}
+
+	return category, nil
+}
+
+// Validate category details, including that the parent belongs to the user and doesn't form a cycle
+func (s *Server) validateCategory(ctx context.Context, category *model.Category) (string, bool) {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return "Category name is required", false
+	}
+
+	if category.Colour != "" && !model.ValidColour(category.Colour) {
+		return "Colour must be a hex code such as #4caf50", false
+	}
+
+	// Walk up from the parent, the chain must end without reaching this category
+	for parentID := category.ParentID; parentID != ""; {
+		if parentID == category.ID {
+			return "Category can't be its own ancestor", false
+		}
+
+		parent, err := s.ownedCategory(ctx, category.UserID, parentID)
+		if err != nil {
+			return "Invalid parent Category ID", false
+		}
+		parentID = parent.ParentID
+	}
+
+	return "Requirement passed", true
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	"github.com/wilsonth122/money-tracker-api/pkg/rates"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+var errConversionUnavailable = errors.New("Currency conversion is not available")
+
+// Reads the optional ?currency= parameter, "" means no conversion was asked for
+func requestedCurrency(r *http.Request) (string, bool) {
+	currency := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("currency")))
+	if currency == "" {
+		return "", true
+	}
+
+	return currency, model.ValidCurrency(currency)
+}
+
+// Converts an amount with the configured rates provider
+func (s *Server) convert(ctx context.Context, amount model.Money, from string, to string) (*model.Conversion, error) {
+	if s.Rates == nil {
+		return nil, errConversionUnavailable
+	}
+
+	converted, rate, err := rates.Convert(ctx, s.Rates, amount, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Conversion{Price: converted, Currency: to, Rate: rate.FloatString(6)}, nil
+}
+
+// The amount in another currency, false when it can't be converted
+func (s *Server) amountIn(ctx context.Context, amount model.Money, from string, to string) (model.Money, bool) {
+	if from == to {
+		return amount, true
+	}
+
+	conversion, err := s.convert(ctx, amount, from, to)
+	if err != nil {
+		return 0, false
+	}
+
+	return conversion.Price, true
+}
+
+// Fills in Converted on every expense, keeping the original price and currency untouched
+func (s *Server) convertExpenses(ctx context.Context, expenses []model.Expense, currency string) error {
+	for i := range expenses {
+		conversion, err := s.convert(ctx, expenses[i].Price, expenses[i].Currency, currency)
+		if err != nil {
+			return err
+		}
+		expenses[i].Converted = conversion
+	}
+
+	return nil
+}
+
+// Conversion errors are caused by the request, unless the rates provider itself failed
+func respondWithConversionError(w http.ResponseWriter, err error) {
+	log.Println(err)
+
+	if err == errConversionUnavailable || err == rates.ErrUnknownCurrency {
+		u.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+}
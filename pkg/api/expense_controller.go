@@ -1,119 +1,644 @@
-package api
-
-import (
-	"encoding/json"
-	"log"
-	"net/http"
-
-	"gopkg.in/mgo.v2/bson"
-
-	"github.com/gorilla/mux"
-
-	"github.com/wilsonth122/money-tracker-api/pkg/dao"
-	"github.com/wilsonth122/money-tracker-api/pkg/model"
-	"github.com/wilsonth122/money-tracker-api/pkg/stream"
-	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
-)
-
-// StreamAllExpenses - Endpoint to stream all expenses instead of just get them once
-func StreamAllExpenses(w http.ResponseWriter, r *http.Request) {
-	log.Println("Websocket connection")
-	stream.WsHandler(w, r)
-}
-
-// AllExpenses - Endpoint to retrieve all expenses
-func AllExpenses(w http.ResponseWriter, r *http.Request) {
-	user := r.Context().Value("user").(string)
-	expenses, err := dao.DBConn.FindAllExpenses(user)
-
-	if err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	u.RespondWithJSON(w, http.StatusOK, expenses)
-}
-
-// GetExpense - Endpoint to get a specific expense by id
-func GetExpense(w http.ResponseWriter, r *http.Request) {
-	user := r.Context().Value("user").(string)
-	params := mux.Vars(r)
-	expense, err := dao.DBConn.FindExpenseByID(params["id"])
-
-	if err != nil || expense.UserID != user {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusBadRequest, "Invalid Expense ID")
-		return
-	}
-
-	u.RespondWithJSON(w, http.StatusOK, expense)
-}
-
-// CreateExpense - Endpoint to create an expense
-func CreateExpense(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	user := r.Context().Value("user").(string)
-
-	var expense model.Expense
-	expense.UserID = user
-
-	if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		return
-	}
-
-	expense.ID = bson.NewObjectId()
-
-	if err := dao.DBConn.InsertExpense(expense); err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	// Send new expense to expense stream
-	go stream.Writer(&expense)
-
-	u.RespondWithJSON(w, http.StatusCreated, expense)
-}
-
-// UpdateExpense - Endpoint to update an expense
-func UpdateExpense(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	user := r.Context().Value("user").(string)
-
-	var expense model.Expense
-	expense.UserID = user
-
-	if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		return
-	}
-
-	if err := dao.DBConn.UpdateExpense(expense); err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	// Send updated expense to expense stream
-	go stream.Writer(&expense)
-
-	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
-}
-
-// DeleteExpense - Endpoint to delete an expense
-func DeleteExpense(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	err := dao.DBConn.RemoveExpenseByID(params["id"])
-
-	if err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusBadRequest, "Invalid Expense ID")
-		return
-	}
-
-	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
-}
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	"github.com/wilsonth122/money-tracker-api/pkg/stream"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// Most lines an expense can be split into
+const maxSplits = 50
+
+// StreamAllExpenses - Endpoint to stream all expenses instead of just get them once.
+// Budget alerts are streamed too when connecting with ?v=2
+func (s *Server) StreamAllExpenses(w http.ResponseWriter, r *http.Request) {
+	log.Println("Websocket connection")
+	stream.WsHandler(w, r, s.Keys, s.Revocations)
+}
+
+// AllExpenses - Endpoint to retrieve a page of expenses, filtered and sorted by the query parameters.
+// Optionally converted with ?currency=
+func (s *Server) AllExpenses(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	currency, ok := requestedCurrency(r)
+	if !ok {
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid currency code")
+		return
+	}
+
+	q, msg, ok := parseExpenseQuery(r, s.userSettings(r.Context(), user))
+	if !ok {
+		u.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if !s.canViewLedger(w, r, user, q.LedgerID) {
+		return
+	}
+
+	expenses, next, err := s.Expenses.FindExpenses(r.Context(), user, q)
+
+	if err != nil {
+		log.Println(err)
+		if err == dao.ErrInvalidCursor {
+			u.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if currency != "" {
+		if err := s.convertExpenses(r.Context(), expenses, currency); err != nil {
+			respondWithConversionError(w, err)
+			return
+		}
+	}
+
+	page := expensePage{Expenses: expenses}
+	if page.Expenses == nil {
+		page.Expenses = []model.Expense{}
+	}
+	if next != nil {
+		page.Next = next.Encode()
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, page)
+}
+
+// ExpenseTotals - Endpoint to sum a user's expenses, or those of the shared ?ledger=, one total per currency.
+// With ?currency= the totals are also converted and added up.
+func (s *Server) ExpenseTotals(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	currency, ok := requestedCurrency(r)
+	if !ok {
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid currency code")
+		return
+	}
+
+	var expenses []model.Expense
+	var err error
+
+	if ledger := r.URL.Query().Get("ledger"); ledger != "" {
+		if !s.canViewLedger(w, r, user, ledger) {
+			return
+		}
+		expenses, _, err = s.Expenses.FindExpenses(r.Context(), user, dao.ExpenseQuery{LedgerID: ledger})
+	} else {
+		expenses, err = s.Expenses.FindAllExpenses(r.Context(), user)
+	}
+
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := totalsResponse{Totals: sumByCurrency(expenses)}
+
+	if currency != "" {
+		converted := currencyTotal{Currency: currency}
+		for _, total := range resp.Totals {
+			spent, err := s.convert(r.Context(), total.Spent, total.Currency, currency)
+			if err != nil {
+				respondWithConversionError(w, err)
+				return
+			}
+			saved, err := s.convert(r.Context(), total.Saved, total.Currency, currency)
+			if err != nil {
+				respondWithConversionError(w, err)
+				return
+			}
+			income, err := s.convert(r.Context(), total.Income, total.Currency, currency)
+			if err != nil {
+				respondWithConversionError(w, err)
+				return
+			}
+
+			converted.Spent += spent.Price
+			converted.Saved += saved.Price
+			converted.Income += income.Price
+			converted.Count += total.Count
+		}
+		resp.Converted = &converted
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// ExpenseBreakdown - Endpoint adding up split lines per category, or per person with ?by=person.
+// Takes the filters of GET /api/expenses, counting expenses only unless ?type= says otherwise.
+// Amounts are in ?currency=, or the user's currency.
+func (s *Server) ExpenseBreakdown(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	settings := s.userSettings(r.Context(), user)
+
+	currency, ok := requestedCurrency(r)
+	if !ok {
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid currency code")
+		return
+	}
+	if currency == "" {
+		currency = settings.Currency
+	}
+
+	by := r.URL.Query().Get("by")
+	switch by {
+	case "":
+		by = "category"
+	case "category", "person":
+	default:
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid by, expected category or person")
+		return
+	}
+
+	q, msg, ok := parseExpenseQuery(r, settings)
+	if !ok {
+		u.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+	q.Limit, q.After = 0, nil
+	if len(q.Types) == 0 {
+		q.Types = []string{model.TypeExpense}
+	}
+
+	if !s.canViewLedger(w, r, user, q.LedgerID) {
+		return
+	}
+
+	expenses, _, err := s.Expenses.FindExpenses(r.Context(), user, q)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	category := q.CategoryID
+	if category == dao.NoCategory {
+		category = ""
+	}
+
+	resp := breakdownResponse{By: by, Currency: currency, Lines: []breakdownLine{}}
+	index := make(map[string]int)
+
+	for _, expense := range expenses {
+		for _, line := range expense.Lines() {
+			// Only the lines in the category asked for, not the rest of the receipt
+			if q.CategoryID != "" && line.CategoryID != category {
+				continue
+			}
+
+			amount, ok := s.amountIn(r.Context(), line.Amount, expense.Currency, currency)
+			if !ok {
+				resp.Unconverted++
+				continue
+			}
+
+			key := line.CategoryID
+			if by == "person" {
+				key = line.Person
+			}
+
+			i, ok := index[key]
+			if !ok {
+				i = len(resp.Lines)
+				index[key] = i
+				resp.Lines = append(resp.Lines, breakdownLine{Key: key})
+			}
+			resp.Lines[i].Amount += amount
+			resp.Lines[i].Count++
+		}
+	}
+
+	sort.SliceStable(resp.Lines, func(a, b int) bool { return resp.Lines[a].Amount > resp.Lines[b].Amount })
+
+	u.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// GetExpense - Endpoint to get a specific expense by id, optionally converted with ?currency=
+func (s *Server) GetExpense(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	currency, ok := requestedCurrency(r)
+	if !ok {
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid currency code")
+		return
+	}
+
+	expense, _, err := s.visibleExpense(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Expense ID")
+		return
+	}
+
+	if currency != "" {
+		if expense.Converted, err = s.convert(r.Context(), expense.Price, expense.Currency, currency); err != nil {
+			respondWithConversionError(w, err)
+			return
+		}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, expense)
+}
+
+// CreateExpense - Endpoint to create an expense
+func (s *Server) CreateExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var expense model.Expense
+	expense.UserID = user
+
+	if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	if !s.canEditLedger(w, r, user, expense.LedgerID) {
+		return
+	}
+
+	settings := s.userSettings(r.Context(), user)
+
+	if resp, ok := s.validateExpense(r.Context(), &expense, settings); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	expense.ID = model.NewID()
+	expense.RecurrenceID = ""
+	spending := s.budgetSpending(r.Context(), settings, expense)
+
+	if err := s.Expenses.InsertExpense(r.Context(), expense); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send new expense to expense stream
+	s.streamExpense(r.Context(), expense)
+	s.sendBudgetAlerts(r.Context(), spending)
+
+	u.RespondWithJSON(w, http.StatusCreated, expense)
+}
+
+// UpdateExpense - Endpoint to update an expense. Editors of a shared ledger can update any of its expenses,
+// which keep linking to the categories, accounts and goals of whoever recorded them.
+func (s *Server) UpdateExpense(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var expense model.Expense
+
+	if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	existing, role, err := s.visibleExpense(r.Context(), user, expense.ID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Expense ID")
+		return
+	}
+
+	if !model.CanEdit(role) {
+		u.RespondWithError(w, http.StatusForbidden, "Viewers can't change the ledger's expenses")
+		return
+	}
+
+	if existing.TransferID != "" {
+		u.RespondWithError(w, http.StatusBadRequest, "Transfers can't be edited, delete and make them again")
+		return
+	}
+
+	if expense.LedgerID != existing.LedgerID {
+		if existing.UserID != user {
+			u.RespondWithError(w, http.StatusForbidden, "Only whoever recorded an expense can move it to another ledger")
+			return
+		}
+		if !s.canEditLedger(w, r, user, expense.LedgerID) {
+			return
+		}
+	}
+
+	expense.UserID = existing.UserID
+	// Only the scheduler links expenses to the rule that created them
+	expense.RecurrenceID = existing.RecurrenceID
+	settings := s.userSettings(r.Context(), existing.UserID)
+
+	if resp, ok := s.validateExpense(r.Context(), &expense, settings); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	spending := s.budgetSpending(r.Context(), settings, expense)
+
+	if err := s.Expenses.UpdateExpense(r.Context(), expense); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send updated expense to expense stream
+	s.streamExpense(r.Context(), expense)
+	s.sendBudgetAlerts(r.Context(), spending)
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// DeleteExpense - Endpoint to delete an expense, deleting either entry of a transfer deletes both
+func (s *Server) DeleteExpense(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	expense, role, err := s.visibleExpense(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Expense ID")
+		return
+	}
+
+	if !model.CanEdit(role) {
+		u.RespondWithError(w, http.StatusForbidden, "Viewers can't change the ledger's expenses")
+		return
+	}
+
+	entries := []model.Expense{expense}
+	if expense.TransferID != "" {
+		entries = s.transferEntries(r.Context(), user, expense)
+	}
+	attachments := s.expenseAttachments(r.Context(), entries)
+
+	if expense.TransferID != "" {
+		err = s.Expenses.RemoveTransfer(r.Context(), expense.TransferID)
+	} else {
+		err = s.Expenses.RemoveExpenseByID(r.Context(), expense.ID)
+	}
+
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Expense ID")
+		return
+	}
+
+	s.removeAttachments(r.Context(), entries, attachments)
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// Finds the expense and the user's role for it, as the owner of a private expense or a member of its ledger
+func (s *Server) visibleExpense(ctx context.Context, user string, id string) (model.Expense, string, error) {
+	expense, err := s.Expenses.FindExpenseByID(ctx, id)
+	if err != nil {
+		return model.Expense{}, "", err
+	}
+
+	role := s.expenseRole(ctx, user, expense)
+	if role == "" {
+		return model.Expense{}, "", dao.ErrNotFound
+	}
+
+	return expense, role, nil
+}
+
+// Validate expense details, filling in what the client left out from its account or the user's settings.
+// The category, goal and account it links to must belong to the user.
+func (s *Server) validateExpense(ctx context.Context, expense *model.Expense, user model.User) (string, bool) {
+	// Whether money went in or out is the type's job, the price is always the amount
+	if expense.Price <= 0 {
+		return "Price must be more than zero", false
+	}
+
+	var account model.Account
+	if expense.AccountID != "" {
+		var err error
+		if account, err = s.ownedAccount(ctx, user.Email, expense.AccountID); err != nil {
+			return "Invalid Account ID", false
+		}
+	}
+
+	expense.Currency = strings.ToUpper(strings.TrimSpace(expense.Currency))
+	if expense.Currency == "" {
+		expense.Currency = user.Currency
+		if account.ID != "" {
+			expense.Currency = account.Currency
+		}
+	}
+
+	if !model.ValidCurrency(expense.Currency) {
+		return "Currency must be an ISO 4217 code with two decimal places, such as GBP", false
+	}
+
+	// Clients that only know isSaving leave the type out
+	expense.ResolveType()
+	if !model.ValidTransactionType(expense.Type) {
+		return "Type must be expense, income, saving, transfer or settlement", false
+	}
+	if expense.Type == model.TypeTransfer {
+		return "Transfers between accounts are made with /api/transfers", false
+	}
+	if expense.Type == model.TypeSettlement {
+		return "Settlements are recorded with /api/ledgers/{id}/settlements", false
+	}
+	// Transfer and settlement entries are only ever written by CreateTransfer and CreateSettlement
+	expense.TransferID = ""
+	expense.Incoming = false
+
+	if account.ID != "" && expense.Currency != account.Currency {
+		return "Currency must match the account's currency", false
+	}
+
+	tags, err := model.NormaliseTags(expense.Tags)
+	if err != nil {
+		return err.Error(), false
+	}
+	expense.Tags = tags
+
+	if expense.Date.IsZero() {
+		expense.Date = model.NewDate(time.Now())
+	}
+	expense.Date = expense.Date.Resolve(user.Location())
+
+	if expense.CategoryID != "" {
+		if _, err := s.ownedCategory(ctx, user.Email, expense.CategoryID); err != nil {
+			return "Invalid Category ID", false
+		}
+	}
+
+	if len(expense.Splits) > 0 {
+		if resp, ok := s.validateSplits(ctx, expense, user); !ok {
+			return resp, false
+		}
+	}
+
+	if resp, ok := s.validateParticipants(ctx, expense); !ok {
+		return resp, false
+	}
+
+	if expense.GoalID != "" {
+		if expense.Type != model.TypeSaving {
+			return "Only savings can count towards a goal", false
+		}
+		if _, err := s.ownedGoal(ctx, user.Email, expense.GoalID); err != nil {
+			return "Invalid Goal ID", false
+		}
+	}
+
+	return "Requirement passed", true
+}
+
+// Validate the split lines of an expense. Lines without a category take the expense's,
+// which is then cleared so that categories are only on the lines.
+func (s *Server) validateSplits(ctx context.Context, expense *model.Expense, user model.User) (string, bool) {
+	if len(expense.Splits) > maxSplits {
+		return "An expense can be split at most " + strconv.Itoa(maxSplits) + " ways", false
+	}
+
+	var total model.Money
+	for i := range expense.Splits {
+		line := &expense.Splits[i]
+
+		if line.Amount <= 0 {
+			return "Split amounts must be more than zero", false
+		}
+		total += line.Amount
+
+		line.Person = strings.TrimSpace(line.Person)
+		line.Note = strings.TrimSpace(line.Note)
+
+		if line.CategoryID == "" {
+			line.CategoryID = expense.CategoryID
+		} else if _, err := s.ownedCategory(ctx, user.Email, line.CategoryID); err != nil {
+			return "Invalid Category ID", false
+		}
+	}
+
+	if total != expense.Price {
+		return "Split amounts must add up to the price", false
+	}
+	expense.CategoryID = ""
+
+	return "Requirement passed", true
+}
+
+// Validate who paid for and who shares an expense in a shared ledger. The payer defaults to whoever
+// recorded it, and both they and anyone named on a split line must be members.
+// Private expenses have no payer, their split lines can name anyone.
+func (s *Server) validateParticipants(ctx context.Context, expense *model.Expense) (string, bool) {
+	expense.PaidBy = strings.TrimSpace(expense.PaidBy)
+	if expense.LedgerID == "" {
+		expense.PaidBy = ""
+		return "Requirement passed", true
+	}
+
+	ledger, err := s.Ledgers.FindLedgerByID(ctx, expense.LedgerID)
+	if err != nil {
+		return "Invalid Ledger ID", false
+	}
+
+	if expense.PaidBy == "" {
+		expense.PaidBy = expense.UserID
+	}
+	if ledger.Role(expense.PaidBy) == "" {
+		return "Paid by must be a member of the ledger", false
+	}
+
+	for _, line := range expense.Splits {
+		if line.Person != "" && ledger.Role(line.Person) == "" {
+			return "Split lines in a ledger must name one of its members", false
+		}
+	}
+
+	return "Requirement passed", true
+}
+
+// Explains a payload that failed to decode, passing on our own validation messages
+func payloadError(err error) string {
+	if err == model.ErrInvalidMoney || err == model.ErrInvalidDate {
+		return err.Error()
+	}
+
+	return "Invalid request payload"
+}
+
+// totalsResponse - Per currency totals, plus their sum in the requested currency
+type totalsResponse struct {
+	Totals    []currencyTotal `json:"totals"`
+	Converted *currencyTotal  `json:"converted,omitempty"`
+}
+
+// currencyTotal - Amounts spent, saved and received in a single currency. Transfers are only counted.
+type currencyTotal struct {
+	Currency string      `json:"currency"`
+	Spent    model.Money `json:"spent"`
+	Saved    model.Money `json:"saved"`
+	Income   model.Money `json:"income"`
+	Count    int         `json:"count"`
+}
+
+// breakdownResponse - Split lines added up per category or person, largest first
+type breakdownResponse struct {
+	By       string          `json:"by"`
+	Currency string          `json:"currency"`
+	Lines    []breakdownLine `json:"lines"`
+	// Unconverted counts lines in other currencies left out because no rate was available
+	Unconverted int `json:"unconverted,omitempty"`
+}
+
+// breakdownLine - The total of the lines sharing a category or person. Key is the category id or the
+// person, empty for uncategorised lines or the user's own share.
+type breakdownLine struct {
+	Key    string      `json:"key"`
+	Amount model.Money `json:"amount"`
+	Count  int         `json:"count"`
+}
+
+// Sums expenses exactly, without mixing currencies. Ordered by currency code.
+func sumByCurrency(expenses []model.Expense) []currencyTotal {
+	totals := []currencyTotal{}
+	index := make(map[string]int)
+
+	for _, expense := range expenses {
+		i, ok := index[expense.Currency]
+		if !ok {
+			i = len(totals)
+			index[expense.Currency] = i
+			totals = append(totals, currencyTotal{Currency: expense.Currency})
+		}
+
+		switch expense.Type {
+		case model.TypeExpense:
+			totals[i].Spent += expense.Price
+		case model.TypeSaving:
+			totals[i].Saved += expense.Price
+		case model.TypeIncome:
+			totals[i].Income += expense.Price
+		}
+		totals[i].Count++
+	}
+
+	sort.Slice(totals, func(a, b int) bool { return totals[a].Currency < totals[b].Currency })
+
+	return totals
+}
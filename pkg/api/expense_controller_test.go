@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// A server keeping everything in one memory store, which holds the user
+func newMemoryServer(t *testing.T, user model.User) (*Server, *dao.MemoryStore) {
+	t.Helper()
+
+	store := dao.NewMemoryStore()
+	if err := store.InsertUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Server{
+		Users:         store,
+		Expenses:      store,
+		Categories:    store,
+		Tags:          store,
+		Budgets:       store,
+		Recurrences:   store,
+		Goals:         store,
+		Accounts:      store,
+		Ledgers:       store,
+		Attachments:   store,
+		RefreshTokens: store,
+		UserTokens:    store,
+		Revocations:   store,
+	}, store
+}
+
+// Calls the handler as an authenticated user, returning the response
+func callAs(handler http.HandlerFunc, user string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), "user", user))
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	return w
+}
+
+func TestUpdateExpenseKeepsRecurrence(t *testing.T) {
+	ctx := context.Background()
+	s, store := newMemoryServer(t, model.User{Email: "a@x.com", Currency: "GBP"})
+
+	expense := model.Expense{
+		ID:           model.NewID(),
+		UserID:       "a@x.com",
+		Title:        "Rent",
+		Price:        50000,
+		Currency:     "GBP",
+		Date:         model.NewDate(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Type:         model.TypeExpense,
+		RecurrenceID: "rule",
+	}
+	if err := store.InsertExpense(ctx, expense); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "left out", body: `{"id":"` + expense.ID + `","title":"Rent and bills","price":"600.00","date":"2020-01-01"}`},
+		{name: "cleared", body: `{"id":"` + expense.ID + `","title":"Rent and bills","price":"600.00","date":"2020-01-01","recurrenceID":""}`},
+		{name: "changed", body: `{"id":"` + expense.ID + `","title":"Rent and bills","price":"600.00","date":"2020-01-01","recurrenceID":"other"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := callAs(s.UpdateExpense, "a@x.com", tt.body); w.Code != http.StatusOK {
+				t.Fatalf("update returned %d: %s", w.Code, w.Body)
+			}
+
+			stored, err := store.FindExpenseByID(ctx, expense.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Title != "Rent and bills" || stored.Price != 60000 {
+				t.Errorf("update wasn't stored: %+v", stored)
+			}
+			if stored.RecurrenceID != "rule" {
+				t.Errorf("recurrence ID is %q, want it kept as %q", stored.RecurrenceID, "rule")
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// expensePage - Response envelope for GET /api/expenses
+type expensePage struct {
+	Expenses []model.Expense `json:"expenses"`
+	// Next is passed back as ?cursor= to fetch the following page, absent on the last page
+	Next string `json:"next,omitempty"`
+}
+
+// Builds a DAO query from the parameters of GET /api/expenses:
+//
+//	ledger          shared ledger id, for all of its expenses instead of those the user recorded
+//	from, to        RFC 3339 timestamps or calendar dates, a calendar `to` includes that whole day
+//	period, at      day, week, month or year around the calendar date `at` (default today)
+//	type            comma separated transaction types: expense, income, saving, transfer or settlement
+//	isSaving        true or false
+//	title           case-insensitive substring
+//	minPrice, maxPrice, icon
+//	category        category id, or "none" for uncategorised expenses
+//	goal            savings goal id
+//	account         account id
+//	tags, tagMatch  comma separated tags; any (default) or all of them
+//	sort, order     date, price or title; asc or desc (default date desc)
+//	limit, cursor   page size and the `next` value of the previous page
+//
+// Dates are interpreted in the user's timezone. The string is an error message when ok is false.
+func parseExpenseQuery(r *http.Request, user model.User) (q dao.ExpenseQuery, msg string, ok bool) {
+	params := r.URL.Query()
+
+	if q.From, q.To, msg, ok = parseDateRange(params, user.Location()); !ok {
+		return q, msg, false
+	}
+
+	if v := params.Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if !model.ValidTransactionType(t) {
+				return q, "Invalid type, expected expense, income, saving, transfer or settlement", false
+			}
+			q.Types = append(q.Types, t)
+		}
+	}
+
+	if v := params.Get("isSaving"); v != "" {
+		isSaving, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, "Invalid isSaving, expected true or false", false
+		}
+		q.IsSaving = &isSaving
+	}
+
+	q.LedgerID = params.Get("ledger")
+	q.Title = params.Get("title")
+	q.Icon = params.Get("icon")
+	q.CategoryID = params.Get("category")
+	q.GoalID = params.Get("goal")
+	q.AccountID = params.Get("account")
+
+	if v := params.Get("minPrice"); v != "" {
+		price, err := model.ParseMoney(v)
+		if err != nil {
+			return q, "Invalid minPrice: " + err.Error(), false
+		}
+		q.MinPrice = &price
+	}
+
+	if v := params.Get("maxPrice"); v != "" {
+		price, err := model.ParseMoney(v)
+		if err != nil {
+			return q, "Invalid maxPrice: " + err.Error(), false
+		}
+		q.MaxPrice = &price
+	}
+
+	if v := params.Get("tags"); v != "" {
+		tags, err := model.NormaliseTags(strings.Split(v, ","))
+		if err != nil {
+			return q, "Invalid tags: " + err.Error(), false
+		}
+		q.Tags = tags
+	}
+
+	switch params.Get("tagMatch") {
+	case "", "any":
+	case "all":
+		q.AllTags = true
+	default:
+		return q, "Invalid tagMatch, expected any or all", false
+	}
+
+	switch v := params.Get("sort"); v {
+	case "", dao.SortByDate, dao.SortByPrice, dao.SortByTitle:
+		q.Sort = v
+	default:
+		return q, "Invalid sort, expected date, price or title", false
+	}
+
+	switch v := params.Get("order"); v {
+	case "", "desc":
+		q.Descending = true
+	case "asc":
+		q.Descending = false
+	default:
+		return q, "Invalid order, expected asc or desc", false
+	}
+
+	q.Limit = defaultPageSize
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return q, "Invalid limit, expected a number from 1 to " + strconv.Itoa(maxPageSize), false
+		}
+		q.Limit = limit
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		cursor, err := dao.DecodeCursor(v)
+		if err != nil {
+			return q, err.Error(), false
+		}
+		q.After = cursor
+	}
+
+	return q, "", true
+}
+
+// Reads the range of from and to, or of period and at, as described for parseExpenseQuery.
+// Either end is zero when it wasn't given.
+func parseDateRange(params url.Values, loc *time.Location) (from time.Time, to time.Time, msg string, ok bool) {
+	if v := params.Get("period"); v != "" {
+		at := time.Now().In(loc)
+		if param := params.Get("at"); param != "" {
+			parsed, err := time.ParseInLocation(model.CalendarDate, param, loc)
+			if err != nil {
+				return from, to, "Invalid at, expected a calendar date such as 2019-08-15", false
+			}
+			at = parsed
+		}
+
+		var err error
+		if from, to, err = model.PeriodRange(v, at); err != nil {
+			return from, to, "Invalid period, expected day, week, month or year", false
+		}
+	}
+
+	if v := params.Get("from"); v != "" {
+		parsed, err := model.ParseDate(v)
+		if err != nil {
+			return from, to, "Invalid from: " + err.Error(), false
+		}
+		from = parsed.Resolve(loc).Time
+	}
+
+	if v := params.Get("to"); v != "" {
+		parsed, err := model.ParseDate(v)
+		if err != nil {
+			return from, to, "Invalid to: " + err.Error(), false
+		}
+		to = parsed.Resolve(loc).Time
+		if parsed.IsCalendarDate() {
+			to = to.In(loc).AddDate(0, 0, 1)
+		}
+	}
+
+	return from, to, "", true
+}
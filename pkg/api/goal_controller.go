@@ -0,0 +1,319 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// goalProgress - Response of GET /api/goals/{id}/progress
+type goalProgress struct {
+	Goal          model.SavingsGoal `json:"goal"`
+	Saved         model.Money       `json:"saved"`
+	Remaining     model.Money       `json:"remaining"`
+	Percent       int               `json:"percent"`
+	Reached       bool              `json:"reached"`
+	Contributions int               `json:"contributions"`
+	// Unconverted counts savings in other currencies left out because no rate was available
+	Unconverted int `json:"unconverted,omitempty"`
+
+	// RequiredMonthly is what has to be saved each month to meet the deadline, null without one
+	RequiredMonthly *model.Money `json:"requiredMonthly"`
+	// ProjectedCompletion extrapolates the average rate saved at so far, null before the first saving.
+	// Once the goal is reached it is the date of the saving that reached it.
+	ProjectedCompletion model.Date `json:"projectedCompletion"`
+	// OnTrack is whether the projection meets the deadline, null without one
+	OnTrack *bool `json:"onTrack"`
+}
+
+// AllGoals - Endpoint to retrieve all of the user's savings goals
+func (s *Server) AllGoals(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	goals, err := s.Goals.FindGoals(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if goals == nil {
+		goals = []model.SavingsGoal{}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, goals)
+}
+
+// GetGoal - Endpoint to get a specific savings goal by id
+func (s *Server) GetGoal(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	goal, err := s.ownedGoal(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Goal ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, goal)
+}
+
+// CreateGoal - Endpoint to create a savings goal
+func (s *Server) CreateGoal(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var goal model.SavingsGoal
+
+	if err := json.NewDecoder(r.Body).Decode(&goal); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	goal.ID = model.NewID()
+	goal.UserID = user
+	goal.CreatedAt = model.NewDate(time.Now())
+
+	if resp, ok := validateGoal(&goal, s.userSettings(r.Context(), user)); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if err := s.Goals.InsertGoal(r.Context(), goal); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusCreated, goal)
+}
+
+// UpdateGoal - Endpoint to update a savings goal
+func (s *Server) UpdateGoal(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var goal model.SavingsGoal
+
+	if err := json.NewDecoder(r.Body).Decode(&goal); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	existing, err := s.ownedGoal(r.Context(), user, goal.ID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Goal ID")
+		return
+	}
+
+	goal.UserID = user
+	goal.CreatedAt = existing.CreatedAt
+
+	if resp, ok := validateGoal(&goal, s.userSettings(r.Context(), user)); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if err := s.Goals.UpdateGoal(r.Context(), goal); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// DeleteGoal - Endpoint to delete a savings goal, its savings are kept but no longer linked to a goal
+func (s *Server) DeleteGoal(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	goal, err := s.ownedGoal(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Goal ID")
+		return
+	}
+
+	if err := s.Expenses.ReassignExpenseGoal(r.Context(), user, goal.ID, ""); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.Goals.RemoveGoalByID(r.Context(), goal.ID); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Goal ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// GoalProgress - Endpoint reporting how far a savings goal has got, the monthly contribution
+// needed to meet its deadline and when it will be reached at the current rate
+func (s *Server) GoalProgress(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	goal, err := s.ownedGoal(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Goal ID")
+		return
+	}
+
+	savings, _, err := s.Expenses.FindExpenses(r.Context(), user, dao.ExpenseQuery{
+		Types:  []string{model.TypeSaving},
+		GoalID: goal.ID,
+		Sort:   dao.SortByDate,
+	})
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	progress := goalProgress{Goal: goal}
+	now := time.Now()
+	start := goal.CreatedAt.Time
+
+	for _, saving := range savings {
+		amount, ok := s.goalAmount(r.Context(), goal, saving)
+		if !ok {
+			progress.Unconverted++
+			continue
+		}
+
+		if saving.Date.Before(start) {
+			start = saving.Date.Time
+		}
+
+		progress.Saved += amount
+		progress.Contributions++
+		if !progress.Reached && progress.Saved >= goal.Target {
+			progress.Reached = true
+			progress.ProjectedCompletion = saving.Date
+		}
+	}
+
+	progress.Remaining = goal.Target - progress.Saved
+	if progress.Remaining < 0 {
+		progress.Remaining = 0
+	}
+	progress.Percent = percentOf(progress.Saved, goal.Target)
+
+	if !progress.Reached && progress.Saved > 0 {
+		// Average rate per day since saving started, at least a day in so one saving isn't extrapolated wildly
+		days := now.Sub(start).Hours() / 24
+		if days < 1 {
+			days = 1
+		}
+		rate := float64(progress.Saved) / days
+		progress.ProjectedCompletion = model.NewDate(now.Add(time.Duration(float64(progress.Remaining) / rate * 24 * float64(time.Hour))))
+	}
+
+	if !goal.Deadline.IsZero() {
+		required := model.Money(0)
+		if !progress.Reached {
+			months := model.Money(monthsUntil(now, goal.Deadline.Time))
+			required = (progress.Remaining + months - 1) / months
+		}
+		progress.RequiredMonthly = &required
+
+		onTrack := progress.Reached ||
+			(!progress.ProjectedCompletion.IsZero() && !progress.ProjectedCompletion.After(goal.Deadline.Time))
+		progress.OnTrack = &onTrack
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, progress)
+}
+
+// Finds the savings goal, treating one owned by someone else as not found
+func (s *Server) ownedGoal(ctx context.Context, user string, id string) (model.SavingsGoal, error) {
+	if id == "" {
+		return model.SavingsGoal{}, dao.ErrNotFound
+	}
+
+	goal, err := s.Goals.FindGoalByID(ctx, id)
+	if err != nil {
+		return model.SavingsGoal{}, err
+	}
+
+	if goal.UserID != user {
+		return model.SavingsGoal{}, dao.ErrNotFound
+	}
+
+	return goal, nil
+}
+
+// Validate savings goal details, filling in the currency when left out
+func validateGoal(goal *model.SavingsGoal, user model.User) (string, bool) {
+	goal.Name = strings.TrimSpace(goal.Name)
+	if goal.Name == "" {
+		return "Goal name is required", false
+	}
+
+	if goal.Target <= 0 {
+		return "Goal target must be more than zero", false
+	}
+
+	goal.Currency = strings.ToUpper(strings.TrimSpace(goal.Currency))
+	if goal.Currency == "" {
+		goal.Currency = user.Currency
+	}
+	if !model.ValidCurrency(goal.Currency) {
+		return "Currency must be an ISO 4217 code with two decimal places, such as GBP", false
+	}
+
+	if !goal.Deadline.IsZero() {
+		goal.Deadline = goal.Deadline.Resolve(user.Location())
+	}
+
+	return "Requirement passed", true
+}
+
+// The saving's amount in the goal's currency, false when it can't be converted
+func (s *Server) goalAmount(ctx context.Context, goal model.SavingsGoal, saving model.Expense) (model.Money, bool) {
+	if saving.Currency == goal.Currency {
+		return saving.Price, true
+	}
+
+	conversion, err := s.convert(ctx, saving.Price, saving.Currency, goal.Currency)
+	if err != nil {
+		return 0, false
+	}
+
+	return conversion.Price, true
+}
+
+// Calendar months left before the deadline, counting a part month as a whole one and never less than one
+func monthsUntil(now time.Time, deadline time.Time) int {
+	deadline = deadline.In(now.Location())
+
+	months := (deadline.Year()-now.Year())*12 + int(deadline.Month()-now.Month())
+	if deadline.Day() > now.Day() {
+		months++
+	}
+
+	if months < 1 {
+		return 1
+	}
+
+	return months
+}
@@ -0,0 +1,513 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/mail"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	"github.com/wilsonth122/money-tracker-api/pkg/stream"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// AllLedgers - Endpoint to retrieve every ledger the user is a member of
+func (s *Server) AllLedgers(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	ledgers, err := s.Ledgers.FindLedgers(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if ledgers == nil {
+		ledgers = []model.Ledger{}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, ledgers)
+}
+
+// GetLedger - Endpoint to get a specific ledger and its members by id
+func (s *Server) GetLedger(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	ledger, _, err := s.memberLedger(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Ledger ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, ledger)
+}
+
+// CreateLedger - Endpoint to create a shared ledger, owned by the user creating it
+func (s *Server) CreateLedger(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var ledger model.Ledger
+
+	if err := json.NewDecoder(r.Body).Decode(&ledger); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	ledger.ID = model.NewID()
+	ledger.Members = []model.LedgerMember{{UserID: user, Role: model.RoleOwner}}
+
+	if resp, ok := validateLedger(&ledger); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if err := s.Ledgers.InsertLedger(r.Context(), ledger); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusCreated, ledger)
+}
+
+// UpdateLedger - Endpoint for the owner to rename a ledger
+func (s *Server) UpdateLedger(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var ledger model.Ledger
+
+	if err := json.NewDecoder(r.Body).Decode(&ledger); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	if _, ok := s.ownerLedger(w, r, user, ledger.ID); !ok {
+		return
+	}
+
+	if resp, ok := validateLedger(&ledger); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if err := s.Ledgers.UpdateLedger(r.Context(), ledger); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// DeleteLedger - Endpoint for the owner to delete a ledger. Its expenses become private to whoever recorded them.
+func (s *Server) DeleteLedger(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	ledger, ok := s.ownerLedger(w, r, user, params["id"])
+	if !ok {
+		return
+	}
+
+	if err := s.Ledgers.RemoveLedgerByID(r.Context(), ledger.ID); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Ledger ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// LedgerInvites - Endpoint for the owner to list a ledger's pending invites
+func (s *Server) LedgerInvites(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	ledger, ok := s.ownerLedger(w, r, user, params["id"])
+	if !ok {
+		return
+	}
+
+	invites, err := s.Ledgers.FindLedgerInvites(r.Context(), ledger.ID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if invites == nil {
+		invites = []model.LedgerInvite{}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, invites)
+}
+
+// InviteMember - Endpoint for the owner to invite someone to a ledger by email, as an editor or a viewer.
+// The invite waits for them under GET /api/invites, whether or not they have signed up yet.
+func (s *Server) InviteMember(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	var invite model.LedgerInvite
+
+	if err := json.NewDecoder(r.Body).Decode(&invite); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	ledger, ok := s.ownerLedger(w, r, user, params["id"])
+	if !ok {
+		return
+	}
+
+	invite.Email = strings.TrimSpace(invite.Email)
+	if !strings.Contains(invite.Email, "@") {
+		u.RespondWithError(w, http.StatusBadRequest, "Email address is required")
+		return
+	}
+
+	if invite.Role == "" {
+		invite.Role = model.RoleEditor
+	}
+	if !model.ValidMemberRole(invite.Role) {
+		u.RespondWithError(w, http.StatusBadRequest, "Role must be editor or viewer")
+		return
+	}
+
+	if ledger.Role(invite.Email) != "" {
+		u.RespondWithError(w, http.StatusConflict, "Already a member of the ledger")
+		return
+	}
+
+	pending, err := s.Ledgers.FindLedgerInvites(r.Context(), ledger.ID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, other := range pending {
+		if other.Email == invite.Email {
+			u.RespondWithError(w, http.StatusConflict, "Already invited to the ledger")
+			return
+		}
+	}
+
+	invite.ID = model.NewID()
+	invite.LedgerID = ledger.ID
+	invite.InvitedBy = user
+	invite.Created = time.Now().UTC()
+
+	if err := s.Ledgers.InsertInvite(r.Context(), invite); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The invite stands whether or not the email gets there, it is also listed under /api/invites
+	s.sendMail(mail.Message{
+		To:      invite.Email,
+		Subject: "You've been invited to a Money Tracker ledger",
+		Body: user + " has invited you to the " + ledger.Name + " ledger on Money Tracker with the " + invite.Role +
+			" role. Sign up or log in with this email address to accept it:\n\n" +
+			strings.TrimSuffix(s.AppURL, "/") + "/invites\n\n" +
+			"If you don't know " + user + ", ignore this email.\n",
+	})
+
+	u.RespondWithJSON(w, http.StatusCreated, invite)
+}
+
+// UpdateMember - Endpoint for the owner to change a member's role to editor or viewer
+func (s *Server) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	var member model.LedgerMember
+
+	if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	ledger, ok := s.ownerLedger(w, r, user, params["id"])
+	if !ok {
+		return
+	}
+
+	switch ledger.Role(member.UserID) {
+	case "":
+		u.RespondWithError(w, http.StatusBadRequest, "Not a member of the ledger")
+		return
+	case model.RoleOwner:
+		u.RespondWithError(w, http.StatusBadRequest, "The owner's role can't be changed")
+		return
+	}
+
+	if !model.ValidMemberRole(member.Role) {
+		u.RespondWithError(w, http.StatusBadRequest, "Role must be editor or viewer")
+		return
+	}
+
+	if err := s.Ledgers.SetLedgerMember(r.Context(), ledger.ID, member); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// RemoveMember - Endpoint for the owner to remove a member, or for members to leave.
+// The expenses they recorded stay in the ledger.
+func (s *Server) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	ledger, role, err := s.memberLedger(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Ledger ID")
+		return
+	}
+
+	member := params["user"]
+	switch {
+	case ledger.Role(member) == "":
+		u.RespondWithError(w, http.StatusBadRequest, "Not a member of the ledger")
+		return
+	case ledger.Role(member) == model.RoleOwner:
+		u.RespondWithError(w, http.StatusBadRequest, "The owner can't leave the ledger, delete it instead")
+		return
+	case member != user && role != model.RoleOwner:
+		u.RespondWithError(w, http.StatusForbidden, "Only the ledger's owner can remove other members")
+		return
+	}
+
+	if err := s.Ledgers.RemoveLedgerMember(r.Context(), ledger.ID, member); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Not a member of the ledger")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// AllInvites - Endpoint to retrieve the ledger invites waiting for the user
+func (s *Server) AllInvites(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	invites, err := s.Ledgers.FindInvites(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if invites == nil {
+		invites = []model.LedgerInvite{}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, invites)
+}
+
+// AcceptInvite - Endpoint to join the ledger an invite sent to the user is for
+func (s *Server) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	invite, err := s.Ledgers.FindInviteByID(r.Context(), params["id"])
+	if err != nil || invite.Email != user {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Invite ID")
+		return
+	}
+
+	ledger, err := s.Ledgers.FindLedgerByID(r.Context(), invite.LedgerID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Invite ID")
+		return
+	}
+
+	// Someone already in the ledger keeps the role they have
+	if ledger.Role(user) == "" {
+		member := model.LedgerMember{UserID: user, Role: invite.Role}
+		if err := s.Ledgers.SetLedgerMember(r.Context(), ledger.ID, member); err != nil {
+			log.Println(err)
+			u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		ledger.Members = append(ledger.Members, member)
+	}
+
+	if err := s.Ledgers.RemoveInviteByID(r.Context(), invite.ID); err != nil && err != dao.ErrNotFound {
+		log.Println(err)
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, ledger)
+}
+
+// DeleteInvite - Endpoint for the user to decline an invite sent to them, or for the ledger's owner to withdraw it
+func (s *Server) DeleteInvite(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	invite, err := s.Ledgers.FindInviteByID(r.Context(), params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Invite ID")
+		return
+	}
+
+	if invite.Email != user {
+		if _, role, err := s.memberLedger(r.Context(), user, invite.LedgerID); err != nil || role != model.RoleOwner {
+			log.Println(err)
+			u.RespondWithError(w, http.StatusBadRequest, "Invalid Invite ID")
+			return
+		}
+	}
+
+	if err := s.Ledgers.RemoveInviteByID(r.Context(), invite.ID); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Invite ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// Finds the ledger and the user's role in it, treating one they don't belong to as not found
+func (s *Server) memberLedger(ctx context.Context, user string, id string) (model.Ledger, string, error) {
+	if id == "" {
+		return model.Ledger{}, "", dao.ErrNotFound
+	}
+
+	ledger, err := s.Ledgers.FindLedgerByID(ctx, id)
+	if err != nil {
+		return model.Ledger{}, "", err
+	}
+
+	role := ledger.Role(user)
+	if role == "" {
+		return model.Ledger{}, "", dao.ErrNotFound
+	}
+
+	return ledger, role, nil
+}
+
+// Finds a ledger the user owns, responding with the error when they don't
+func (s *Server) ownerLedger(w http.ResponseWriter, r *http.Request, user string, id string) (model.Ledger, bool) {
+	ledger, role, err := s.memberLedger(r.Context(), user, id)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Ledger ID")
+		return model.Ledger{}, false
+	}
+
+	if role != model.RoleOwner {
+		u.RespondWithError(w, http.StatusForbidden, "Only the ledger's owner can do that")
+		return model.Ledger{}, false
+	}
+
+	return ledger, true
+}
+
+// Checks the user belongs to the ledger, responding with the error when they don't.
+// An empty id stands for the user's own expenses.
+func (s *Server) canViewLedger(w http.ResponseWriter, r *http.Request, user string, id string) bool {
+	if id == "" {
+		return true
+	}
+
+	if _, _, err := s.memberLedger(r.Context(), user, id); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Ledger ID")
+		return false
+	}
+
+	return true
+}
+
+// Checks the user can add and change expenses in the ledger, responding with the error when they can't.
+// An empty id stands for the user's private expenses.
+func (s *Server) canEditLedger(w http.ResponseWriter, r *http.Request, user string, id string) bool {
+	if id == "" {
+		return true
+	}
+
+	_, role, err := s.memberLedger(r.Context(), user, id)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Ledger ID")
+		return false
+	}
+
+	if !model.CanEdit(role) {
+		u.RespondWithError(w, http.StatusForbidden, "Viewers can't change the ledger's expenses")
+		return false
+	}
+
+	return true
+}
+
+// The user's role for the expense: owner of their private expenses, their membership role for
+// expenses in a shared ledger, and empty when they have no access at all
+func (s *Server) expenseRole(ctx context.Context, user string, expense model.Expense) string {
+	if expense.LedgerID == "" {
+		if expense.UserID == user {
+			return model.RoleOwner
+		}
+		return ""
+	}
+
+	_, role, err := s.memberLedger(ctx, user, expense.LedgerID)
+	if err != nil {
+		return ""
+	}
+
+	return role
+}
+
+// Sends the expense to the stream of everyone who can see it
+func (s *Server) streamExpense(ctx context.Context, expense model.Expense) {
+	if expense.LedgerID == "" {
+		go stream.Writer(&expense)
+		return
+	}
+
+	ledger, err := s.Ledgers.FindLedgerByID(ctx, expense.LedgerID)
+	if err != nil {
+		log.Println(err)
+		go stream.Writer(&expense)
+		return
+	}
+
+	go stream.LedgerWriter(&expense, ledger.MemberIDs())
+}
+
+// Validate ledger details
+func validateLedger(ledger *model.Ledger) (string, bool) {
+	ledger.Name = strings.TrimSpace(ledger.Name)
+	if ledger.Name == "" {
+		return "Ledger name is required", false
+	}
+
+	return "Requirement passed", true
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/mail"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// Shortest time between two password reset emails to the same user
+const passwordResetInterval = time.Minute
+
+// ForgotPassword - Endpoint mailing a link to reset their password to the user with the email.
+// Succeeds whether or not anyone has the email, so it can't be used to find out who has an account.
+func (s *Server) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	if !strings.Contains(req.Email, "@") {
+		u.RespondWithError(w, http.StatusBadRequest, "Email address is required")
+		return
+	}
+
+	user, err := s.Users.FindUserByEmail(r.Context(), req.Email)
+	if err == dao.ErrNotFound {
+		log.Printf("Password reset requested for unknown user %s", req.Email)
+		u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	token, wait, err := s.replaceUserToken(r.Context(), user.Email, model.TokenPasswordReset, s.PasswordResetTTL, passwordResetInterval)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Asking again straight away sends nothing, the last email is still on its way
+	if wait > 0 {
+		log.Printf("Password reset for %s was sent less than %s ago", user.Email, passwordResetInterval)
+		u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+		return
+	}
+
+	s.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Money Tracker password",
+		Body: "Someone asked to reset the password of your Money Tracker account. If it was you, follow this link " +
+			"within " + durationText(s.PasswordResetTTL) + " to choose a new one:\n\n" +
+			s.appLink("/reset-password", token) + "\n\n" +
+			"If it wasn't you, ignore this email and your password will stay the same.\n",
+	})
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// ResetPassword - Endpoint setting a new password with the token from a password reset email.
+// Each token works once, and every device logged in to the account is logged out.
+func (s *Server) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	if req.Token == "" {
+		u.RespondWithError(w, http.StatusBadRequest, "Missing reset token")
+		return
+	}
+
+	if len(req.Password) < 6 {
+		u.RespondWithError(w, http.StatusBadRequest, "Password must be at least 6 characters")
+		return
+	}
+
+	token, err := s.UserTokens.ConsumeUserToken(r.Context(), model.HashUserToken(req.Token), model.TokenPasswordReset)
+	if err != nil {
+		log.Println(err)
+		if err == dao.ErrNotFound {
+			u.RespondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+			return
+		}
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if time.Now().After(token.Expires) {
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+
+	user, err := s.Users.FindUserByEmail(r.Context(), token.UserID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	user.Password = string(hashedPassword)
+	// Following the emailed link proves the address is theirs as much as verifying it does
+	user.Verified = true
+
+	if err := s.Users.UpdateUser(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Whoever knew the old password is logged out
+	if err := s.revokeUserTokens(r.Context(), user.Email); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/mail"
+)
+
+// mailbox - Mailer keeping what is sent for the test to read, mail goes out in the background
+type mailbox chan mail.Message
+
+func (m mailbox) Send(ctx context.Context, msg mail.Message) error {
+	m <- msg
+	return nil
+}
+
+// Waits for the next email
+func (m mailbox) next(t *testing.T) mail.Message {
+	t.Helper()
+
+	select {
+	case msg := <-m:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no email was sent")
+		return mail.Message{}
+	}
+}
+
+// Checks no email turns up
+func (m mailbox) none(t *testing.T) {
+	t.Helper()
+
+	select {
+	case msg := <-m:
+		t.Errorf("unexpected email %q to %s", msg.Subject, msg.To)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+var linkToken = regexp.MustCompile(`\?token=(\S+)`)
+
+// The token in the link of the email
+func mailedToken(t *testing.T, msg mail.Message) string {
+	t.Helper()
+
+	match := linkToken.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("no link in %q", msg.Body)
+	}
+
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestPasswordReset(t *testing.T) {
+	s, _ := newAuthServer(t, 15*time.Minute)
+	box := make(mailbox, 10)
+	s.Mailer = box
+	s.AppURL = "https://app.example.com/"
+	s.PasswordResetTTL = time.Hour
+
+	_, before := callUser(s.LoginUser, `{"email":"a@x.com","password":"secret1"}`)
+
+	// Someone without an account gets the same answer and no email
+	unknown := callAs(s.ForgotPassword, "", `{"email":"b@x.com"}`)
+	box.none(t)
+
+	known := callAs(s.ForgotPassword, "", `{"email":"a@x.com"}`)
+	if known.Code != unknown.Code || known.Body.String() != unknown.Body.String() {
+		t.Errorf("answered %d %s for a user and %d %s for nobody", known.Code, known.Body, unknown.Code, unknown.Body)
+	}
+	msg := box.next(t)
+	if msg.To != "a@x.com" {
+		t.Errorf("reset sent to %s", msg.To)
+	}
+	token := mailedToken(t, msg)
+
+	// Asking again straight away sends nothing more
+	if w := callAs(s.ForgotPassword, "", `{"email":"a@x.com"}`); w.Code != http.StatusOK {
+		t.Errorf("asking again returned %d", w.Code)
+	}
+	box.none(t)
+
+	if w := callAs(s.ResetPassword, "", `{"token":"`+token+`","password":"changed1"}`); w.Code != http.StatusOK {
+		t.Fatalf("reset returned %d: %s", w.Code, w.Body)
+	}
+
+	if code, _ := callUser(s.LoginUser, `{"email":"a@x.com","password":"secret1"}`); code != http.StatusBadRequest {
+		t.Errorf("old password returned %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := callUser(s.LoginUser, `{"email":"a@x.com","password":"changed1"}`); code != http.StatusOK {
+		t.Errorf("new password returned %d, want %d", code, http.StatusOK)
+	}
+
+	// The link works once, and whoever was logged in before has to log in again
+	if w := callAs(s.ResetPassword, "", `{"token":"`+token+`","password":"again123"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("using the link again returned %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if status := authorisedStatus(s, before.Token); status != http.StatusForbidden {
+		t.Errorf("login from before the reset got %d, want %d", status, http.StatusForbidden)
+	}
+}
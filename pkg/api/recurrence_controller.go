@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// AllRecurrences - Endpoint to retrieve all of the user's recurring expenses
+func (s *Server) AllRecurrences(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	recurrences, err := s.Recurrences.FindRecurrences(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if recurrences == nil {
+		recurrences = []model.Recurrence{}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, recurrences)
+}
+
+// GetRecurrence - Endpoint to get a specific recurring expense by id
+func (s *Server) GetRecurrence(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	recurrence, err := s.ownedRecurrence(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Recurrence ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, recurrence)
+}
+
+// CreateRecurrence - Endpoint to create a recurring expense. Occurrences from the start date up to
+// today are created by the scheduler, so a start date in the past fills in the missed expenses.
+func (s *Server) CreateRecurrence(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var recurrence model.Recurrence
+
+	if err := json.NewDecoder(r.Body).Decode(&recurrence); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	recurrence.ID = model.NewID()
+	recurrence.UserID = user
+
+	if resp, ok := s.validateRecurrence(r.Context(), &recurrence, s.userSettings(r.Context(), user)); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	// Every occurrence since the start is created, which mustn't be an unbounded backfill
+	if recurrence.Start.Before(time.Now().AddDate(-1, 0, 0)) {
+		log.Println("Recurrence start too far in the past")
+		u.RespondWithError(w, http.StatusBadRequest, "Start can be at most a year in the past")
+		return
+	}
+
+	recurrence.Next = nextOccurrence(recurrence, recurrence.Start.Time)
+
+	if err := s.Recurrences.InsertRecurrence(r.Context(), recurrence); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusCreated, recurrence)
+}
+
+// UpdateRecurrence - Endpoint to update a recurring expense. Occurrences already created are left as
+// they are, the new schedule carries on from where the old one had got to.
+func (s *Server) UpdateRecurrence(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var recurrence model.Recurrence
+
+	if err := json.NewDecoder(r.Body).Decode(&recurrence); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	existing, err := s.ownedRecurrence(r.Context(), user, recurrence.ID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Recurrence ID")
+		return
+	}
+
+	recurrence.UserID = user
+
+	if resp, ok := s.validateRecurrence(r.Context(), &recurrence, s.userSettings(r.Context(), user)); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	// An ended rule that is extended starts again from today rather than filling in the gap
+	from := existing.Next.Time
+	if from.IsZero() {
+		from = time.Now()
+	}
+	recurrence.Next = nextOccurrence(recurrence, from)
+
+	if err := s.Recurrences.UpdateRecurrence(r.Context(), recurrence); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// DeleteRecurrence - Endpoint to delete a recurring expense, the expenses it created are kept
+func (s *Server) DeleteRecurrence(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	if _, err := s.ownedRecurrence(r.Context(), user, params["id"]); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Recurrence ID")
+		return
+	}
+
+	if err := s.Recurrences.RemoveRecurrenceByID(r.Context(), params["id"]); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Recurrence ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// Finds the recurring expense, treating one owned by someone else as not found
+func (s *Server) ownedRecurrence(ctx context.Context, user string, id string) (model.Recurrence, error) {
+	if id == "" {
+		return model.Recurrence{}, dao.ErrNotFound
+	}
+
+	recurrence, err := s.Recurrences.FindRecurrenceByID(ctx, id)
+	if err != nil {
+		return model.Recurrence{}, err
+	}
+
+	if recurrence.UserID != user {
+		return model.Recurrence{}, dao.ErrNotFound
+	}
+
+	return recurrence, nil
+}
+
+// Validate recurring expense details, filling in what the client left out from the user's settings.
+// Start and Until become midnight of their day in the user's timezone.
+func (s *Server) validateRecurrence(ctx context.Context, recurrence *model.Recurrence, user model.User) (string, bool) {
+	var account model.Account
+	if recurrence.AccountID != "" {
+		var err error
+		if account, err = s.ownedAccount(ctx, user.Email, recurrence.AccountID); err != nil {
+			return "Invalid Account ID", false
+		}
+	}
+
+	recurrence.Currency = strings.ToUpper(strings.TrimSpace(recurrence.Currency))
+	if recurrence.Currency == "" {
+		recurrence.Currency = user.Currency
+		if account.ID != "" {
+			recurrence.Currency = account.Currency
+		}
+	}
+	if !model.ValidCurrency(recurrence.Currency) {
+		return "Currency must be an ISO 4217 code with two decimal places, such as GBP", false
+	}
+	if account.ID != "" && recurrence.Currency != account.Currency {
+		return "Currency must match the account's currency", false
+	}
+
+	recurrence.ResolveType()
+	if !model.ValidTransactionType(recurrence.Type) {
+		return "Type must be expense, income, saving, transfer or settlement", false
+	}
+	if recurrence.Type == model.TypeTransfer || recurrence.Type == model.TypeSettlement {
+		return "Transfers and settlements can't recur", false
+	}
+
+	tags, err := model.NormaliseTags(recurrence.Tags)
+	if err != nil {
+		return err.Error(), false
+	}
+	recurrence.Tags = tags
+
+	if recurrence.CategoryID != "" {
+		if _, err := s.ownedCategory(ctx, user.Email, recurrence.CategoryID); err != nil {
+			return "Invalid Category ID", false
+		}
+	}
+
+	if !model.ValidFrequency(recurrence.Frequency) {
+		return "Frequency must be daily, weekly, monthly or yearly", false
+	}
+
+	if recurrence.Interval == 0 {
+		recurrence.Interval = 1
+	}
+	if recurrence.Interval < 1 {
+		return "Interval must be at least 1", false
+	}
+
+	// Monthly rules need the day, yearly ones keep the day of the start date without one
+	if (recurrence.Frequency == "monthly" && recurrence.MonthDay < 1) || recurrence.MonthDay < 0 || recurrence.MonthDay > 31 {
+		return "Month day must be between 1 and 31", false
+	}
+
+	recurrence.Timezone = user.Timezone
+	loc := user.Location()
+
+	if recurrence.Start.IsZero() {
+		recurrence.Start = model.NewDate(time.Now())
+	}
+	recurrence.Start = startOfDay(recurrence.Start.Resolve(loc), loc)
+
+	if !recurrence.Until.IsZero() {
+		recurrence.Until = startOfDay(recurrence.Until.Resolve(loc), loc)
+		if recurrence.Until.Before(recurrence.Start.Time) {
+			return "Until must not be before the start date", false
+		}
+	}
+
+	return "Requirement passed", true
+}
+
+// Saves every recurring expense of the user that change modifies, used when categories or tags go away
+func (s *Server) rescopeRecurrences(ctx context.Context, user string, change func(recurrence *model.Recurrence) bool) error {
+	recurrences, err := s.Recurrences.FindRecurrences(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	for _, recurrence := range recurrences {
+		if !change(&recurrence) {
+			continue
+		}
+		if err := s.Recurrences.UpdateRecurrence(ctx, recurrence); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Midnight at the start of the date's day in loc
+func startOfDay(d model.Date, loc *time.Location) model.Date {
+	y, m, day := d.In(loc).Date()
+
+	return model.NewDate(time.Date(y, m, day, 0, 0, 0, 0, loc))
+}
+
+// The first occurrence on or after from, null when the rule has ended
+func nextOccurrence(recurrence model.Recurrence, from time.Time) model.Date {
+	next, ok := recurrence.NextOnOrAfter(from)
+	if !ok {
+		return model.Date{}
+	}
+
+	return model.NewDate(next)
+}
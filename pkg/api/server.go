@@ -0,0 +1,58 @@
+package api
+
+import (
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/auth"
+	"github.com/wilsonth122/money-tracker-api/pkg/blob"
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/mail"
+	"github.com/wilsonth122/money-tracker-api/pkg/rates"
+)
+
+// Server - Holds the storage backends used by the endpoints.
+// Built once in app.Setup so handlers never reach for globals.
+type Server struct {
+	Users       dao.UserStore
+	Expenses    dao.ExpenseStore
+	Categories  dao.CategoryStore
+	Tags        dao.TagStore
+	Budgets     dao.BudgetStore
+	Recurrences dao.RecurrenceStore
+	Goals       dao.GoalStore
+	Accounts    dao.AccountStore
+	Ledgers     dao.LedgerStore
+	Attachments dao.AttachmentStore
+	// RefreshTokens holds the refresh tokens handed out with access tokens
+	RefreshTokens dao.RefreshTokenStore
+	// UserTokens holds the single use tokens mailed to users, such as for resetting a password
+	UserTokens dao.UserTokenStore
+	// Revocations remembers access tokens revoked by logging out
+	Revocations dao.RevocationStore
+	// Keys signs access tokens and verifies them, including tokens signed with keys since rotated out
+	Keys *auth.KeyManager
+
+	// Blobs holds the content of attachments, described by Attachments
+	Blobs blob.Store
+	// MaxAttachmentSize is the largest attachment in bytes that can be uploaded
+	MaxAttachmentSize int64
+
+	// Mailer sends email to users, with links into the web app at AppURL
+	Mailer mail.Mailer
+	AppURL string
+
+	// Rates converts between currencies on request, nil when no rates are configured
+	Rates rates.Provider
+
+	// DefaultCurrency is used for users created without a currency
+	DefaultCurrency string
+
+	// AccessTokenTTL is how long access tokens last, RefreshTokenTTL how long refresh tokens do
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// PasswordResetTTL is how long password reset tokens last, VerificationTTL how long email verification tokens do
+	PasswordResetTTL time.Duration
+	VerificationTTL  time.Duration
+	// AllowUnverified lets users log in before verifying their email address
+	AllowUnverified bool
+}
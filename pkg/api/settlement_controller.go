@@ -0,0 +1,398 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/bits"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// ledgerBalances - Response of GET /api/ledgers/{id}/balances
+type ledgerBalances struct {
+	LedgerID string          `json:"ledgerID"`
+	Currency string          `json:"currency"`
+	Balances []memberBalance `json:"balances"`
+	// Settlements are the fewest payments that would bring every balance back to zero
+	Settlements []settleUp `json:"settlements"`
+	// Unconverted counts expenses in other currencies left out because no rate was available
+	Unconverted int `json:"unconverted,omitempty"`
+}
+
+// memberBalance - What one person has paid for the ledger against their share of it.
+// Settlements they made count as paid, and those made to them as their share.
+type memberBalance struct {
+	UserID string      `json:"userID"`
+	Paid   model.Money `json:"paid"`
+	Share  model.Money `json:"share"`
+	// Net is positive when the others owe them money and negative when they owe it
+	Net model.Money `json:"net"`
+}
+
+// settleUp - A payment from one person to another that settles part of what they owe
+type settleUp struct {
+	From   string      `json:"from"`
+	To     string      `json:"to"`
+	Amount model.Money `json:"amount"`
+}
+
+// settlementRequest - Payload of POST /api/ledgers/{id}/settlements
+type settlementRequest struct {
+	Title string `json:"title"`
+	// From defaults to the user recording the settlement
+	From     string      `json:"from"`
+	To       string      `json:"to"`
+	Amount   model.Money `json:"amount"`
+	Currency string      `json:"currency"`
+	Date     model.Date  `json:"date"`
+}
+
+// LedgerBalances - Endpoint working out who owes whom in a shared ledger, with the payments that
+// would settle up. Whoever paid for an expense is owed each split line by the member it names,
+// and lines naming nobody are shared equally by every member. Income is shared the same way.
+// Amounts are in ?currency=, or the user's currency.
+func (s *Server) LedgerBalances(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	ledger, _, err := s.memberLedger(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Ledger ID")
+		return
+	}
+
+	currency, ok := requestedCurrency(r)
+	if !ok {
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid currency code")
+		return
+	}
+	if currency == "" {
+		currency = s.userSettings(r.Context(), user).Currency
+	}
+
+	expenses, _, err := s.Expenses.FindExpenses(r.Context(), user, dao.ExpenseQuery{
+		LedgerID: ledger.ID,
+		Types:    []string{model.TypeExpense, model.TypeIncome, model.TypeSettlement},
+	})
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	members := ledger.MemberIDs()
+	sort.Strings(members)
+
+	resp := ledgerBalances{LedgerID: ledger.ID, Currency: currency}
+	balances := make(map[string]*memberBalance)
+	balance := func(id string) *memberBalance {
+		if balances[id] == nil {
+			balances[id] = &memberBalance{UserID: id}
+		}
+		return balances[id]
+	}
+	for _, member := range members {
+		balance(member)
+	}
+
+	for _, expense := range expenses {
+		// The paying side of a settlement already says who paid whom
+		if expense.Incoming {
+			continue
+		}
+
+		shares, ok := s.expenseShares(r.Context(), expense, currency, members)
+		if !ok {
+			resp.Unconverted++
+			continue
+		}
+
+		// Income received by one member is owed to the others
+		sign := model.Money(1)
+		if expense.Type == model.TypeIncome {
+			sign = -1
+		}
+
+		for id, share := range shares {
+			balance(expense.Payer()).Paid += sign * share
+			balance(id).Share += sign * share
+		}
+	}
+
+	for _, b := range balances {
+		b.Net = b.Paid - b.Share
+		resp.Balances = append(resp.Balances, *b)
+	}
+	sort.Slice(resp.Balances, func(i, j int) bool { return resp.Balances[i].UserID < resp.Balances[j].UserID })
+
+	resp.Settlements = settleBalances(resp.Balances)
+
+	u.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// CreateSettlement - Endpoint recording that one ledger member paid another back. Creates a settlement
+// entry for each of them, paired like the two entries of a transfer so deleting either deletes both.
+func (s *Server) CreateSettlement(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	var req settlementRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	ledger, role, err := s.memberLedger(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Ledger ID")
+		return
+	}
+
+	if !model.CanEdit(role) {
+		u.RespondWithError(w, http.StatusForbidden, "Viewers can't change the ledger's expenses")
+		return
+	}
+
+	req.From = strings.TrimSpace(req.From)
+	if req.From == "" {
+		req.From = user
+	}
+	req.To = strings.TrimSpace(req.To)
+
+	if ledger.Role(req.From) == "" || ledger.Role(req.To) == "" {
+		u.RespondWithError(w, http.StatusBadRequest, "A settlement must be between members of the ledger")
+		return
+	}
+
+	if req.From == req.To {
+		u.RespondWithError(w, http.StatusBadRequest, "A settlement needs two different members")
+		return
+	}
+
+	if req.Amount <= 0 {
+		u.RespondWithError(w, http.StatusBadRequest, "Settlement amount must be more than zero")
+		return
+	}
+
+	settings := s.userSettings(r.Context(), user)
+
+	req.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+	if req.Currency == "" {
+		req.Currency = settings.Currency
+	}
+	if !model.ValidCurrency(req.Currency) {
+		u.RespondWithError(w, http.StatusBadRequest, "Currency must be an ISO 4217 code with two decimal places, such as GBP")
+		return
+	}
+
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		req.Title = "Settle up with " + req.To
+	}
+
+	if req.Date.IsZero() {
+		req.Date = model.NewDate(time.Now())
+	}
+	req.Date = req.Date.Resolve(settings.Location())
+
+	// The paying entry names who was paid on its only line, so balances only need that side
+	t := transfer{ID: model.NewID()}
+	t.Out = model.Expense{
+		ID:         model.NewID(),
+		UserID:     req.From,
+		LedgerID:   ledger.ID,
+		PaidBy:     req.From,
+		Title:      req.Title,
+		Price:      req.Amount,
+		Currency:   req.Currency,
+		Date:       req.Date,
+		Type:       model.TypeSettlement,
+		TransferID: t.ID,
+		Splits:     []model.Split{{Amount: req.Amount, Person: req.To}},
+	}
+	t.In = t.Out
+	t.In.ID = model.NewID()
+	t.In.UserID = req.To
+	t.In.Incoming = true
+	t.In.Splits = nil
+
+	if err := s.Expenses.InsertTransfer(r.Context(), t.Out, t.In); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send both entries to expense stream
+	s.streamExpense(r.Context(), t.Out)
+	s.streamExpense(r.Context(), t.In)
+
+	u.RespondWithJSON(w, http.StatusCreated, t)
+}
+
+// What each person's share of the expense comes to in the currency, false when it can't be converted
+func (s *Server) expenseShares(ctx context.Context, expense model.Expense, currency string, members []string) (map[string]model.Money, bool) {
+	shares := make(map[string]model.Money)
+
+	for _, line := range expense.Lines() {
+		amount, ok := s.amountIn(ctx, line.Amount, expense.Currency, currency)
+		if !ok {
+			return nil, false
+		}
+
+		if line.Person != "" {
+			shares[line.Person] += amount
+			continue
+		}
+
+		for i, part := range splitEqually(amount, len(members)) {
+			shares[members[i]] += part
+		}
+	}
+
+	return shares, true
+}
+
+// Divides the amount into n parts that differ by at most one minor unit, the larger parts first
+func splitEqually(amount model.Money, n int) []model.Money {
+	if n == 0 {
+		return nil
+	}
+
+	parts := make([]model.Money, n)
+	each, rest := amount/model.Money(n), amount%model.Money(n)
+	for i := range parts {
+		parts[i] = each
+		if model.Money(i) < rest {
+			parts[i]++
+		}
+	}
+
+	return parts
+}
+
+// Most people with a balance for whom the fewest payments are searched for, every subset of them is
+// tried so beyond that the payments are only worked out greedily
+const maxExactSettlement = 16
+
+// Suggests the fewest payments that bring every balance to zero. Every group of people whose balances
+// add up to zero can be settled among themselves with one payment fewer than there are of them, so the
+// fewest payments come from splitting everyone into as many such groups as possible. Ledgers with more
+// than maxExactSettlement people owing or owed money are settled greedily, in at most one payment
+// fewer than there are of them.
+func settleBalances(balances []memberBalance) []settleUp {
+	var owing []memberBalance
+	for _, b := range balances {
+		if b.Net != 0 {
+			owing = append(owing, b)
+		}
+	}
+
+	if len(owing) > maxExactSettlement {
+		return settleGreedily(owing)
+	}
+
+	settlements := []settleUp{}
+	for _, group := range zeroSumGroups(owing) {
+		settlements = append(settlements, settleGreedily(group)...)
+	}
+
+	return settlements
+}
+
+// Splits the balances, which add up to zero, into as many groups adding up to zero as possible.
+// best[mask] is the most groups the members in the bit mask can be split into, found by taking
+// members away one at a time and counting every time what is left adds up to zero.
+func zeroSumGroups(balances []memberBalance) [][]memberBalance {
+	n := len(balances)
+	full := 1<<uint(n) - 1
+
+	sum := make([]model.Money, full+1)
+	best := make([]int, full+1)
+	removed := make([]int, full+1)
+	for mask := 1; mask <= full; mask++ {
+		lowest := bits.TrailingZeros(uint(mask))
+		sum[mask] = sum[mask&^(1<<uint(lowest))] + balances[lowest].Net
+
+		best[mask] = -1
+		for i := 0; i < n; i++ {
+			if mask&(1<<uint(i)) != 0 && best[mask&^(1<<uint(i))] > best[mask] {
+				best[mask], removed[mask] = best[mask&^(1<<uint(i))], i
+			}
+		}
+		if sum[mask] == 0 {
+			best[mask]++
+		}
+	}
+
+	// Following the members taken away, a group ends each time what is left adds up to zero
+	var groups [][]memberBalance
+	var group []memberBalance
+	for mask := full; mask != 0; {
+		i := removed[mask]
+		group = append(group, balances[i])
+		mask &^= 1 << uint(i)
+
+		if sum[mask] == 0 {
+			groups = append(groups, group)
+			group = nil
+		}
+	}
+
+	return groups
+}
+
+// Pays as much as possible from the largest debtor to the largest creditor until everyone is even,
+// which takes at most one payment fewer than there are people with a balance
+func settleGreedily(balances []memberBalance) []settleUp {
+	var creditors, debtors []memberBalance
+	for _, b := range balances {
+		switch {
+		case b.Net > 0:
+			creditors = append(creditors, b)
+		case b.Net < 0:
+			b.Net = -b.Net
+			debtors = append(debtors, b)
+		}
+	}
+
+	largestFirst := func(list []memberBalance) {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Net > list[j].Net })
+	}
+	largestFirst(creditors)
+	largestFirst(debtors)
+
+	settlements := []settleUp{}
+	for i, j := 0, 0; i < len(creditors) && j < len(debtors); {
+		amount := creditors[i].Net
+		if debtors[j].Net < amount {
+			amount = debtors[j].Net
+		}
+
+		settlements = append(settlements, settleUp{From: debtors[j].UserID, To: creditors[i].UserID, Amount: amount})
+
+		creditors[i].Net -= amount
+		debtors[j].Net -= amount
+		if creditors[i].Net == 0 {
+			i++
+		}
+		if debtors[j].Net == 0 {
+			j++
+		}
+	}
+
+	return settlements
+}
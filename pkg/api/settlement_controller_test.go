@@ -0,0 +1,91 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+func TestSplitEqually(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount model.Money
+		n      int
+		want   []model.Money
+	}{
+		{name: "nobody", amount: 1000, n: 0, want: nil},
+		{name: "even", amount: 900, n: 3, want: []model.Money{300, 300, 300}},
+		{name: "remainder goes to the first", amount: 1000, n: 3, want: []model.Money{334, 333, 333}},
+		{name: "less than a penny each", amount: 2, n: 3, want: []model.Money{1, 1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitEqually(tt.amount, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitEqually(%d, %d) = %v, want %v", tt.amount, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettleBalances(t *testing.T) {
+	tests := []struct {
+		name     string
+		balances []memberBalance
+		want     []settleUp
+	}{
+		{
+			name:     "settled",
+			balances: []memberBalance{{UserID: "a", Net: 0}, {UserID: "b", Net: 0}},
+			want:     []settleUp{},
+		},
+		{
+			name:     "one owes another",
+			balances: []memberBalance{{UserID: "a", Net: 500}, {UserID: "b", Net: -500}},
+			want:     []settleUp{{From: "b", To: "a", Amount: 500}},
+		},
+		{
+			name:     "largest debtor pays the largest creditor first",
+			balances: []memberBalance{{UserID: "a", Net: 700}, {UserID: "b", Net: 300}, {UserID: "c", Net: -200}, {UserID: "d", Net: -800}},
+			want: []settleUp{
+				{From: "d", To: "a", Amount: 700},
+				{From: "d", To: "b", Amount: 100},
+				{From: "c", To: "b", Amount: 200},
+			},
+		},
+		{
+			name:     "people who only owe each other settle among themselves",
+			balances: []memberBalance{{UserID: "a", Net: 100}, {UserID: "b", Net: 300}, {UserID: "c", Net: 400}, {UserID: "d", Net: -300}, {UserID: "e", Net: -500}},
+			want: []settleUp{
+				{From: "e", To: "c", Amount: 400},
+				{From: "e", To: "a", Amount: 100},
+				{From: "d", To: "b", Amount: 300},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := settleBalances(tt.balances)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("settleBalances() = %v, want %v", got, tt.want)
+			}
+
+			// Paying the suggestions must leave everyone even
+			net := map[string]model.Money{}
+			for _, b := range tt.balances {
+				net[b.UserID] = b.Net
+			}
+			for _, s := range got {
+				net[s.From] += s.Amount
+				net[s.To] -= s.Amount
+			}
+			for user, left := range net {
+				if left != 0 {
+					t.Errorf("%s is left with %d", user, left)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// AllTags - Endpoint to list the user's tags with the number of expenses using each
+func (s *Server) AllTags(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+
+	counts, err := s.Tags.TagCounts(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if counts == nil {
+		counts = []model.TagCount{}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, counts)
+}
+
+// RenameTag - Endpoint to rename a tag across all of the user's expenses.
+// Renaming onto a tag that is already in use is refused, merge the tags instead.
+func (s *Server) RenameTag(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	var rename struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&rename); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	from, err := model.NormaliseTag(params["tag"])
+	if err != nil {
+		u.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := model.NormaliseTag(rename.Name)
+	if err != nil {
+		u.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	counts, err := s.tagCounts(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if counts[from] == 0 {
+		u.RespondWithError(w, http.StatusBadRequest, "Unknown tag")
+		return
+	}
+	if from != to && counts[to] > 0 {
+		u.RespondWithError(w, http.StatusConflict, "Tag is already in use, merge the tags instead")
+		return
+	}
+
+	s.replaceTag(w, r, user, from, to)
+}
+
+// MergeTags - Endpoint to fold one tag into another, expenses carrying either end up with just the second
+func (s *Server) MergeTags(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var merge struct {
+		From string `json:"from"`
+		Into string `json:"into"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&merge); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	from, err := model.NormaliseTag(merge.From)
+	if err != nil {
+		u.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	into, err := model.NormaliseTag(merge.Into)
+	if err != nil {
+		u.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if from == into {
+		u.RespondWithError(w, http.StatusBadRequest, "Can't merge a tag into itself")
+		return
+	}
+
+	counts, err := s.tagCounts(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if counts[from] == 0 || counts[into] == 0 {
+		u.RespondWithError(w, http.StatusBadRequest, "Unknown tag")
+		return
+	}
+
+	s.replaceTag(w, r, user, from, into)
+}
+
+// Rewrites the tag on expenses, budgets and recurring expenses, reporting how many expenses changed
+func (s *Server) replaceTag(w http.ResponseWriter, r *http.Request, user string, from string, to string) {
+	changed, err := s.Tags.ReplaceTag(r.Context(), user, from, to)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = s.rescopeBudgets(r.Context(), user, func(budget *model.Budget) bool {
+		if budget.Tag != from {
+			return false
+		}
+		budget.Tag = to
+		return true
+	})
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = s.rescopeRecurrences(r.Context(), user, func(recurrence *model.Recurrence) bool {
+		for i, tag := range recurrence.Tags {
+			if tag == from {
+				tags := append([]string(nil), recurrence.Tags...)
+				tags[i] = to
+				recurrence.Tags, _ = model.NormaliseTags(tags)
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"result": "success", "updated": changed})
+}
+
+// The user's tag usage keyed by tag
+func (s *Server) tagCounts(ctx context.Context, user string) (map[string]int, error) {
+	counts, err := s.Tags.TagCounts(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	byTag := make(map[string]int, len(counts))
+	for _, count := range counts {
+		byTag[count.Tag] = count.Count
+	}
+
+	return byTag, nil
+}
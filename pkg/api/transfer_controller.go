@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	"github.com/wilsonth122/money-tracker-api/pkg/stream"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// transferRequest - Payload of POST /api/transfers
+type transferRequest struct {
+	Title         string      `json:"title"`
+	FromAccountID string      `json:"fromAccountID"`
+	ToAccountID   string      `json:"toAccountID"`
+	Amount        model.Money `json:"amount"`
+	// ToAmount is what arrives when the accounts' currencies differ, converted at the configured rates when left out
+	ToAmount model.Money `json:"toAmount"`
+	Date     model.Date  `json:"date"`
+}
+
+// transfer - The two entries recording money moved between accounts
+type transfer struct {
+	ID  string        `json:"id"`
+	Out model.Expense `json:"out"`
+	In  model.Expense `json:"in"`
+}
+
+// GetTransfer - Endpoint to get both entries of a transfer
+func (s *Server) GetTransfer(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	t, err := s.ownedTransfer(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Transfer ID")
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, t)
+}
+
+// CreateTransfer - Endpoint to move money from one of the user's accounts to another
+func (s *Server) CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	var req transferRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	from, err := s.ownedAccount(r.Context(), user, req.FromAccountID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid from Account ID")
+		return
+	}
+
+	to, err := s.ownedAccount(r.Context(), user, req.ToAccountID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid to Account ID")
+		return
+	}
+
+	if from.ID == to.ID {
+		u.RespondWithError(w, http.StatusBadRequest, "A transfer needs two different accounts")
+		return
+	}
+
+	if req.Amount <= 0 || req.ToAmount < 0 {
+		u.RespondWithError(w, http.StatusBadRequest, "Transfer amount must be more than zero")
+		return
+	}
+
+	if from.Currency == to.Currency {
+		req.ToAmount = req.Amount
+	} else if req.ToAmount == 0 {
+		conversion, err := s.convert(r.Context(), req.Amount, from.Currency, to.Currency)
+		if err != nil {
+			respondWithConversionError(w, err)
+			return
+		}
+		req.ToAmount = conversion.Price
+	}
+
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		req.Title = "Transfer to " + to.Name
+	}
+
+	if req.Date.IsZero() {
+		req.Date = model.NewDate(time.Now())
+	}
+	req.Date = req.Date.Resolve(s.userSettings(r.Context(), user).Location())
+
+	t := transfer{ID: model.NewID()}
+	t.Out = model.Expense{
+		ID:         model.NewID(),
+		UserID:     user,
+		Title:      req.Title,
+		Price:      req.Amount,
+		Currency:   from.Currency,
+		Date:       req.Date,
+		Type:       model.TypeTransfer,
+		AccountID:  from.ID,
+		TransferID: t.ID,
+	}
+	t.In = t.Out
+	t.In.ID = model.NewID()
+	t.In.Price = req.ToAmount
+	t.In.Currency = to.Currency
+	t.In.AccountID = to.ID
+	t.In.Incoming = true
+
+	if err := s.Expenses.InsertTransfer(r.Context(), t.Out, t.In); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Send both entries to expense stream
+	go stream.Writer(&t.Out)
+	go stream.Writer(&t.In)
+
+	u.RespondWithJSON(w, http.StatusCreated, t)
+}
+
+// DeleteTransfer - Endpoint to delete both entries of a transfer
+func (s *Server) DeleteTransfer(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	params := mux.Vars(r)
+
+	t, err := s.ownedTransfer(r.Context(), user, params["id"])
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Transfer ID")
+		return
+	}
+
+	attachments := s.expenseAttachments(r.Context(), []model.Expense{t.Out, t.In})
+
+	if err := s.Expenses.RemoveTransfer(r.Context(), t.ID); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid Transfer ID")
+		return
+	}
+
+	s.removeAttachments(r.Context(), []model.Expense{t.Out, t.In}, attachments)
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// Finds both entries of the user's transfer
+func (s *Server) ownedTransfer(ctx context.Context, user string, id string) (transfer, error) {
+	if id == "" {
+		return transfer{}, dao.ErrNotFound
+	}
+
+	entries, _, err := s.Expenses.FindExpenses(ctx, user, dao.ExpenseQuery{TransferID: id})
+	if err != nil {
+		return transfer{}, err
+	}
+
+	t := transfer{ID: id}
+	for _, entry := range entries {
+		if entry.Incoming {
+			t.In = entry
+		} else {
+			t.Out = entry
+		}
+	}
+
+	if t.In.ID == "" || t.Out.ID == "" {
+		return transfer{}, dao.ErrNotFound
+	}
+
+	return t, nil
+}
+
+// Both entries of the transfer or settlement the expense belongs to, or only the expense when the other
+// can't be found. A settlement's entries belong to different members, so they are looked up in its ledger.
+func (s *Server) transferEntries(ctx context.Context, user string, expense model.Expense) []model.Expense {
+	entries, _, err := s.Expenses.FindExpenses(ctx, user, dao.ExpenseQuery{TransferID: expense.TransferID, LedgerID: expense.LedgerID})
+	if err != nil || len(entries) == 0 {
+		return []model.Expense{expense}
+	}
+
+	return entries
+}
@@ -1,124 +1,525 @@
-package api
-
-import (
-	"encoding/json"
-	"log"
-	"net/http"
-	"strings"
-
-	"golang.org/x/crypto/bcrypt"
-
-	"github.com/wilsonth122/money-tracker-api/pkg/dao"
-	"github.com/wilsonth122/money-tracker-api/pkg/model"
-	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
-)
-
-// CreateUser - Endpoint ofr creating a user
-func CreateUser(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	var user model.User
-
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		return
-	}
-
-	if resp, ok := validate(&user); !ok {
-		log.Println(resp)
-		u.RespondWithError(w, http.StatusBadRequest, resp)
-		return
-	}
-
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	user.Password = string(hashedPassword)
-
-	if err := dao.DBConn.InsertUser(user); err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	user.Token = model.GenerateToken(user.Email)
-
-	// Delete password before response
-	user.Password = ""
-
-	u.RespondWithJSON(w, http.StatusOK, user)
-}
-
-// LoginUser - Endpoint for logging a user in and returning a signed token
-func LoginUser(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	var unauthUser model.User
-
-	if err := json.NewDecoder(r.Body).Decode(&unauthUser); err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		return
-	}
-
-	user, err := dao.DBConn.FindUserByEmail(unauthUser.Email)
-	if err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusBadRequest, "Invalid login credentials. Please try again")
-		return
-	}
-
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(unauthUser.Password))
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusBadRequest, "Invalid login credentials. Please try again")
-		return
-	}
-
-	user.Token = model.GenerateToken(user.Email)
-
-	// Delete password before response
-	user.Password = ""
-
-	u.RespondWithJSON(w, http.StatusOK, user)
-}
-
-// DeleteUser - Endpoint for deleting a user based on auth token
-func DeleteUser(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	user := r.Context().Value("user").(string)
-
-	if err := dao.DBConn.RemoveUserByEmail(user); err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
-		return
-	}
-
-	if err := dao.DBConn.RemoveUserExpenses(user); err != nil {
-		log.Println(err)
-		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
-		return
-	}
-
-	u.RespondWithJSON(w, http.StatusOK, "User deleted")
-}
-
-// Validate User details
-func validate(user *model.User) (string, bool) {
-
-	if !strings.Contains(user.Email, "@") {
-		return "Email address is required", false
-	}
-
-	if len(user.Password) < 6 {
-		return "Password is required", false
-	}
-
-	// Check for errors and duplicate emails
-	exists, err := dao.DBConn.UserExists(user.Email)
-	if err != nil {
-		return err.Error(), false
-	}
-	if exists {
-		return "Email address already in use by another user", false
-	}
-
-	return "Requirement passed", true
-}
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/mail"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// Longest an email is given to send
+const mailTimeout = 30 * time.Second
+
+// CreateUser - Endpoint ofr creating a user
+func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var user model.User
+
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	user.Currency = strings.ToUpper(strings.TrimSpace(user.Currency))
+	if user.Currency == "" {
+		user.Currency = s.DefaultCurrency
+	}
+	user.Verified = false
+
+	if resp, ok := validate(&user); !ok {
+		log.Println(resp)
+		u.RespondWithError(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	user.Password = string(hashedPassword)
+
+	if err := s.Users.InsertUser(r.Context(), user); err != nil {
+		log.Println(err)
+		if err == dao.ErrEmailInUse {
+			u.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.seedCategories(r.Context(), user.Email)
+
+	// The account is made either way, a lost email can be sent again
+	if _, err := s.sendVerification(r.Context(), user); err != nil {
+		log.Println(err)
+	}
+
+	// Until they verify, users are only logged in when that is allowed
+	if s.AllowUnverified {
+		if err := s.issueTokens(r.Context(), &user, ""); err != nil {
+			log.Println(err)
+			u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// Delete password before response
+	user.Password = ""
+
+	u.RespondWithJSON(w, http.StatusOK, user)
+}
+
+// LoginUser - Endpoint for logging a user in and returning a signed token
+func (s *Server) LoginUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var unauthUser model.User
+
+	if err := json.NewDecoder(r.Body).Decode(&unauthUser); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	user, err := s.Users.FindUserByEmail(r.Context(), unauthUser.Email)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid login credentials. Please try again")
+		return
+	}
+
+	// Any failure counts, a stored password that isn't a bcrypt hash mustn't let everyone in
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(unauthUser.Password))
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid login credentials. Please try again")
+		return
+	}
+
+	if !user.Verified && !s.AllowUnverified {
+		u.RespondWithError(w, http.StatusForbidden, unverifiedMessage)
+		return
+	}
+
+	if err := s.issueTokens(r.Context(), &user, ""); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Delete password before response
+	user.Password = ""
+
+	u.RespondWithJSON(w, http.StatusOK, user)
+}
+
+// RefreshToken - Endpoint exchanging a refresh token for a new access token and refresh token.
+// Each refresh token can only be exchanged once. Presenting one again means it may have been
+// stolen, so every token descending from the same login is revoked.
+func (s *Server) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	if req.RefreshToken == "" {
+		u.RespondWithError(w, http.StatusBadRequest, "Missing refresh token")
+		return
+	}
+
+	token, err := s.RefreshTokens.FindRefreshToken(r.Context(), model.HashRefreshToken(req.RefreshToken))
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	now := time.Now()
+	if now.After(token.Expires) {
+		u.RespondWithError(w, http.StatusUnauthorized, "Refresh token has expired, please log in again")
+		return
+	}
+
+	if err := s.RefreshTokens.UseRefreshToken(r.Context(), token.ID, now); err != nil {
+		log.Println(err)
+		if err == dao.ErrTokenUsed || err == dao.ErrNotFound {
+			log.Printf("Revoking the tokens of %s from login %s", token.UserID, token.FamilyID)
+			if err := s.revokeFamily(r.Context(), token.FamilyID); err != nil {
+				log.Println(err)
+			}
+			u.RespondWithError(w, http.StatusUnauthorized, "Refresh token has already been used, please log in again")
+			return
+		}
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user, err := s.Users.FindUserByEmail(r.Context(), token.UserID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	if !user.Verified && !s.AllowUnverified {
+		u.RespondWithError(w, http.StatusForbidden, unverifiedMessage)
+		return
+	}
+
+	if err := s.issueTokens(r.Context(), &user, token.FamilyID); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Delete password before response
+	user.Password = ""
+
+	u.RespondWithJSON(w, http.StatusOK, user)
+}
+
+// LogoutUser - Endpoint revoking the token the request was made with, along with every access and
+// refresh token descending from the same login
+func (s *Server) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(model.Token)
+
+	if err := s.Revocations.RevokeToken(r.Context(), token.Id, time.Unix(token.ExpiresAt, 0)); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if token.FamilyID != "" {
+		if err := s.revokeFamily(r.Context(), token.FamilyID); err != nil {
+			log.Println(err)
+			u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// LogoutAllDevices - Endpoint revoking every access and refresh token the user holds, on any device
+func (s *Server) LogoutAllDevices(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(string)
+	token := r.Context().Value("token").(model.Token)
+
+	if err := s.Revocations.RevokeToken(r.Context(), token.Id, time.Unix(token.ExpiresAt, 0)); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.revokeUserTokens(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// JWKS - Endpoint publishing the public keys access tokens can be verified with, so other services
+// can check them without sharing a secret. Clients should refetch it on seeing an unknown kid.
+func (s *Server) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	u.RespondWithJSON(w, http.StatusOK, s.Keys.JWKS())
+}
+
+// DeleteUser - Endpoint for deleting a user based on auth token
+func (s *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	user := r.Context().Value("user").(string)
+
+	// Found first as some backends remove attachments along with the user's expenses
+	attachments, err := s.Attachments.FindUserAttachments(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Revoked first as some backends remove refresh tokens along with the user
+	if err := s.revokeUserTokens(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.Users.RemoveUserByEmail(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
+		return
+	}
+
+	if err := s.UserTokens.RemoveUserTokens(r.Context(), user, ""); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
+		return
+	}
+
+	if err := s.Expenses.RemoveUserExpenses(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
+		return
+	}
+
+	if err := s.Categories.RemoveUserCategories(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
+		return
+	}
+
+	if err := s.Budgets.RemoveUserBudgets(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
+		return
+	}
+
+	if err := s.Recurrences.RemoveUserRecurrences(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
+		return
+	}
+
+	if err := s.Goals.RemoveUserGoals(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
+		return
+	}
+
+	if err := s.Accounts.RemoveUserAccounts(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
+		return
+	}
+
+	if err := s.Ledgers.RemoveUserLedgers(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
+		return
+	}
+
+	if err := s.Attachments.RemoveUserAttachments(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has already been deleted")
+		return
+	}
+	s.deleteAttachmentContent(r.Context(), attachments)
+
+	u.RespondWithJSON(w, http.StatusOK, "User deleted")
+}
+
+// UpdateSettings - Endpoint for changing the preferences of the authenticated user
+func (s *Server) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	email := r.Context().Value("user").(string)
+
+	// Pointers tell a setting that was left out apart from one being cleared
+	var settings struct {
+		Currency *string `json:"currency"`
+		Timezone *string `json:"timezone"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	user, err := s.Users.FindUserByEmail(r.Context(), email)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "User doesn't exist or has been deleted")
+		return
+	}
+
+	if settings.Currency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*settings.Currency))
+		if !model.ValidCurrency(currency) {
+			u.RespondWithError(w, http.StatusBadRequest, "Currency must be an ISO 4217 code with two decimal places, such as GBP")
+			return
+		}
+		user.Currency = currency
+	}
+
+	if settings.Timezone != nil {
+		if _, err := time.LoadLocation(*settings.Timezone); err != nil {
+			u.RespondWithError(w, http.StatusBadRequest, "Timezone must be an IANA name such as Europe/London")
+			return
+		}
+		user.Timezone = *settings.Timezone
+	}
+
+	if err := s.Users.UpdateUser(r.Context(), user); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Delete password before response
+	user.Password = ""
+
+	u.RespondWithJSON(w, http.StatusOK, user)
+}
+
+// Settings of the user, with server defaults filled in for anything unset or an unknown user
+func (s *Server) userSettings(ctx context.Context, email string) model.User {
+	user, err := s.Users.FindUserByEmail(ctx, email)
+	if err != nil {
+		user = model.User{Email: email}
+	}
+
+	if user.Currency == "" {
+		user.Currency = s.DefaultCurrency
+	}
+
+	return user
+}
+
+// Validate User details
+func validate(user *model.User) (string, bool) {
+
+	if !strings.Contains(user.Email, "@") {
+		return "Email address is required", false
+	}
+
+	if len(user.Password) < 6 {
+		return "Password is required", false
+	}
+
+	if !model.ValidCurrency(user.Currency) {
+		return "Currency must be an ISO 4217 code with two decimal places, such as GBP", false
+	}
+
+	if _, err := time.LoadLocation(user.Timezone); err != nil {
+		return "Timezone must be an IANA name such as Europe/London", false
+	}
+
+	return "Requirement passed", true
+}
+
+// Gives the user a new access token and a refresh token in the family, starting a new family when empty
+func (s *Server) issueTokens(ctx context.Context, user *model.User, family string) error {
+	refresh, token := model.NewRefreshToken(user.Email, family, s.RefreshTokenTTL)
+	if err := s.RefreshTokens.InsertRefreshToken(ctx, refresh); err != nil {
+		return err
+	}
+
+	access, err := s.Keys.GenerateToken(user.Email, refresh.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	user.Token = access
+	user.RefreshToken = token
+	user.ExpiresIn = int64(s.AccessTokenTTL / time.Second)
+
+	return nil
+}
+
+// Revokes the login family's refresh tokens, and its access tokens until the last of them would have expired
+func (s *Server) revokeFamily(ctx context.Context, family string) error {
+	if err := s.Revocations.RevokeToken(ctx, family, time.Now().Add(s.AccessTokenTTL)); err != nil {
+		return err
+	}
+
+	return s.RefreshTokens.RemoveTokenFamily(ctx, family)
+}
+
+// Revokes every login family the user holds refresh tokens for
+func (s *Server) revokeUserTokens(ctx context.Context, user string) error {
+	families, err := s.RefreshTokens.FindTokenFamilies(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	for _, family := range families {
+		if err := s.Revocations.RevokeToken(ctx, family, time.Now().Add(s.AccessTokenTTL)); err != nil {
+			return err
+		}
+	}
+
+	return s.RefreshTokens.RemoveUserRefreshTokens(ctx, user)
+}
+
+// Stores a new token for the purpose in place of any the user was sent before, so only the link in the
+// newest email works, and returns it to be mailed. When the last one was made less than interval ago
+// nothing changes, and how long is left until another can be made is returned instead.
+func (s *Server) replaceUserToken(ctx context.Context, user string, purpose string, ttl time.Duration, interval time.Duration) (string, time.Duration, error) {
+	tokens, err := s.UserTokens.FindUserTokens(ctx, user, purpose)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if len(tokens) > 0 {
+		if wait := interval - time.Since(tokens[len(tokens)-1].Created); wait > 0 {
+			return "", wait, nil
+		}
+	}
+
+	if err := s.UserTokens.RemoveUserTokens(ctx, user, purpose); err != nil {
+		return "", 0, err
+	}
+
+	record, token := model.NewUserToken(user, purpose, ttl)
+	if err := s.UserTokens.InsertUserToken(ctx, record); err != nil {
+		return "", 0, err
+	}
+
+	return token, 0, nil
+}
+
+// Sends the email in the background so the response doesn't wait on, or reveal anything through, the mail server
+func (s *Server) sendMail(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := s.Mailer.Send(ctx, msg); err != nil {
+			log.Printf("Mail to %s: %v", msg.To, err)
+		}
+	}()
+}
+
+// Link to the page of the web app at path, carrying the token
+func (s *Server) appLink(path string, token string) string {
+	return strings.TrimSuffix(s.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// Duration in words for emails, such as "1 hour" or "30 minutes"
+func durationText(d time.Duration) string {
+	unit, name := time.Duration(0), ""
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		unit, name = time.Hour, "hour"
+	case d >= time.Minute && d%time.Minute == 0:
+		unit, name = time.Minute, "minute"
+	default:
+		return d.String()
+	}
+
+	n := int64(d / unit)
+	if n != 1 {
+		name += "s"
+	}
+
+	return strconv.FormatInt(n, 10) + " " + name
+}
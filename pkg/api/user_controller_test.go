@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/auth"
+	"github.com/wilsonth122/money-tracker-api/pkg/config"
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// A memory server signing tokens that last accessTTL, with a verified user a@x.com whose password is secret1
+func newAuthServer(t *testing.T, accessTTL time.Duration) (*Server, *dao.MemoryStore) {
+	t.Helper()
+
+	password, err := bcrypt.GenerateFromPassword([]byte("secret1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, store := newMemoryServer(t, model.User{Email: "a@x.com", Password: string(password), Currency: "GBP", Verified: true})
+
+	s.Keys, err = auth.NewKeyManager(config.AuthConfig{
+		TokenPassword:  "secret",
+		TokenIssuer:    "money-tracker-api",
+		TokenAudience:  "money-tracker",
+		AccessTokenTTL: accessTTL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AccessTokenTTL = accessTTL
+	s.RefreshTokenTTL = time.Hour
+
+	return s, store
+}
+
+// Calls the unauthenticated handler, returning the status and the user sent back
+func callUser(handler http.HandlerFunc, body string) (int, model.User) {
+	w := callAs(handler, "", body)
+
+	var user model.User
+	json.NewDecoder(w.Body).Decode(&user)
+
+	return w.Code, user
+}
+
+// Status of a request to an endpoint needing authentication, made with the access token
+func authorisedStatus(s *Server, access string) int {
+	return callAuthorised(s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }), access)
+}
+
+// Status of the handler called through the authentication middleware with the access token
+func callAuthorised(s *Server, handler http.HandlerFunc, access string) int {
+	r := httptest.NewRequest(http.MethodPost, "/api/anything", nil)
+	r.Header.Set("Authorization", "Bearer "+access)
+	w := httptest.NewRecorder()
+	auth.JwtAuthentication(s.Keys, s.Revocations)(handler).ServeHTTP(w, r)
+
+	return w.Code
+}
+
+func TestRefreshTokenRotates(t *testing.T) {
+	s, _ := newAuthServer(t, 15*time.Minute)
+
+	code, login := callUser(s.LoginUser, `{"email":"a@x.com","password":"secret1"}`)
+	if code != http.StatusOK {
+		t.Fatalf("login returned %d", code)
+	}
+
+	code, refreshed := callUser(s.RefreshToken, `{"refreshToken":"`+login.RefreshToken+`"}`)
+	if code != http.StatusOK {
+		t.Fatalf("refresh returned %d", code)
+	}
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == login.RefreshToken || refreshed.Token == login.Token {
+		t.Errorf("refresh didn't hand out new tokens")
+	}
+	if refreshed.ExpiresIn != int64(15*time.Minute/time.Second) {
+		t.Errorf("expiresIn = %d, want %d", refreshed.ExpiresIn, int64(15*time.Minute/time.Second))
+	}
+	if status := authorisedStatus(s, refreshed.Token); status != http.StatusOK {
+		t.Errorf("new access token got %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestRefreshTokenReuseRevokesLogin(t *testing.T) {
+	s, _ := newAuthServer(t, 15*time.Minute)
+
+	_, login := callUser(s.LoginUser, `{"email":"a@x.com","password":"secret1"}`)
+	_, other := callUser(s.LoginUser, `{"email":"a@x.com","password":"secret1"}`)
+	_, refreshed := callUser(s.RefreshToken, `{"refreshToken":"`+login.RefreshToken+`"}`)
+
+	// The first refresh token has been exchanged already, as if someone else had stolen it
+	if code, _ := callUser(s.RefreshToken, `{"refreshToken":"`+login.RefreshToken+`"}`); code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token returned %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// Everything handed out since that login stops working
+	if code, _ := callUser(s.RefreshToken, `{"refreshToken":"`+refreshed.RefreshToken+`"}`); code != http.StatusUnauthorized {
+		t.Errorf("refresh token from the same login returned %d, want %d", code, http.StatusUnauthorized)
+	}
+	for _, access := range []string{login.Token, refreshed.Token} {
+		if status := authorisedStatus(s, access); status != http.StatusForbidden {
+			t.Errorf("access token from the same login got %d, want %d", status, http.StatusForbidden)
+		}
+	}
+
+	// The user's other login carries on
+	if status := authorisedStatus(s, other.Token); status != http.StatusOK {
+		t.Errorf("access token from another login got %d, want %d", status, http.StatusOK)
+	}
+	if code, _ := callUser(s.RefreshToken, `{"refreshToken":"`+other.RefreshToken+`"}`); code != http.StatusOK {
+		t.Errorf("refresh token from another login returned %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestExpiredAccessTokenIsRefused(t *testing.T) {
+	s, _ := newAuthServer(t, -time.Minute)
+
+	_, login := callUser(s.LoginUser, `{"email":"a@x.com","password":"secret1"}`)
+	if status := authorisedStatus(s, login.Token); status != http.StatusForbidden {
+		t.Errorf("expired access token got %d, want %d", status, http.StatusForbidden)
+	}
+
+	// The refresh token still gets a new one
+	if code, _ := callUser(s.RefreshToken, `{"refreshToken":"`+login.RefreshToken+`"}`); code != http.StatusOK {
+		t.Errorf("refresh returned %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s, _ := newAuthServer(t, 15*time.Minute)
+
+	_, phone := callUser(s.LoginUser, `{"email":"a@x.com","password":"secret1"}`)
+	_, laptop := callUser(s.LoginUser, `{"email":"a@x.com","password":"secret1"}`)
+	_, tablet := callUser(s.LoginUser, `{"email":"a@x.com","password":"secret1"}`)
+
+	if status := callAuthorised(s, s.LogoutUser, phone.Token); status != http.StatusOK {
+		t.Fatalf("logout returned %d", status)
+	}
+
+	// Only the login that logged out is gone
+	if status := authorisedStatus(s, phone.Token); status != http.StatusForbidden {
+		t.Errorf("logged out access token got %d, want %d", status, http.StatusForbidden)
+	}
+	if code, _ := callUser(s.RefreshToken, `{"refreshToken":"`+phone.RefreshToken+`"}`); code != http.StatusUnauthorized {
+		t.Errorf("logged out refresh token returned %d, want %d", code, http.StatusUnauthorized)
+	}
+	if status := authorisedStatus(s, laptop.Token); status != http.StatusOK {
+		t.Errorf("other login got %d, want %d", status, http.StatusOK)
+	}
+
+	if status := callAuthorised(s, s.LogoutAllDevices, laptop.Token); status != http.StatusOK {
+		t.Fatalf("logout everywhere returned %d", status)
+	}
+
+	for _, login := range []model.User{laptop, tablet} {
+		if status := authorisedStatus(s, login.Token); status != http.StatusForbidden {
+			t.Errorf("access token after logging out everywhere got %d, want %d", status, http.StatusForbidden)
+		}
+		if code, _ := callUser(s.RefreshToken, `{"refreshToken":"`+login.RefreshToken+`"}`); code != http.StatusUnauthorized {
+			t.Errorf("refresh token after logging out everywhere returned %d, want %d", code, http.StatusUnauthorized)
+		}
+	}
+
+	// Logging in again afterwards works as normal
+	_, again := callUser(s.LoginUser, `{"email":"a@x.com","password":"secret1"}`)
+	if status := authorisedStatus(s, again.Token); status != http.StatusOK {
+		t.Errorf("new login got %d, want %d", status, http.StatusOK)
+	}
+}
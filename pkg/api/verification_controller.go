@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/mail"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// Shortest time between two verification emails to the same user
+const verificationInterval = time.Minute
+
+// Error for users logging in before verifying their email address, when that isn't allowed
+const unverifiedMessage = "Email address hasn't been verified, follow the link emailed to you on signing up"
+
+// VerifyEmail - Endpoint marking the user verified with the token from the email sent on signing up
+func (s *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	if req.Token == "" {
+		u.RespondWithError(w, http.StatusBadRequest, "Missing verification token")
+		return
+	}
+
+	token, err := s.UserTokens.ConsumeUserToken(r.Context(), model.HashUserToken(req.Token), model.TokenEmailVerification)
+	if err != nil {
+		log.Println(err)
+		if err == dao.ErrNotFound {
+			u.RespondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+			return
+		}
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if time.Now().After(token.Expires) {
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+
+	user, err := s.Users.FindUserByEmail(r.Context(), token.UserID)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+
+	if !user.Verified {
+		user.Verified = true
+		if err := s.Users.UpdateUser(r.Context(), user); err != nil {
+			log.Println(err)
+			u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// ResendVerification - Endpoint emailing a new verification link to the user with the email, replacing
+// the one sent before. Succeeds without sending anything for unknown or already verified users, or
+// when a link was sent to the user less than a minute ago.
+func (s *Server) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusBadRequest, payloadError(err))
+		return
+	}
+
+	if !strings.Contains(req.Email, "@") {
+		u.RespondWithError(w, http.StatusBadRequest, "Email address is required")
+		return
+	}
+
+	user, err := s.Users.FindUserByEmail(r.Context(), req.Email)
+	if err == dao.ErrNotFound {
+		log.Printf("Verification requested for unknown user %s", req.Email)
+		u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if user.Verified {
+		u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+		return
+	}
+
+	wait, err := s.sendVerification(r.Context(), user)
+	if err != nil {
+		log.Println(err)
+		u.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Asking again straight away sends nothing, answered the same so it can't tell whose accounts exist
+	if wait > 0 {
+		log.Printf("Verification for %s was sent less than %s ago", user.Email, verificationInterval)
+	}
+
+	u.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// Emails the user a link to verify their address, unless one was sent too recently,
+// returning how long until another can be sent
+func (s *Server) sendVerification(ctx context.Context, user model.User) (time.Duration, error) {
+	token, wait, err := s.replaceUserToken(ctx, user.Email, model.TokenEmailVerification, s.VerificationTTL, verificationInterval)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+
+	s.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Money Tracker email address",
+		Body: "Thanks for signing up to Money Tracker. Follow this link within " + durationText(s.VerificationTTL) +
+			" to verify your email address:\n\n" +
+			s.appLink("/verify-email", token) + "\n\n" +
+			"If you didn't sign up, ignore this email.\n",
+	})
+
+	return 0, nil
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEmailVerification(t *testing.T) {
+	s, _ := newAuthServer(t, 15*time.Minute)
+	box := make(mailbox, 10)
+	s.Mailer = box
+	s.AppURL = "https://app.example.com"
+	s.VerificationTTL = 48 * time.Hour
+	s.DefaultCurrency = "GBP"
+
+	if code, user := callUser(s.CreateUser, `{"email":"b@x.com","password":"secret1"}`); code != http.StatusOK {
+		t.Fatalf("signup returned %d", code)
+	} else if user.Verified || user.Token != "" {
+		t.Errorf("signed up as verified %t with a token %q, want neither", user.Verified, user.Token)
+	}
+	token := mailedToken(t, box.next(t))
+
+	if code, _ := callUser(s.LoginUser, `{"email":"b@x.com","password":"secret1"}`); code != http.StatusForbidden {
+		t.Errorf("unverified login returned %d, want %d", code, http.StatusForbidden)
+	}
+
+	// Resending straight away can't be told apart from resending to nobody, and sends nothing
+	unknown := callAs(s.ResendVerification, "", `{"email":"nobody@x.com"}`)
+	box.none(t)
+	cooling := callAs(s.ResendVerification, "", `{"email":"b@x.com"}`)
+	box.none(t)
+	if cooling.Code != http.StatusOK || cooling.Code != unknown.Code || cooling.Body.String() != unknown.Body.String() {
+		t.Errorf("resend answered %d %s, and %d %s for nobody", cooling.Code, cooling.Body, unknown.Code, unknown.Body)
+	}
+	if cooling.Header().Get("Retry-After") != "" {
+		t.Errorf("resend gave away the cooldown with Retry-After %s", cooling.Header().Get("Retry-After"))
+	}
+
+	// So the first link is still the one that works
+	if w := callAs(s.VerifyEmail, "", `{"token":"`+token+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("verify returned %d: %s", w.Code, w.Body)
+	}
+	if code, _ := callUser(s.LoginUser, `{"email":"b@x.com","password":"secret1"}`); code != http.StatusOK {
+		t.Errorf("verified login returned %d, want %d", code, http.StatusOK)
+	}
+	if w := callAs(s.VerifyEmail, "", `{"token":"`+token+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("using the link again returned %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// Verified users aren't sent another
+	if w := callAs(s.ResendVerification, "", `{"email":"b@x.com"}`); w.Code != http.StatusOK {
+		t.Errorf("resend to a verified user returned %d", w.Code)
+	}
+	box.none(t)
+}
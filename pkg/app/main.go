@@ -1,76 +1,332 @@
-package app
-
-import (
-	"fmt"
-	"log"
-	"net/http"
-
-	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
-	"github.com/rs/cors"
-
-	"github.com/wilsonth122/money-tracker-api/pkg/api"
-	"github.com/wilsonth122/money-tracker-api/pkg/auth"
-	"github.com/wilsonth122/money-tracker-api/pkg/config"
-	"github.com/wilsonth122/money-tracker-api/pkg/dao"
-	"github.com/wilsonth122/money-tracker-api/pkg/stream"
-)
-
-// Setup - Should be called by the init() function upon service start up.
-// Moved logic here to support multiple environments which may need custom code in the init() function to work.
-func Setup() {
-	// Load config
-	e := godotenv.Load()
-	if e != nil {
-		log.Fatal(e)
-	}
-
-	conf := config.New()
-
-	// Connect to server
-	dao.DBConn.Addresses = conf.Database.Addresses
-	dao.DBConn.Username = conf.Database.Username
-	dao.DBConn.Password = conf.Database.Password
-	dao.DBConn.AdminDatabase = conf.Database.AdminDatabase
-	dao.DBConn.AppDatabase = conf.Database.AppDatabase
-	dao.DBConn.UserCollection = conf.Database.UserCollection
-	dao.DBConn.ExpenseCollection = conf.Database.ExpenseCollection
-	dao.DBConn.Connect()
-}
-
-// Start - Should be called by the main() function upon service start up.
-// Moved logic here to support multiple environments which may need custom code in the main() function to work.
-func Start() {
-	conf := config.New()
-
-	// Start the websocket used for streaming expenses
-	stream.Init()
-
-	r := mux.NewRouter()
-
-	// Attach JWT auth middleware
-	r.Use(auth.JwtAuthentication)
-
-	c := cors.New(cors.Options{
-		AllowedOrigins: conf.API.AllowedOrigins,
-		AllowedMethods: conf.API.AllowedMethods,
-		AllowedHeaders: conf.API.AllowedHeaders,
-	})
-
-	r.HandleFunc("/api/user/new", api.CreateUser).Methods("POST")
-	r.HandleFunc("/api/user/login", api.LoginUser).Methods("POST")
-	r.HandleFunc("/api/user/delete", api.DeleteUser).Methods("DELETE")
-	r.HandleFunc("/api/stream/expenses", api.StreamAllExpenses).Methods("GET")
-	r.HandleFunc("/api/expenses", api.AllExpenses).Methods("GET")
-	r.HandleFunc("/api/expenses/{id}", api.GetExpense).Methods("GET")
-	r.HandleFunc("/api/expenses", api.CreateExpense).Methods("POST")
-	r.HandleFunc("/api/expenses", api.UpdateExpense).Methods("PUT")
-	r.HandleFunc("/api/expenses/{id}", api.DeleteExpense).Methods("DELETE")
-
-	handler := c.Handler(r)
-
-	port := conf.API.Port
-	log.Printf("Origins: %s", conf.API.AllowedOrigins)
-	log.Printf("Listening on port %s", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), handler))
-}
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/joho/godotenv"
+	"github.com/rs/cors"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/api"
+	"github.com/wilsonth122/money-tracker-api/pkg/auth"
+	"github.com/wilsonth122/money-tracker-api/pkg/blob"
+	"github.com/wilsonth122/money-tracker-api/pkg/config"
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/mail"
+	"github.com/wilsonth122/money-tracker-api/pkg/rates"
+	"github.com/wilsonth122/money-tracker-api/pkg/scheduler"
+	"github.com/wilsonth122/money-tracker-api/pkg/stream"
+)
+
+// store and server are built by Setup and routed by Start
+var store dao.Store
+var server *api.Server
+
+// Setup - Should be called by the init() function upon service start up.
+// Moved logic here to support multiple environments which may need custom code in the init() function to work.
+func Setup() {
+	conf := loadConfig()
+
+	store = newStore(conf)
+
+	if conf.Database.AutoMigrate {
+		migrate()
+	}
+
+	keys, err := auth.NewKeyManager(conf.Auth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server = &api.Server{
+		Users:             store,
+		Expenses:          store,
+		Categories:        store,
+		Tags:              store,
+		Budgets:           store,
+		Recurrences:       store,
+		Goals:             store,
+		Accounts:          store,
+		Ledgers:           store,
+		Attachments:       store,
+		RefreshTokens:     store,
+		UserTokens:        store,
+		Revocations:       newRevocations(conf),
+		Keys:              keys,
+		Blobs:             newBlobStore(conf),
+		Mailer:            newMailer(conf),
+		AppURL:            conf.API.AppURL,
+		MaxAttachmentSize: conf.API.MaxAttachmentSize,
+		DefaultCurrency:   conf.API.DefaultCurrency,
+		AccessTokenTTL:    conf.Auth.AccessTokenTTL,
+		RefreshTokenTTL:   conf.Auth.RefreshTokenTTL,
+		PasswordResetTTL:  conf.Auth.PasswordResetTTL,
+		VerificationTTL:   conf.Auth.VerificationTTL,
+		AllowUnverified:   conf.Auth.AllowUnverified,
+	}
+
+	if conf.API.RatesFile != "" {
+		provider, err := rates.LoadFile(conf.API.RatesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.Rates = provider
+	}
+}
+
+// Picks the storage backend named by DATABASE_DRIVER and connects to it
+func newStore(c *config.Config) dao.Store {
+	conf := c.Database
+
+	switch conf.Driver {
+	case "memory":
+		log.Println("Using in-memory storage, nothing will be persisted")
+		return dao.NewMemoryStore()
+	case "sqlite", "postgres":
+		store, err := dao.NewSQLStore(conf.Driver, conf.DSN)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store.DefaultCurrency = c.API.DefaultCurrency
+		return store
+	case "mongo":
+		store := &dao.DAO{
+			URI:                  conf.URI,
+			Addresses:            conf.Addresses,
+			Username:             conf.Username,
+			Password:             conf.Password,
+			AdminDatabase:        conf.AdminDatabase,
+			AppDatabase:          conf.AppDatabase,
+			UserCollection:       conf.UserCollection,
+			ExpenseCollection:    conf.ExpenseCollection,
+			CategoryCollection:   conf.CategoryCollection,
+			BudgetCollection:     conf.BudgetCollection,
+			RecurrenceCollection: conf.RecurrenceCollection,
+			GoalCollection:       conf.GoalCollection,
+			AccountCollection:    conf.AccountCollection,
+			LedgerCollection:     conf.LedgerCollection,
+			InviteCollection:     conf.InviteCollection,
+			AttachmentCollection: conf.AttachmentCollection,
+			RefreshCollection:    conf.RefreshCollection,
+			RevokedCollection:    conf.RevokedCollection,
+			UserTokenCollection:  conf.UserTokenCollection,
+			ConnectTimeout:       conf.ConnectTimeout,
+			ReadTimeout:          conf.ReadTimeout,
+			WriteTimeout:         conf.WriteTimeout,
+			DefaultCurrency:      c.API.DefaultCurrency,
+		}
+		if err := store.Connect(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		return store
+	default:
+		log.Fatalf("Unknown DATABASE_DRIVER %q", conf.Driver)
+		return nil
+	}
+}
+
+// Picks where attachment content is kept from BLOB_DRIVER
+func newBlobStore(c *config.Config) blob.Store {
+	conf := c.Blob
+
+	switch conf.Driver {
+	case "file":
+		log.Printf("Keeping attachments in %s", conf.Dir)
+		return blob.NewFileStore(conf.Dir)
+	case "s3":
+		if conf.S3AccessKey == "" || conf.S3SecretKey == "" {
+			log.Fatal("BLOB_DRIVER s3 needs S3_ACCESS_KEY and S3_SECRET_KEY")
+		}
+		store, err := blob.NewS3Store(conf.S3Endpoint, conf.S3Region, conf.S3Bucket, conf.S3AccessKey, conf.S3SecretKey, conf.S3PathStyle)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return store
+	default:
+		log.Fatalf("Unknown BLOB_DRIVER %q", conf.Driver)
+		return nil
+	}
+}
+
+// Picks how email is sent from MAIL_DRIVER
+func newMailer(c *config.Config) mail.Mailer {
+	conf := c.Mail
+
+	switch conf.Driver {
+	case "log":
+		log.Println("Writing email to the log, nothing will be sent")
+		return mail.LogMailer{}
+	case "file":
+		log.Printf("Writing email to %s, nothing will be sent", conf.Dir)
+		return mail.NewFileMailer(conf.Dir, conf.From)
+	case "smtp":
+		if conf.SMTPHost == "" {
+			log.Fatal("MAIL_DRIVER smtp needs SMTP_HOST")
+		}
+		if conf.SMTPUsername != "" && conf.SMTPPassword == "" {
+			log.Fatal("SMTP_USERNAME needs SMTP_PASSWORD")
+		}
+		return mail.NewSMTPMailer(conf.SMTPHost, conf.SMTPPort, conf.SMTPUsername, conf.SMTPPassword, conf.From)
+	default:
+		log.Fatalf("Unknown MAIL_DRIVER %q", conf.Driver)
+		return nil
+	}
+}
+
+// Picks where revoked tokens are remembered from TOKEN_REVOCATIONS
+func newRevocations(c *config.Config) dao.RevocationStore {
+	switch c.Auth.Revocations {
+	case "database":
+		return store
+	case "memory":
+		log.Println("Remembering revoked tokens in memory, other instances will still accept them")
+		return dao.NewMemoryRevocations()
+	default:
+		log.Fatalf("Unknown TOKEN_REVOCATIONS %q", c.Auth.Revocations)
+		return nil
+	}
+}
+
+// Migrate - Brings the storage schema up to date, for the `migrate` subcommand which runs it in place of Setup.
+// Only the storage config is needed, nothing else is set up.
+func Migrate() {
+	store = newStore(loadConfig())
+	migrate()
+}
+
+// Loads .env into the environment and reads the config from it
+func loadConfig() *config.Config {
+	if err := godotenv.Load(); err != nil {
+		log.Fatal(err)
+	}
+
+	return config.New()
+}
+
+// Applies the pending migrations, from Setup unless DATABASE_AUTO_MIGRATE is off and from Migrate
+func migrate() {
+	m, ok := store.(dao.Migrator)
+	if !ok {
+		return
+	}
+
+	if err := m.Migrate(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Storage schema is up to date")
+}
+
+// Start - Should be called by the main() function upon service start up.
+// Moved logic here to support multiple environments which may need custom code in the main() function to work.
+func Start() {
+	conf := config.New()
+
+	// Start the websocket used for streaming expenses
+	stream.Init()
+
+	// Create recurring expenses as they fall due
+	if conf.API.RecurrenceInterval > 0 {
+		recurring := &scheduler.Recurring{
+			Recurrences: store,
+			Expenses:    store,
+			Interval:    conf.API.RecurrenceInterval,
+		}
+		go recurring.Run(context.Background())
+	}
+
+	r := mux.NewRouter()
+
+	// Attach JWT auth middleware
+	r.Use(auth.JwtAuthentication(server.Keys, server.Revocations))
+
+	c := cors.New(cors.Options{
+		AllowedOrigins: conf.API.AllowedOrigins,
+		AllowedMethods: conf.API.AllowedMethods,
+		AllowedHeaders: conf.API.AllowedHeaders,
+	})
+
+	r.HandleFunc("/.well-known/jwks.json", server.JWKS).Methods("GET")
+	r.HandleFunc("/api/user/new", server.CreateUser).Methods("POST")
+	r.HandleFunc("/api/user/login", server.LoginUser).Methods("POST")
+	r.HandleFunc("/api/user/refresh", server.RefreshToken).Methods("POST")
+	r.HandleFunc("/api/user/verify", server.VerifyEmail).Methods("POST")
+	r.HandleFunc("/api/user/verify/resend", server.ResendVerification).Methods("POST")
+	r.HandleFunc("/api/user/password/forgot", server.ForgotPassword).Methods("POST")
+	r.HandleFunc("/api/user/password/reset", server.ResetPassword).Methods("POST")
+	r.HandleFunc("/api/user/logout", server.LogoutUser).Methods("POST")
+	r.HandleFunc("/api/user/logout/all", server.LogoutAllDevices).Methods("POST")
+	r.HandleFunc("/api/user/delete", server.DeleteUser).Methods("DELETE")
+	r.HandleFunc("/api/user/settings", server.UpdateSettings).Methods("PUT")
+	r.HandleFunc("/api/stream/expenses", server.StreamAllExpenses).Methods("GET")
+	r.HandleFunc("/api/expenses", server.AllExpenses).Methods("GET")
+	r.HandleFunc("/api/expenses/totals", server.ExpenseTotals).Methods("GET")
+	r.HandleFunc("/api/expenses/breakdown", server.ExpenseBreakdown).Methods("GET")
+	r.HandleFunc("/api/cashflow", server.CashFlow).Methods("GET")
+	r.HandleFunc("/api/expenses/{id}", server.GetExpense).Methods("GET")
+	r.HandleFunc("/api/expenses", server.CreateExpense).Methods("POST")
+	r.HandleFunc("/api/expenses", server.UpdateExpense).Methods("PUT")
+	r.HandleFunc("/api/expenses/{id}", server.DeleteExpense).Methods("DELETE")
+	r.HandleFunc("/api/expenses/{id}/attachments", server.AllAttachments).Methods("GET")
+	r.HandleFunc("/api/expenses/{id}/attachments", server.UploadAttachment).Methods("POST")
+	r.HandleFunc("/api/expenses/{id}/attachments/{attachment}", server.GetAttachment).Methods("GET")
+	r.HandleFunc("/api/expenses/{id}/attachments/{attachment}", server.DeleteAttachment).Methods("DELETE")
+	r.HandleFunc("/api/categories", server.AllCategories).Methods("GET")
+	r.HandleFunc("/api/categories/{id}", server.GetCategory).Methods("GET")
+	r.HandleFunc("/api/categories", server.CreateCategory).Methods("POST")
+	r.HandleFunc("/api/categories", server.UpdateCategory).Methods("PUT")
+	r.HandleFunc("/api/categories/{id}", server.DeleteCategory).Methods("DELETE")
+	r.HandleFunc("/api/budgets", server.AllBudgets).Methods("GET")
+	r.HandleFunc("/api/budgets/{id}", server.GetBudget).Methods("GET")
+	r.HandleFunc("/api/budgets/{id}/report", server.BudgetReport).Methods("GET")
+	r.HandleFunc("/api/budgets", server.CreateBudget).Methods("POST")
+	r.HandleFunc("/api/budgets", server.UpdateBudget).Methods("PUT")
+	r.HandleFunc("/api/budgets/{id}", server.DeleteBudget).Methods("DELETE")
+	r.HandleFunc("/api/accounts", server.AllAccounts).Methods("GET")
+	r.HandleFunc("/api/accounts/balances", server.AccountBalances).Methods("GET")
+	r.HandleFunc("/api/accounts/{id}", server.GetAccount).Methods("GET")
+	r.HandleFunc("/api/accounts/{id}/statement", server.AccountStatement).Methods("GET")
+	r.HandleFunc("/api/accounts", server.CreateAccount).Methods("POST")
+	r.HandleFunc("/api/accounts", server.UpdateAccount).Methods("PUT")
+	r.HandleFunc("/api/accounts/{id}", server.DeleteAccount).Methods("DELETE")
+	r.HandleFunc("/api/transfers/{id}", server.GetTransfer).Methods("GET")
+	r.HandleFunc("/api/transfers", server.CreateTransfer).Methods("POST")
+	r.HandleFunc("/api/transfers/{id}", server.DeleteTransfer).Methods("DELETE")
+	r.HandleFunc("/api/ledgers", server.AllLedgers).Methods("GET")
+	r.HandleFunc("/api/ledgers/{id}", server.GetLedger).Methods("GET")
+	r.HandleFunc("/api/ledgers", server.CreateLedger).Methods("POST")
+	r.HandleFunc("/api/ledgers", server.UpdateLedger).Methods("PUT")
+	r.HandleFunc("/api/ledgers/{id}", server.DeleteLedger).Methods("DELETE")
+	r.HandleFunc("/api/ledgers/{id}/balances", server.LedgerBalances).Methods("GET")
+	r.HandleFunc("/api/ledgers/{id}/settlements", server.CreateSettlement).Methods("POST")
+	r.HandleFunc("/api/ledgers/{id}/invites", server.LedgerInvites).Methods("GET")
+	r.HandleFunc("/api/ledgers/{id}/invites", server.InviteMember).Methods("POST")
+	r.HandleFunc("/api/ledgers/{id}/members", server.UpdateMember).Methods("PUT")
+	r.HandleFunc("/api/ledgers/{id}/members/{user}", server.RemoveMember).Methods("DELETE")
+	r.HandleFunc("/api/invites", server.AllInvites).Methods("GET")
+	r.HandleFunc("/api/invites/{id}/accept", server.AcceptInvite).Methods("POST")
+	r.HandleFunc("/api/invites/{id}", server.DeleteInvite).Methods("DELETE")
+	r.HandleFunc("/api/goals", server.AllGoals).Methods("GET")
+	r.HandleFunc("/api/goals/{id}", server.GetGoal).Methods("GET")
+	r.HandleFunc("/api/goals/{id}/progress", server.GoalProgress).Methods("GET")
+	r.HandleFunc("/api/goals", server.CreateGoal).Methods("POST")
+	r.HandleFunc("/api/goals", server.UpdateGoal).Methods("PUT")
+	r.HandleFunc("/api/goals/{id}", server.DeleteGoal).Methods("DELETE")
+	r.HandleFunc("/api/recurring", server.AllRecurrences).Methods("GET")
+	r.HandleFunc("/api/recurring/{id}", server.GetRecurrence).Methods("GET")
+	r.HandleFunc("/api/recurring", server.CreateRecurrence).Methods("POST")
+	r.HandleFunc("/api/recurring", server.UpdateRecurrence).Methods("PUT")
+	r.HandleFunc("/api/recurring/{id}", server.DeleteRecurrence).Methods("DELETE")
+	r.HandleFunc("/api/tags", server.AllTags).Methods("GET")
+	r.HandleFunc("/api/tags/merge", server.MergeTags).Methods("POST")
+	r.HandleFunc("/api/tags/{tag}", server.RenameTag).Methods("PUT")
+
+	handler := c.Handler(r)
+
+	port := conf.API.Port
+	log.Printf("Origins: %s", conf.API.AllowedOrigins)
+	log.Printf("Listening on port %s", port)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), handler))
+}
@@ -1,85 +1,93 @@
-package auth
-
-import (
-	"context"
-	"errors"
-	jwt "github.com/dgrijalva/jwt-go"
-	"log"
-	"net/http"
-	"os"
-	"strings"
-
-	"github.com/wilsonth122/money-tracker-api/pkg/model"
-	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
-)
-
-// JwtAuthentication - Authenticates the token in the header of a request
-var JwtAuthentication = func(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		notAuth := []string{"/api/user/new", "/api/user/login", "/api/stream/expenses"}
-		requestPath := r.URL.Path
-
-		// Check if request does not need authentication, serve the request if it doesn't need it
-		for _, value := range notAuth {
-			if value == requestPath {
-				next.ServeHTTP(w, r)
-				return
-			}
-		}
-
-		tokenHeader := r.Header.Get("Authorization")
-
-		// Token is missing, returns with error code 403 Unauthorized
-		if tokenHeader == "" {
-			u.RespondWithError(w, http.StatusForbidden, "Missing auth token")
-			return
-		}
-
-		// The token normally comes in format `Bearer {token-body}`,
-		// we check if the retrieved token matched this requirement
-		splitted := strings.Split(tokenHeader, " ")
-		if len(splitted) != 2 {
-			u.RespondWithError(w, http.StatusForbidden, "Invalid/Malformed auth token")
-			return
-		}
-
-		// Grab the token part, what we are truly interested in
-		tokenStr := splitted[1]
-		token, err := ParseToken(tokenStr)
-		if err != nil {
-			u.RespondWithError(w, http.StatusForbidden, err.Error())
-			return
-		}
-
-		// Useful for monitoring
-		log.Println("User " + token.UserID)
-
-		// Everything went well,
-		// proceed with the request and set the caller to the user retrieved from the parsed token
-		ctx := context.WithValue(r.Context(), "user", token.UserID)
-		r = r.WithContext(ctx)
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-// ParseToken - Parses and encrypted token string into a token
-func ParseToken(tokenStr string) (model.Token, error) {
-	tk := model.Token{}
-
-	token, err := jwt.ParseWithClaims(tokenStr, &tk, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("TOKEN_PASSWORD")), nil
-	})
-
-	// Malformed token
-	if err != nil {
-		return tk, err
-	}
-
-	// Token is invalid, maybe not signed on this server
-	if !token.Valid {
-		return tk, errors.New("Token is not valid")
-	}
-
-	return tk, nil
-}
+package auth
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	u "github.com/wilsonth122/money-tracker-api/pkg/utils"
+)
+
+// JwtAuthentication - Returns middleware authenticating the token in the header of a request with the keys,
+// rejecting tokens that have been revoked by logging out
+func JwtAuthentication(keys *KeyManager, revocations dao.RevocationStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return authenticate(next, keys, revocations)
+	}
+}
+
+func authenticate(next http.Handler, keys *KeyManager, revocations dao.RevocationStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notAuth := []string{"/api/user/new", "/api/user/login", "/api/user/refresh", "/api/user/verify", "/api/user/verify/resend",
+			"/api/user/password/forgot", "/api/user/password/reset", "/api/stream/expenses", "/.well-known/jwks.json"}
+		requestPath := r.URL.Path
+
+		// Check if request does not need authentication, serve the request if it doesn't need it
+		for _, value := range notAuth {
+			if value == requestPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		tokenHeader := r.Header.Get("Authorization")
+
+		// Token is missing, returns with error code 403 Unauthorized
+		if tokenHeader == "" {
+			u.RespondWithError(w, http.StatusForbidden, "Missing auth token")
+			return
+		}
+
+		// The token normally comes in format `Bearer {token-body}`,
+		// we check if the retrieved token matched this requirement
+		splitted := strings.Split(tokenHeader, " ")
+		if len(splitted) != 2 {
+			u.RespondWithError(w, http.StatusForbidden, "Invalid/Malformed auth token")
+			return
+		}
+
+		// Grab the token part, what we are truly interested in
+		tokenStr := splitted[1]
+		token, err := keys.ParseToken(tokenStr)
+		if err != nil {
+			u.RespondWithError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		revoked, err := Revoked(r.Context(), revocations, token)
+		if err != nil {
+			log.Println(err)
+			u.RespondWithError(w, http.StatusInternalServerError, "Couldn't check the auth token")
+			return
+		}
+		if revoked {
+			u.RespondWithError(w, http.StatusForbidden, "Token has been revoked, please log in again")
+			return
+		}
+
+		// Useful for monitoring
+		log.Println("User " + token.UserID)
+
+		// Everything went well,
+		// proceed with the request and set the caller to the user retrieved from the parsed token.
+		// The claims are kept too, for logging out.
+		ctx := context.WithValue(r.Context(), "user", token.UserID)
+		ctx = context.WithValue(ctx, "token", token)
+		r = r.WithContext(ctx)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Revoked - Whether the token, or the login family it belongs to, has been revoked
+func Revoked(ctx context.Context, revocations dao.RevocationStore, tk model.Token) (bool, error) {
+	ids := []string{tk.Id}
+	if tk.FamilyID != "" {
+		ids = append(ids, tk.FamilyID)
+	}
+
+	return revocations.TokenRevoked(ctx, ids...)
+}
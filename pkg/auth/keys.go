@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/config"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// Smallest RSA key accepted for signing or verifying tokens
+const minRSABits = 2048
+
+// KeyManager - Signs access tokens with the current signing key and verifies them with any of the
+// verification keys, found by the kid header of the token. Keys are rotated by making the new key
+// the signing key and keeping the old one as a verification key until its tokens have expired.
+type KeyManager struct {
+	signing   signingKey
+	verifying map[string]verificationKey
+
+	issuer   string
+	audience string
+	ttl      time.Duration
+}
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+	// jwk is what is published in the JWKS, nil for the shared secret which must never be
+	jwk *JWK
+}
+
+// JWK - A public key as published at /.well-known/jwks.json (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// N and E are the modulus and exponent of RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv and X are the curve and public key of Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS - The set of keys tokens can be verified with
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewKeyManager - Loads the keys named by the config. TOKEN_SIGNING_KEY is a PEM private key file, RSA
+// for RS256 or Ed25519 for EdDSA, and TOKEN_VERIFICATION_KEYS the PEM files of keys that were used
+// before it. TOKEN_PASSWORD signs with HS256 when there is no signing key and otherwise only verifies
+// the tokens it signed before, which carry no kid.
+func NewKeyManager(conf config.AuthConfig) (*KeyManager, error) {
+	m := &KeyManager{
+		verifying: map[string]verificationKey{},
+		issuer:    conf.TokenIssuer,
+		audience:  conf.TokenAudience,
+		ttl:       conf.AccessTokenTTL,
+	}
+
+	if conf.TokenPassword != "" {
+		secret := []byte(conf.TokenPassword)
+		m.verifying[""] = verificationKey{method: jwt.SigningMethodHS256, key: secret}
+		m.signing = signingKey{method: jwt.SigningMethodHS256, key: secret}
+	}
+
+	if conf.SigningKey != "" {
+		private, err := loadKey(conf.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: signing key must be a private key", conf.SigningKey)
+		}
+
+		verification, err := newVerificationKey(signer.Public())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", conf.SigningKey, err)
+		}
+
+		m.verifying[verification.jwk.Kid] = verification
+		m.signing = signingKey{kid: verification.jwk.Kid, method: verification.method, key: private}
+	}
+
+	for _, file := range conf.VerificationKeys {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+
+		key, err := loadKey(file)
+		if err != nil {
+			return nil, err
+		}
+
+		// A retired signing key can be kept as it was, only its public half is used
+		if signer, ok := key.(crypto.Signer); ok {
+			key = signer.Public()
+		}
+
+		verification, err := newVerificationKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+
+		m.verifying[verification.jwk.Kid] = verification
+	}
+
+	if m.signing.key == nil {
+		return nil, errors.New("TOKEN_SIGNING_KEY or TOKEN_PASSWORD must be set to sign tokens")
+	}
+
+	return m, nil
+}
+
+// GenerateToken - Generates and signs a new JWT access token for the login family, valid for ACCESS_TOKEN_TTL
+func (m *KeyManager) GenerateToken(id string, family string) (string, error) {
+	now := time.Now()
+
+	tk := &model.Token{
+		UserID:   id,
+		FamilyID: family,
+		StandardClaims: jwt.StandardClaims{
+			Id:        model.NewID(),
+			Issuer:    m.issuer,
+			Audience:  m.audience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(m.ttl).Unix(),
+		},
+	}
+	token := jwt.NewWithClaims(m.signing.method, tk)
+	if m.signing.kid != "" {
+		token.Header["kid"] = m.signing.kid
+	}
+
+	return token.SignedString(m.signing.key)
+}
+
+// ParseToken - Parses and encrypted token string into a token, checking it hasn't expired
+// and was issued by this API for its clients
+func (m *KeyManager) ParseToken(tokenStr string) (model.Token, error) {
+	tk := model.Token{}
+
+	token, err := jwt.ParseWithClaims(tokenStr, &tk, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, ok := m.verifying[kid]
+		if !ok {
+			return nil, fmt.Errorf("Unknown signing key %q", kid)
+		}
+
+		// Anything else could be a token signed with a public key used as some other kind of key
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("Unexpected signing method %v", token.Header["alg"])
+		}
+
+		return key.key, nil
+	})
+
+	// Malformed or expired token
+	if err != nil {
+		return tk, err
+	}
+
+	// Token is invalid, maybe not signed on this server
+	if !token.Valid {
+		return tk, errors.New("Token is not valid")
+	}
+
+	// Tokens from before expiry was added would otherwise last forever
+	if tk.ExpiresAt == 0 {
+		return tk, errors.New("Token has no expiry")
+	}
+
+	// Tokens without an ID couldn't be revoked
+	if tk.Id == "" {
+		return tk, errors.New("Token has no ID")
+	}
+
+	if !tk.VerifyIssuer(m.issuer, true) || !tk.VerifyAudience(m.audience, true) {
+		return tk, errors.New("Token was not issued for this API")
+	}
+
+	return tk, nil
+}
+
+// JWKS - The public keys tokens can be verified with, the signing key first. Tokens signed with
+// TOKEN_PASSWORD can only be verified by this API.
+func (m *KeyManager) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range m.verifying {
+		if key.jwk != nil {
+			set.Keys = append(set.Keys, *key.jwk)
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		if (set.Keys[i].Kid == m.signing.kid) != (set.Keys[j].Kid == m.signing.kid) {
+			return set.Keys[i].Kid == m.signing.kid
+		}
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+// Reads the first PEM block of the file as a PKCS #8, PKCS #1 or PKIX key
+func loadKey(file string) (interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM key found", file)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", file, block.Type)
+	}
+}
+
+// Works out the algorithm of the public key and the JWK it is published as, identified by its
+// RFC 7638 thumbprint so the kid stays the same wherever the key is loaded
+func newVerificationKey(public interface{}) (verificationKey, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSABits {
+			return verificationKey{}, fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+		}
+
+		n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+		kid := thumbprint(map[string]string{"e": e, "kty": "RSA", "n": n})
+
+		return verificationKey{
+			method: jwt.SigningMethodRS256,
+			key:    key,
+			jwk:    &JWK{Kty: "RSA", Use: "sig", Alg: jwt.SigningMethodRS256.Alg(), Kid: kid, N: n, E: e},
+		}, nil
+	case ed25519.PublicKey:
+		x := base64.RawURLEncoding.EncodeToString(key)
+		kid := thumbprint(map[string]string{"crv": "Ed25519", "kty": "OKP", "x": x})
+
+		return verificationKey{
+			method: SigningMethodEdDSA,
+			key:    key,
+			jwk:    &JWK{Kty: "OKP", Use: "sig", Alg: SigningMethodEdDSA.Alg(), Kid: kid, Crv: "Ed25519", X: x},
+		}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %T, keys must be RSA or Ed25519", public)
+	}
+}
+
+// The SHA-256 of the key's required members, which encoding/json writes in the lexicographic order required
+func thumbprint(members map[string]string) string {
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,49 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrNotFound - Returned when nothing is stored under the key
+var ErrNotFound = errors.New("Blob not found")
+
+// ErrInvalidKey - Returned for keys that aren't made of the characters ValidKey allows
+var ErrInvalidKey = errors.New("Invalid blob key")
+
+// Store - Keeps binary content such as receipt photos under slash separated keys,
+// independent of where it ends up. Details about the content are kept by the caller.
+type Store interface {
+	// Put stores size bytes read from r under the key, replacing anything already there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the content under the key, which the caller must close
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the content under the key, succeeding when there is none
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidKey - Checks the key is made of segments of letters, digits, dots, dashes and underscores
+// separated by single slashes, so it can be used as a path or URL unescaped
+func ValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+
+		for _, r := range segment {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			default:
+				return false
+			}
+		}
+	}
+
+	return true
+}
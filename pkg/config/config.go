@@ -1,100 +1,247 @@
-package config
-
-import (
-	"os"
-	"strconv"
-	"strings"
-)
-
-type APIConfig struct {
-	Port           string
-	AllowedOrigins []string
-	AllowedMethods []string
-	AllowedHeaders []string
-}
-
-type DatabaseConfig struct {
-	Addresses         []string
-	Username          string
-	Password          string
-	AdminDatabase     string
-	AppDatabase       string
-	UserCollection    string
-	ExpenseCollection string
-}
-
-type AuthConfig struct {
-	TokenPassword string
-}
-
-type Config struct {
-	API      APIConfig
-	Database DatabaseConfig
-	Auth     AuthConfig
-}
-
-// New returns a new Config struct
-func New() *Config {
-	return &Config{
-		API: APIConfig{
-			Port:           getEnv("PORT", "8080"),
-			AllowedOrigins: getEnvAsSlice("ALLOWED_ORIGINS", []string{""}, ","),
-			AllowedMethods: getEnvAsSlice("ALLOWED_METHODS", []string{""}, ","),
-			AllowedHeaders: getEnvAsSlice("ALLOWED_HEADERS", []string{""}, ","),
-		},
-		Database: DatabaseConfig{
-			Addresses:         getEnvAsSlice("DATABASE_ADDRESSES", []string{""}, ","),
-			Username:          getEnv("DATABASE_USERNAME", ""),
-			Password:          getEnv("DATABASE_PASSWORD", ""),
-			AdminDatabase:     getEnv("ADMIN_DATABASE", ""),
-			AppDatabase:       getEnv("APP_DATABASE", ""),
-			UserCollection:    getEnv("USER_COLLECTION", ""),
-			ExpenseCollection: getEnv("EXPENSE_COLLECTION", ""),
-		},
-		Auth: AuthConfig{
-			TokenPassword: getEnv("TOKEN_PASSWORD", ""),
-		},
-	}
-}
-
-// Simple helper function to read an environment or return a default value
-func getEnv(key string, defaultVal string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-
-	return defaultVal
-}
-
-// Simple helper function to read an environment variable into integer or return a default value
-func getEnvAsInt(name string, defaultVal int) int {
-	valueStr := getEnv(name, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
-	}
-
-	return defaultVal
-}
-
-// Helper to read an environment variable into a bool or return default value
-func getEnvAsBool(name string, defaultVal bool) bool {
-	valStr := getEnv(name, "")
-	if val, err := strconv.ParseBool(valStr); err == nil {
-		return val
-	}
-
-	return defaultVal
-}
-
-// Helper to read an environment variable into a string slice or return default value
-func getEnvAsSlice(name string, defaultVal []string, sep string) []string {
-	valStr := getEnv(name, "")
-
-	if valStr == "" {
-		return defaultVal
-	}
-
-	val := strings.Split(valStr, sep)
-
-	return val
-}
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type APIConfig struct {
+	Port           string
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+
+	DefaultCurrency string
+	RatesFile       string
+
+	// RecurrenceInterval is how often recurring expenses are created, zero turns the scheduler off
+	RecurrenceInterval time.Duration
+
+	// MaxAttachmentSize is the largest file in bytes that can be attached to an expense
+	MaxAttachmentSize int64
+
+	// AppURL is where the web app lives, which links in emails point into
+	AppURL string
+}
+
+type DatabaseConfig struct {
+	Driver               string
+	DSN                  string
+	AutoMigrate          bool
+	URI                  string
+	Addresses            []string
+	Username             string
+	Password             string
+	AdminDatabase        string
+	AppDatabase          string
+	UserCollection       string
+	ExpenseCollection    string
+	CategoryCollection   string
+	BudgetCollection     string
+	RecurrenceCollection string
+	GoalCollection       string
+	AccountCollection    string
+	LedgerCollection     string
+	InviteCollection     string
+	AttachmentCollection string
+	RefreshCollection    string
+	RevokedCollection    string
+	UserTokenCollection  string
+	ConnectTimeout       time.Duration
+	ReadTimeout          time.Duration
+	WriteTimeout         time.Duration
+}
+
+// BlobConfig - Where attachment content is kept, on the local filesystem or in an S3 compatible bucket
+type BlobConfig struct {
+	Driver string
+	Dir    string
+
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	// S3PathStyle addresses the bucket in the path, which MinIO and most other stand-ins need
+	S3PathStyle bool
+}
+
+// MailConfig - How email is sent: through an SMTP server, or written to the log or a directory for local testing
+type MailConfig struct {
+	Driver string
+	// From is the sender of every email, a bare address or one with a name such as "Money Tracker <no-reply@example.com>"
+	From string
+	Dir  string
+
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+type AuthConfig struct {
+	TokenPassword string
+	// SigningKey is the PEM file of the private key access tokens are signed with, RSA or Ed25519.
+	// VerificationKeys are the PEM files of keys rotated out, still trusted until their tokens expire.
+	SigningKey       string
+	VerificationKeys []string
+	// TokenIssuer and TokenAudience are put in every access token and required when one is checked
+	TokenIssuer   string
+	TokenAudience string
+	// AccessTokenTTL is how long an access token lasts, RefreshTokenTTL how long a refresh token can wait to be exchanged
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// PasswordResetTTL is how long the link in a password reset email works for
+	PasswordResetTTL time.Duration
+	// VerificationTTL is how long the link in an email verification email works for
+	VerificationTTL time.Duration
+	// AllowUnverified lets users log in and use the API before verifying their email address
+	AllowUnverified bool
+	// Revocations is where revoked tokens are remembered, "database" to share them between every
+	// instance or "memory" for a single instance
+	Revocations string
+}
+
+type Config struct {
+	API      APIConfig
+	Database DatabaseConfig
+	Blob     BlobConfig
+	Mail     MailConfig
+	Auth     AuthConfig
+}
+
+// New returns a new Config struct
+func New() *Config {
+	return &Config{
+		API: APIConfig{
+			Port:           getEnv("PORT", "8080"),
+			AllowedOrigins: getEnvAsSlice("ALLOWED_ORIGINS", []string{""}, ","),
+			AllowedMethods: getEnvAsSlice("ALLOWED_METHODS", []string{""}, ","),
+			AllowedHeaders: getEnvAsSlice("ALLOWED_HEADERS", []string{""}, ","),
+
+			DefaultCurrency: getEnv("DEFAULT_CURRENCY", "GBP"),
+			RatesFile:       getEnv("RATES_FILE", ""),
+
+			RecurrenceInterval: getEnvAsDuration("RECURRENCE_INTERVAL", time.Minute),
+
+			MaxAttachmentSize: int64(getEnvAsInt("MAX_ATTACHMENT_SIZE", 10<<20)),
+
+			AppURL: getEnv("APP_URL", "http://localhost:3000"),
+		},
+		Database: DatabaseConfig{
+			Driver:               getEnv("DATABASE_DRIVER", "mongo"),
+			DSN:                  getEnv("DATABASE_DSN", ""),
+			AutoMigrate:          getEnvAsBool("DATABASE_AUTO_MIGRATE", true),
+			URI:                  getEnv("DATABASE_URI", ""),
+			Addresses:            getEnvAsSlice("DATABASE_ADDRESSES", []string{""}, ","),
+			Username:             getEnv("DATABASE_USERNAME", ""),
+			Password:             getEnv("DATABASE_PASSWORD", ""),
+			AdminDatabase:        getEnv("ADMIN_DATABASE", ""),
+			AppDatabase:          getEnv("APP_DATABASE", ""),
+			UserCollection:       getEnv("USER_COLLECTION", ""),
+			ExpenseCollection:    getEnv("EXPENSE_COLLECTION", ""),
+			CategoryCollection:   getEnv("CATEGORY_COLLECTION", "categories"),
+			BudgetCollection:     getEnv("BUDGET_COLLECTION", "budgets"),
+			RecurrenceCollection: getEnv("RECURRENCE_COLLECTION", "recurrences"),
+			GoalCollection:       getEnv("GOAL_COLLECTION", "goals"),
+			AccountCollection:    getEnv("ACCOUNT_COLLECTION", "accounts"),
+			LedgerCollection:     getEnv("LEDGER_COLLECTION", "ledgers"),
+			InviteCollection:     getEnv("INVITE_COLLECTION", "invites"),
+			AttachmentCollection: getEnv("ATTACHMENT_COLLECTION", "attachments"),
+			RefreshCollection:    getEnv("REFRESH_TOKEN_COLLECTION", "refresh_tokens"),
+			RevokedCollection:    getEnv("REVOKED_TOKEN_COLLECTION", "revoked_tokens"),
+			UserTokenCollection:  getEnv("USER_TOKEN_COLLECTION", "user_tokens"),
+			ConnectTimeout:       getEnvAsDuration("DATABASE_CONNECT_TIMEOUT", 10*time.Second),
+			ReadTimeout:          getEnvAsDuration("DATABASE_READ_TIMEOUT", 5*time.Second),
+			WriteTimeout:         getEnvAsDuration("DATABASE_WRITE_TIMEOUT", 5*time.Second),
+		},
+		Blob: BlobConfig{
+			Driver: getEnv("BLOB_DRIVER", "file"),
+			Dir:    getEnv("BLOB_DIR", "attachments"),
+
+			S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+			S3Region:    getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("S3_BUCKET", ""),
+			S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+			S3PathStyle: getEnvAsBool("S3_PATH_STYLE", true),
+		},
+		Mail: MailConfig{
+			Driver: getEnv("MAIL_DRIVER", "log"),
+			From:   getEnv("MAIL_FROM", "Money Tracker <no-reply@localhost>"),
+			Dir:    getEnv("MAIL_DIR", "mail"),
+
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		},
+		Auth: AuthConfig{
+			TokenPassword:    getEnv("TOKEN_PASSWORD", ""),
+			SigningKey:       getEnv("TOKEN_SIGNING_KEY", ""),
+			VerificationKeys: getEnvAsSlice("TOKEN_VERIFICATION_KEYS", []string{}, ","),
+			TokenIssuer:      getEnv("TOKEN_ISSUER", "money-tracker-api"),
+			TokenAudience:    getEnv("TOKEN_AUDIENCE", "money-tracker"),
+			AccessTokenTTL:   getEnvAsDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTokenTTL:  getEnvAsDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			PasswordResetTTL: getEnvAsDuration("PASSWORD_RESET_TTL", time.Hour),
+			VerificationTTL:  getEnvAsDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+			AllowUnverified:  getEnvAsBool("ALLOW_UNVERIFIED_USERS", false),
+			Revocations:      getEnv("TOKEN_REVOCATIONS", "database"),
+		},
+	}
+}
+
+// Simple helper function to read an environment or return a default value
+func getEnv(key string, defaultVal string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+
+	return defaultVal
+}
+
+// Simple helper function to read an environment variable into integer or return a default value
+func getEnvAsInt(name string, defaultVal int) int {
+	valueStr := getEnv(name, "")
+	if value, err := strconv.Atoi(valueStr); err == nil {
+		return value
+	}
+
+	return defaultVal
+}
+
+// Helper to read an environment variable into a bool or return default value
+func getEnvAsBool(name string, defaultVal bool) bool {
+	valStr := getEnv(name, "")
+	if val, err := strconv.ParseBool(valStr); err == nil {
+		return val
+	}
+
+	return defaultVal
+}
+
+// Helper to read an environment variable such as "5s" into a duration or return default value
+func getEnvAsDuration(name string, defaultVal time.Duration) time.Duration {
+	valStr := getEnv(name, "")
+	if val, err := time.ParseDuration(valStr); err == nil {
+		return val
+	}
+
+	return defaultVal
+}
+
+// Helper to read an environment variable into a string slice or return default value
+func getEnvAsSlice(name string, defaultVal []string, sep string) []string {
+	valStr := getEnv(name, "")
+
+	if valStr == "" {
+		return defaultVal
+	}
+
+	val := strings.Split(valStr, sep)
+
+	return val
+}
@@ -1,139 +1,1657 @@
-package dao
-
-import (
-	"crypto/tls"
-	"log"
-	"net"
-
-	mgo "gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
-
-	"github.com/wilsonth122/money-tracker-api/pkg/model"
-)
-
-// DAO struct
-type DAO struct {
-	Addresses         []string
-	Username          string
-	Password          string
-	AdminDatabase     string
-	AppDatabase  string
-	UserCollection    string
-	ExpenseCollection string
-}
-
-var DBConn = DAO{}
-
-var db *mgo.Database
-
-// Connect MongoDB session
-func (dao *DAO) Connect() {
-	tlsConfig := &tls.Config{}
-
-	dialInfo := &mgo.DialInfo{
-		Addrs:    dao.Addresses,
-		Database: dao.AdminDatabase,
-		Username: dao.Username,
-		Password: dao.Password,
-	}
-
-	dialInfo.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
-		conn, err := tls.Dial("tcp", addr.String(), tlsConfig)
-		return conn, err
-	}
-
-	log.Printf("Dialing MongoDB Server...")
-	session, err := mgo.DialWithInfo(dialInfo)
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	db = session.DB(dao.AppDatabase)
-	log.Println("Successfully connected to " + dao.AppDatabase)
-}
-
-// InsertUser - Inserts a user into the users collection
-func (dao *DAO) InsertUser(user model.User) error {
-	err := db.C(dao.UserCollection).Insert(&user)
-
-	return err
-}
-
-// FindUserByEmail - Runs a find on the users collection and returns the first user with the email
-func (dao *DAO) FindUserByEmail(email string) (model.User, error) {
-	var user model.User
-
-	err := db.C(dao.UserCollection).Find(bson.M{"email": email}).One(&user)
-
-	return user, err
-}
-
-// RemoveUserByEmail - Rmeoves a user from the users collection
-func (dao *DAO) RemoveUserByEmail(email string) error {
-	err := db.C(dao.UserCollection).Remove(bson.M{"email": email})
-
-	return err
-}
-
-// UserExists - Checks whether a user is already using the provided email
-func (dao *DAO) UserExists(email string) (bool, error) {
-	n, err := db.C(dao.UserCollection).Find(bson.M{"email": email}).Limit(1).Count()
-
-	if err != nil && err != mgo.ErrNotFound {
-		return true, err
-	}
-
-	if n > 0 {
-		return true, nil
-	}
-
-	return false, nil
-}
-
-// FindAllExpenses - Runs a find on the expenses collection
-// and returns all expense records relating to the user specified
-func (dao *DAO) FindAllExpenses(user string) ([]model.Expense, error) {
-	var expenses []model.Expense
-
-	err := db.C(dao.ExpenseCollection).Find(bson.M{"userID": user}).All(&expenses)
-
-	return expenses, err
-}
-
-// FindExpenseByID - Runs a find on the expenses collection and returns the first expense with the id
-func (dao *DAO) FindExpenseByID(id string) (model.Expense, error) {
-	var expense model.Expense
-
-	err := db.C(dao.ExpenseCollection).FindId(bson.ObjectIdHex(id)).One(&expense)
-
-	return expense, err
-}
-
-// InsertExpense - Inserts an expense record into the expenses collection
-func (dao *DAO) InsertExpense(expense model.Expense) error {
-	err := db.C(dao.ExpenseCollection).Insert(&expense)
-
-	return err
-}
-
-// RemoveExpenseByID - Removes an expense by id
-func (dao *DAO) RemoveExpenseByID(id string) error {
-	err := db.C(dao.ExpenseCollection).RemoveId(bson.ObjectIdHex(id))
-
-	return err
-}
-
-// UpdateExpense - Updates an expense record in the expenses collection
-func (dao *DAO) UpdateExpense(expense model.Expense) error {
-	err := db.C(dao.ExpenseCollection).UpdateId(expense.ID, &expense)
-
-	return err
-}
-
-// RemoveUserExpenses - Removes all expenses relating to a user
-func (dao *DAO) RemoveUserExpenses(email string) error {
-	_, err := db.C(dao.ExpenseCollection).RemoveAll(bson.M{"userID": email})
-
-	return err
-}
+package dao
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// DAO - MongoDB implementation of Store
+type DAO struct {
+	// URI is a connection string (mongodb:// or mongodb+srv://), used instead of Addresses when set
+	URI                  string
+	Addresses            []string
+	Username             string
+	Password             string
+	AdminDatabase        string
+	AppDatabase          string
+	UserCollection       string
+	ExpenseCollection    string
+	CategoryCollection   string
+	BudgetCollection     string
+	RecurrenceCollection string
+	GoalCollection       string
+	AccountCollection    string
+	LedgerCollection     string
+	InviteCollection     string
+	AttachmentCollection string
+	RefreshCollection    string
+	RevokedCollection    string
+	UserTokenCollection  string
+
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+
+	// DefaultCurrency is assigned to users and expenses recorded before currencies were tracked
+	DefaultCurrency string
+
+	client *mongo.Client
+	db     *mongo.Database
+}
+
+var _ Store = (*DAO)(nil)
+var _ Migrator = (*DAO)(nil)
+
+// Collection recording which mongoMigrations have been applied
+const migrationCollection = "schema_migrations"
+
+// expenseDocument - How an expense is laid out in MongoDB.
+// Model IDs are plain strings, but the collection keeps ObjectId primary keys.
+type expenseDocument struct {
+	ID            bson.ObjectID `bson:"_id"`
+	model.Expense `bson:",inline"`
+}
+
+func newExpenseDocument(expense model.Expense) (expenseDocument, error) {
+	id, err := bson.ObjectIDFromHex(expense.ID)
+	if err != nil {
+		return expenseDocument{}, ErrNotFound
+	}
+
+	return expenseDocument{ID: id, Expense: expense}, nil
+}
+
+func (doc expenseDocument) expense() model.Expense {
+	expense := doc.Expense
+	expense.ID = doc.ID.Hex()
+	expense.ResolveType()
+
+	return expense
+}
+
+// Connect - Connects to MongoDB using either the connection string or the address list
+func (dao *DAO) Connect(ctx context.Context) error {
+	opts := options.Client().SetConnectTimeout(dao.ConnectTimeout)
+
+	if dao.URI != "" {
+		opts.ApplyURI(dao.URI)
+	} else {
+		opts.SetHosts(dao.Addresses).SetTLSConfig(&tls.Config{})
+	}
+
+	if dao.Username != "" {
+		opts.SetAuth(options.Credential{
+			AuthSource: dao.AdminDatabase,
+			Username:   dao.Username,
+			Password:   dao.Password,
+		})
+	}
+
+	log.Printf("Dialing MongoDB Server...")
+	client, err := mongo.Connect(opts)
+	if err != nil {
+		return err
+	}
+
+	pingCtx, cancel := withTimeout(ctx, dao.ConnectTimeout)
+	defer cancel()
+
+	if err := client.Ping(pingCtx, readpref.Primary()); err != nil {
+		client.Disconnect(ctx)
+		return err
+	}
+
+	dao.client = client
+	dao.db = client.Database(dao.AppDatabase)
+	log.Println("Successfully connected to " + dao.AppDatabase)
+
+	return dao.ensureIndexes(ctx)
+}
+
+// Creates the indexes the queries below rely on. Creating an index that already exists is a no-op.
+func (dao *DAO) ensureIndexes(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	// Email uniqueness is enforced here rather than by checking before inserting
+	_, err := dao.db.Collection(dao.UserCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("email_unique").SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.ExpenseCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetName("userID_date"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.ExpenseCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "tags", Value: 1}},
+		Options: options.Index().SetName("userID_tags"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.CategoryCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userID", Value: 1}},
+		Options: options.Index().SetName("userID"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.BudgetCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userID", Value: 1}},
+		Options: options.Index().SetName("userID"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.GoalCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userID", Value: 1}},
+		Options: options.Index().SetName("userID"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.AccountCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userID", Value: 1}},
+		Options: options.Index().SetName("userID"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.ExpenseCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "ledgerID", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetName("ledgerID_date"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Only transfer entries have a transferID
+	_, err = dao.db.Collection(dao.ExpenseCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "transferID", Value: 1}},
+		Options: options.Index().SetName("transferID").SetSparse(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.RecurrenceCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userID", Value: 1}}, Options: options.Index().SetName("userID")},
+		{Keys: bson.D{{Key: "next", Value: 1}}, Options: options.Index().SetName("next")},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.LedgerCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "members.userID", Value: 1}},
+		Options: options.Index().SetName("members_userID"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.InviteCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("email")},
+		{Keys: bson.D{{Key: "ledgerID", Value: 1}}, Options: options.Index().SetName("ledgerID")},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Expired refresh tokens are deleted by MongoDB itself
+	_, err = dao.db.Collection(dao.RefreshCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "familyID", Value: 1}}, Options: options.Index().SetName("familyID")},
+		{Keys: bson.D{{Key: "userID", Value: 1}}, Options: options.Index().SetName("userID")},
+		{Keys: bson.D{{Key: "expires", Value: 1}}, Options: options.Index().SetName("expires").SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.RevokedCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires", Value: 1}},
+		Options: options.Index().SetName("expires").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Expired mailed tokens are deleted by MongoDB itself
+	_, err = dao.db.Collection(dao.UserTokenCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userID", Value: 1}, {Key: "purpose", Value: 1}}, Options: options.Index().SetName("userID_purpose")},
+		{Keys: bson.D{{Key: "expires", Value: 1}}, Options: options.Index().SetName("expires").SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.AttachmentCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expenseID", Value: 1}}, Options: options.Index().SetName("expenseID")},
+		{Keys: bson.D{{Key: "userID", Value: 1}}, Options: options.Index().SetName("userID")},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Println("Indexes are up to date")
+
+	return nil
+}
+
+// Disconnect - Closes every connection in the pool
+func (dao *DAO) Disconnect(ctx context.Context) error {
+	return dao.client.Disconnect(ctx)
+}
+
+// Migrate - Applies every migration that hasn't been recorded in schema_migrations yet.
+// Migrations are written to be idempotent, so two instances racing here is harmless.
+func (dao *DAO) Migrate(ctx context.Context) error {
+	applied := dao.db.Collection(migrationCollection)
+
+	for _, m := range mongoMigrations {
+		n, err := applied.CountDocuments(ctx, bson.M{"_id": m.Version})
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", m.Version, m.Description)
+		if err := m.Run(ctx, dao); err != nil {
+			return fmt.Errorf("migration %d: %s", m.Version, err)
+		}
+
+		_, err = applied.InsertOne(ctx, bson.M{"_id": m.Version, "description": m.Description, "appliedAt": time.Now().UTC()})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InsertUser - Inserts a user into the users collection
+func (dao *DAO) InsertUser(ctx context.Context, user model.User) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.UserCollection).InsertOne(ctx, &user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailInUse
+	}
+
+	return err
+}
+
+// FindUserByEmail - Runs a find on the users collection and returns the first user with the email
+func (dao *DAO) FindUserByEmail(ctx context.Context, email string) (model.User, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var user model.User
+
+	err := dao.db.Collection(dao.UserCollection).FindOne(ctx, bson.M{"email": email}).Decode(&user)
+
+	return user, mongoErr(err)
+}
+
+// UpdateUser - Replaces the user with the same email
+func (dao *DAO) UpdateUser(ctx context.Context, user model.User) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.UserCollection).ReplaceOne(ctx, bson.M{"email": user.Email}, &user)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveUserByEmail - Removes a user from the users collection
+func (dao *DAO) RemoveUserByEmail(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.UserCollection).DeleteOne(ctx, bson.M{"email": email})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UserExists - Checks whether a user is already using the provided email
+func (dao *DAO) UserExists(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	n, err := dao.db.Collection(dao.UserCollection).CountDocuments(ctx, bson.M{"email": email}, options.Count().SetLimit(1))
+	if err != nil {
+		return true, err
+	}
+
+	return n > 0, nil
+}
+
+// FindAllExpenses - Runs a find on the expenses collection
+// and returns all expense records relating to the user specified
+func (dao *DAO) FindAllExpenses(ctx context.Context, user string) ([]model.Expense, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.ExpenseCollection).Find(ctx, bson.M{"userID": user})
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeExpenses(ctx, cursor)
+}
+
+// FindExpenses - Returns one page of the user's expenses matching the query, and a cursor to the next page if any
+func (dao *DAO) FindExpenses(ctx context.Context, user string, q ExpenseQuery) ([]model.Expense, *Cursor, error) {
+	if err := q.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	filter, err := expenseFilter(user, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	field := q.sortField()
+	direction := 1
+	if q.Descending {
+		direction = -1
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}})
+	if q.Limit > 0 {
+		// One extra tells us whether there is another page
+		opts.SetLimit(int64(q.Limit) + 1)
+	}
+
+	cursor, err := dao.db.Collection(dao.ExpenseCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expenses, err := decodeExpenses(ctx, cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expenses, next := paginate(q, expenses)
+
+	return expenses, next, nil
+}
+
+// Translates a query into a MongoDB filter, including the keyset condition for the cursor
+func expenseFilter(user string, q ExpenseQuery) (bson.M, error) {
+	filter := bson.M{"userID": user}
+	if q.LedgerID != "" {
+		filter = bson.M{"ledgerID": q.LedgerID}
+	}
+	// Conditions that need an $or of their own are combined here
+	var and bson.A
+
+	date := bson.M{}
+	if !q.From.IsZero() {
+		date["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		date["$lt"] = q.To
+	}
+	if len(date) > 0 {
+		filter["date"] = date
+	}
+
+	price := bson.M{}
+	if q.MinPrice != nil {
+		price["$gte"] = *q.MinPrice
+	}
+	if q.MaxPrice != nil {
+		price["$lte"] = *q.MaxPrice
+	}
+	if len(price) > 0 {
+		filter["price"] = price
+	}
+
+	if len(q.Types) > 0 {
+		filter["type"] = bson.M{"$in": q.Types}
+	}
+	if q.IsSaving != nil {
+		filter["isSaving"] = *q.IsSaving
+	}
+	if q.Title != "" {
+		filter["title"] = bson.M{"$regex": regexp.QuoteMeta(q.Title), "$options": "i"}
+	}
+	if q.Icon != "" {
+		filter["icon"] = q.Icon
+	}
+	// Split expenses have no category of their own, their lines do
+	if q.CategoryID == NoCategory {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"categoryID": bson.M{"$in": bson.A{"", nil}}, "splits": bson.M{"$exists": false}},
+			bson.M{"splits.categoryID": ""},
+		}})
+	} else if q.CategoryID != "" {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"categoryID": q.CategoryID},
+			bson.M{"splits.categoryID": q.CategoryID},
+		}})
+	}
+
+	if q.GoalID != "" {
+		filter["goalID"] = q.GoalID
+	}
+	if q.AccountID != "" {
+		filter["accountID"] = q.AccountID
+	}
+	if q.TransferID != "" {
+		filter["transferID"] = q.TransferID
+	}
+	if len(q.Tags) > 0 {
+		if q.AllTags {
+			filter["tags"] = bson.M{"$all": q.Tags}
+		} else {
+			filter["tags"] = bson.M{"$in": q.Tags}
+		}
+	}
+
+	if q.After != nil {
+		id, err := bson.ObjectIDFromHex(q.After.ID)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		var value interface{}
+		switch q.sortField() {
+		case SortByPrice:
+			value = q.After.Price
+		case SortByTitle:
+			value = q.After.Title
+		default:
+			value = q.After.Date
+		}
+
+		op := "$gt"
+		if q.Descending {
+			op = "$lt"
+		}
+
+		field := q.sortField()
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{field: bson.M{op: value}},
+			bson.M{field: value, "_id": bson.M{op: id}},
+		}})
+	}
+
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+
+	return filter, nil
+}
+
+// FindExpenseByID - Runs a find on the expenses collection and returns the first expense with the id
+func (dao *DAO) FindExpenseByID(ctx context.Context, id string) (model.Expense, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	oid, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Expense{}, ErrNotFound
+	}
+
+	var doc expenseDocument
+	if err := dao.db.Collection(dao.ExpenseCollection).FindOne(ctx, bson.M{"_id": oid}).Decode(&doc); err != nil {
+		return model.Expense{}, mongoErr(err)
+	}
+
+	return doc.expense(), nil
+}
+
+// InsertExpense - Inserts an expense record into the expenses collection
+func (dao *DAO) InsertExpense(ctx context.Context, expense model.Expense) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	doc, err := newExpenseDocument(expense)
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.ExpenseCollection).InsertOne(ctx, &doc)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// InsertTransfer - Inserts both entries of a transfer. Without a transaction to lean on,
+// the outgoing entry is removed again if the incoming one can't be inserted.
+func (dao *DAO) InsertTransfer(ctx context.Context, out model.Expense, in model.Expense) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	outDoc, err := newExpenseDocument(out)
+	if err != nil {
+		return err
+	}
+	inDoc, err := newExpenseDocument(in)
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.ExpenseCollection).InsertMany(ctx, []interface{}{&outDoc, &inDoc})
+	if err == nil {
+		return nil
+	}
+
+	dao.db.Collection(dao.ExpenseCollection).DeleteMany(ctx, bson.M{"transferID": out.TransferID})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// RemoveExpenseByID - Removes an expense by id
+func (dao *DAO) RemoveExpenseByID(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	oid, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	res, err := dao.db.Collection(dao.ExpenseCollection).DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateExpense - Updates an expense record in the expenses collection
+func (dao *DAO) UpdateExpense(ctx context.Context, expense model.Expense) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	doc, err := newExpenseDocument(expense)
+	if err != nil {
+		return err
+	}
+
+	res, err := dao.db.Collection(dao.ExpenseCollection).ReplaceOne(ctx, bson.M{"_id": doc.ID}, &doc)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveTransfer - Removes both entries of a transfer
+func (dao *DAO) RemoveTransfer(ctx context.Context, transferID string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.ExpenseCollection).DeleteMany(ctx, bson.M{"transferID": transferID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveUserExpenses - Removes all expenses relating to a user
+func (dao *DAO) RemoveUserExpenses(ctx context.Context, email string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.ExpenseCollection).DeleteMany(ctx, bson.M{"userID": email})
+
+	return err
+}
+
+// ReassignExpenseCategory - Moves all of the user's expenses in one category to another
+func (dao *DAO) ReassignExpenseCategory(ctx context.Context, user string, from string, to string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.ExpenseCollection).UpdateMany(ctx,
+		bson.M{"userID": user, "categoryID": from}, bson.M{"$set": bson.M{"categoryID": to}})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.ExpenseCollection).UpdateMany(ctx,
+		bson.M{"userID": user, "splits.categoryID": from}, bson.M{"$set": bson.M{"splits.$[line].categoryID": to}},
+		options.UpdateMany().SetArrayFilters([]interface{}{bson.M{"line.categoryID": from}}))
+
+	return err
+}
+
+// ReassignExpenseGoal - Moves all of the user's savings linked to one goal to another
+func (dao *DAO) ReassignExpenseGoal(ctx context.Context, user string, from string, to string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.ExpenseCollection).UpdateMany(ctx,
+		bson.M{"userID": user, "goalID": from}, bson.M{"$set": bson.M{"goalID": to}})
+
+	return err
+}
+
+// TagCounts - Returns every tag the user has used and how many expenses carry it, ordered by tag
+func (dao *DAO) TagCounts(ctx context.Context, user string) ([]model.TagCount, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.ExpenseCollection).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userID": user}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []model.TagCount
+	err = cursor.All(ctx, &counts)
+
+	return counts, err
+}
+
+// ReplaceTag - Swaps one tag for another on all of the user's expenses carrying it
+func (dao *DAO) ReplaceTag(ctx context.Context, user string, from string, to string) (int, error) {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	collection := dao.db.Collection(dao.ExpenseCollection)
+	filter := bson.M{"userID": user, "tags": from}
+
+	// The same array can't be added to and pulled from in one update
+	_, err := collection.UpdateMany(ctx, filter, bson.M{"$addToSet": bson.M{"tags": to}})
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := collection.UpdateMany(ctx, filter, bson.M{"$pull": bson.M{"tags": from}})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(res.ModifiedCount), nil
+}
+
+// InsertCategory - Inserts a category into the categories collection
+func (dao *DAO) InsertCategory(ctx context.Context, category model.Category) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.CategoryCollection).InsertOne(ctx, &category)
+
+	return err
+}
+
+// FindCategories - Returns all of the user's categories
+func (dao *DAO) FindCategories(ctx context.Context, user string) ([]model.Category, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.CategoryCollection).Find(ctx, bson.M{"userID": user}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []model.Category
+	err = cursor.All(ctx, &categories)
+
+	return categories, err
+}
+
+// FindCategoryByID - Returns the category with the id
+func (dao *DAO) FindCategoryByID(ctx context.Context, id string) (model.Category, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var category model.Category
+
+	err := dao.db.Collection(dao.CategoryCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&category)
+
+	return category, mongoErr(err)
+}
+
+// UpdateCategory - Replaces the category with the same id
+func (dao *DAO) UpdateCategory(ctx context.Context, category model.Category) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.CategoryCollection).ReplaceOne(ctx, bson.M{"_id": category.ID}, &category)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveCategoryByID - Removes a category by id
+func (dao *DAO) RemoveCategoryByID(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.CategoryCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveUserCategories - Removes all categories relating to a user
+func (dao *DAO) RemoveUserCategories(ctx context.Context, user string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.CategoryCollection).DeleteMany(ctx, bson.M{"userID": user})
+
+	return err
+}
+
+// InsertBudget - Inserts a budget into the budgets collection
+func (dao *DAO) InsertBudget(ctx context.Context, budget model.Budget) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.BudgetCollection).InsertOne(ctx, &budget)
+
+	return err
+}
+
+// FindBudgets - Returns all of the user's budgets
+func (dao *DAO) FindBudgets(ctx context.Context, user string) ([]model.Budget, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.BudgetCollection).Find(ctx, bson.M{"userID": user}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var budgets []model.Budget
+	err = cursor.All(ctx, &budgets)
+
+	return budgets, err
+}
+
+// FindBudgetByID - Returns the budget with the id
+func (dao *DAO) FindBudgetByID(ctx context.Context, id string) (model.Budget, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var budget model.Budget
+
+	err := dao.db.Collection(dao.BudgetCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&budget)
+
+	return budget, mongoErr(err)
+}
+
+// UpdateBudget - Replaces the budget with the same id
+func (dao *DAO) UpdateBudget(ctx context.Context, budget model.Budget) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.BudgetCollection).ReplaceOne(ctx, bson.M{"_id": budget.ID}, &budget)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveBudgetByID - Removes a budget by id
+func (dao *DAO) RemoveBudgetByID(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.BudgetCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveUserBudgets - Removes all budgets relating to a user
+func (dao *DAO) RemoveUserBudgets(ctx context.Context, user string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.BudgetCollection).DeleteMany(ctx, bson.M{"userID": user})
+
+	return err
+}
+
+// InsertRecurrence - Inserts a recurring expense rule into the recurrences collection
+func (dao *DAO) InsertRecurrence(ctx context.Context, recurrence model.Recurrence) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.RecurrenceCollection).InsertOne(ctx, &recurrence)
+
+	return err
+}
+
+// FindRecurrences - Returns all of the user's recurring expense rules
+func (dao *DAO) FindRecurrences(ctx context.Context, user string) ([]model.Recurrence, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.RecurrenceCollection).Find(ctx, bson.M{"userID": user}, options.Find().SetSort(bson.D{{Key: "title", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var recurrences []model.Recurrence
+	err = cursor.All(ctx, &recurrences)
+
+	return recurrences, err
+}
+
+// FindRecurrenceByID - Returns the recurring expense rule with the id
+func (dao *DAO) FindRecurrenceByID(ctx context.Context, id string) (model.Recurrence, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var recurrence model.Recurrence
+
+	err := dao.db.Collection(dao.RecurrenceCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&recurrence)
+
+	return recurrence, mongoErr(err)
+}
+
+// UpdateRecurrence - Replaces the recurring expense rule with the same id
+func (dao *DAO) UpdateRecurrence(ctx context.Context, recurrence model.Recurrence) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.RecurrenceCollection).ReplaceOne(ctx, bson.M{"_id": recurrence.ID}, &recurrence)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveRecurrenceByID - Removes a recurring expense rule by id
+func (dao *DAO) RemoveRecurrenceByID(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.RecurrenceCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveUserRecurrences - Removes all recurring expense rules relating to a user
+func (dao *DAO) RemoveUserRecurrences(ctx context.Context, user string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.RecurrenceCollection).DeleteMany(ctx, bson.M{"userID": user})
+
+	return err
+}
+
+// FindDueRecurrences - Returns every rule whose next occurrence is at or before now
+func (dao *DAO) FindDueRecurrences(ctx context.Context, now time.Time) ([]model.Recurrence, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	// Ended rules have a null next, which $lte never matches
+	cursor, err := dao.db.Collection(dao.RecurrenceCollection).Find(ctx, bson.M{"next": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, err
+	}
+
+	var recurrences []model.Recurrence
+	err = cursor.All(ctx, &recurrences)
+
+	return recurrences, err
+}
+
+// AdvanceRecurrence - Sets the next occurrence of the rule, provided it is still from
+func (dao *DAO) AdvanceRecurrence(ctx context.Context, id string, from model.Date, to model.Date) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.RecurrenceCollection).UpdateOne(ctx,
+		bson.M{"_id": id, "next": from}, bson.M{"$set": bson.M{"next": to}})
+
+	return err
+}
+
+// InsertGoal - Inserts a savings goal into the goals collection
+func (dao *DAO) InsertGoal(ctx context.Context, goal model.SavingsGoal) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.GoalCollection).InsertOne(ctx, &goal)
+
+	return err
+}
+
+// FindGoals - Returns all of the user's savings goals
+func (dao *DAO) FindGoals(ctx context.Context, user string) ([]model.SavingsGoal, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.GoalCollection).Find(ctx, bson.M{"userID": user}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var goals []model.SavingsGoal
+	err = cursor.All(ctx, &goals)
+
+	return goals, err
+}
+
+// FindGoalByID - Returns the savings goal with the id
+func (dao *DAO) FindGoalByID(ctx context.Context, id string) (model.SavingsGoal, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var goal model.SavingsGoal
+
+	err := dao.db.Collection(dao.GoalCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&goal)
+
+	return goal, mongoErr(err)
+}
+
+// UpdateGoal - Replaces the savings goal with the same id
+func (dao *DAO) UpdateGoal(ctx context.Context, goal model.SavingsGoal) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.GoalCollection).ReplaceOne(ctx, bson.M{"_id": goal.ID}, &goal)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveGoalByID - Removes a savings goal by id
+func (dao *DAO) RemoveGoalByID(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.GoalCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveUserGoals - Removes all savings goals relating to a user
+func (dao *DAO) RemoveUserGoals(ctx context.Context, user string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.GoalCollection).DeleteMany(ctx, bson.M{"userID": user})
+
+	return err
+}
+
+// InsertAccount - Inserts an account into the accounts collection
+func (dao *DAO) InsertAccount(ctx context.Context, account model.Account) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.AccountCollection).InsertOne(ctx, &account)
+
+	return err
+}
+
+// FindAccounts - Returns all of the user's accounts
+func (dao *DAO) FindAccounts(ctx context.Context, user string) ([]model.Account, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.AccountCollection).Find(ctx, bson.M{"userID": user}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []model.Account
+	err = cursor.All(ctx, &accounts)
+
+	return accounts, err
+}
+
+// FindAccountByID - Returns the account with the id
+func (dao *DAO) FindAccountByID(ctx context.Context, id string) (model.Account, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var account model.Account
+
+	err := dao.db.Collection(dao.AccountCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&account)
+
+	return account, mongoErr(err)
+}
+
+// UpdateAccount - Replaces the account with the same id
+func (dao *DAO) UpdateAccount(ctx context.Context, account model.Account) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.AccountCollection).ReplaceOne(ctx, bson.M{"_id": account.ID}, &account)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveAccountByID - Removes an account by id
+func (dao *DAO) RemoveAccountByID(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.AccountCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveUserAccounts - Removes all accounts relating to a user
+func (dao *DAO) RemoveUserAccounts(ctx context.Context, user string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.AccountCollection).DeleteMany(ctx, bson.M{"userID": user})
+
+	return err
+}
+
+// InsertLedger - Inserts a ledger with its members
+func (dao *DAO) InsertLedger(ctx context.Context, ledger model.Ledger) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.LedgerCollection).InsertOne(ctx, &ledger)
+
+	return err
+}
+
+// FindLedgers - Returns the ledgers the user is a member of
+func (dao *DAO) FindLedgers(ctx context.Context, user string) ([]model.Ledger, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.LedgerCollection).Find(ctx, bson.M{"members.userID": user}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var ledgers []model.Ledger
+	err = cursor.All(ctx, &ledgers)
+
+	return ledgers, err
+}
+
+// FindLedgerByID - Returns the ledger with the id
+func (dao *DAO) FindLedgerByID(ctx context.Context, id string) (model.Ledger, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var ledger model.Ledger
+
+	err := dao.db.Collection(dao.LedgerCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&ledger)
+
+	return ledger, mongoErr(err)
+}
+
+// UpdateLedger - Renames the ledger with the same id
+func (dao *DAO) UpdateLedger(ctx context.Context, ledger model.Ledger) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.LedgerCollection).UpdateOne(ctx, bson.M{"_id": ledger.ID}, bson.M{"$set": bson.M{"name": ledger.Name}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveLedgerByID - Removes a ledger with its invites, making its expenses private again
+func (dao *DAO) RemoveLedgerByID(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	return dao.removeLedger(ctx, id)
+}
+
+// SetLedgerMember - Adds the member to the ledger or changes their role
+func (dao *DAO) SetLedgerMember(ctx context.Context, ledgerID string, member model.LedgerMember) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	ledgers := dao.db.Collection(dao.LedgerCollection)
+
+	res, err := ledgers.UpdateOne(ctx, bson.M{"_id": ledgerID, "members.userID": member.UserID},
+		bson.M{"$set": bson.M{"members.$.role": member.Role}})
+	if err != nil || res.MatchedCount > 0 {
+		return err
+	}
+
+	// Not a member yet. The condition stops a member added in between from being added twice.
+	res, err = ledgers.UpdateOne(ctx, bson.M{"_id": ledgerID, "members.userID": bson.M{"$ne": member.UserID}},
+		bson.M{"$push": bson.M{"members": member}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveLedgerMember - Takes the user out of the ledger
+func (dao *DAO) RemoveLedgerMember(ctx context.Context, ledgerID string, user string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.LedgerCollection).UpdateOne(ctx, bson.M{"_id": ledgerID, "members.userID": user},
+		bson.M{"$pull": bson.M{"members": bson.M{"userID": user}}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveUserLedgers - Removes the ledgers the user owns, their memberships and the invites sent to them
+func (dao *DAO) RemoveUserLedgers(ctx context.Context, user string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	ledgers := dao.db.Collection(dao.LedgerCollection)
+
+	cursor, err := ledgers.Find(ctx, bson.M{"members": bson.M{"$elemMatch": bson.M{"userID": user, "role": model.RoleOwner}}})
+	if err != nil {
+		return err
+	}
+
+	var owned []model.Ledger
+	if err := cursor.All(ctx, &owned); err != nil {
+		return err
+	}
+
+	for _, ledger := range owned {
+		if err := dao.removeLedger(ctx, ledger.ID); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+
+	_, err = ledgers.UpdateMany(ctx, bson.M{"members.userID": user}, bson.M{"$pull": bson.M{"members": bson.M{"userID": user}}})
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.InviteCollection).DeleteMany(ctx, bson.M{"email": user})
+
+	return err
+}
+
+// InsertInvite - Inserts a ledger invite
+func (dao *DAO) InsertInvite(ctx context.Context, invite model.LedgerInvite) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.InviteCollection).InsertOne(ctx, &invite)
+
+	return err
+}
+
+// FindInvites - Returns the invites sent to the email, oldest first
+func (dao *DAO) FindInvites(ctx context.Context, email string) ([]model.LedgerInvite, error) {
+	return dao.findInvites(ctx, bson.M{"email": email})
+}
+
+// FindLedgerInvites - Returns the ledger's pending invites, oldest first
+func (dao *DAO) FindLedgerInvites(ctx context.Context, ledgerID string) ([]model.LedgerInvite, error) {
+	return dao.findInvites(ctx, bson.M{"ledgerID": ledgerID})
+}
+
+// FindInviteByID - Returns the invite with the id
+func (dao *DAO) FindInviteByID(ctx context.Context, id string) (model.LedgerInvite, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var invite model.LedgerInvite
+
+	err := dao.db.Collection(dao.InviteCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&invite)
+
+	return invite, mongoErr(err)
+}
+
+// RemoveInviteByID - Removes an invite by id
+func (dao *DAO) RemoveInviteByID(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.InviteCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (dao *DAO) findInvites(ctx context.Context, filter bson.M) ([]model.LedgerInvite, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.InviteCollection).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var invites []model.LedgerInvite
+	err = cursor.All(ctx, &invites)
+
+	return invites, err
+}
+
+// InsertAttachment - Inserts an attachment
+func (dao *DAO) InsertAttachment(ctx context.Context, attachment model.Attachment) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.AttachmentCollection).InsertOne(ctx, &attachment)
+
+	return err
+}
+
+// FindAttachments - Returns the expense's attachments, oldest first
+func (dao *DAO) FindAttachments(ctx context.Context, expenseID string) ([]model.Attachment, error) {
+	return dao.findAttachments(ctx, bson.M{"expenseID": expenseID})
+}
+
+// FindUserAttachments - Returns the attachments of every expense the user recorded, oldest first
+func (dao *DAO) FindUserAttachments(ctx context.Context, user string) ([]model.Attachment, error) {
+	return dao.findAttachments(ctx, bson.M{"userID": user})
+}
+
+// FindAttachmentByID - Returns the attachment with the id
+func (dao *DAO) FindAttachmentByID(ctx context.Context, id string) (model.Attachment, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var attachment model.Attachment
+
+	err := dao.db.Collection(dao.AttachmentCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&attachment)
+
+	return attachment, mongoErr(err)
+}
+
+// RemoveAttachmentByID - Removes an attachment by id
+func (dao *DAO) RemoveAttachmentByID(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.AttachmentCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveExpenseAttachments - Removes all attachments of an expense
+func (dao *DAO) RemoveExpenseAttachments(ctx context.Context, expenseID string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.AttachmentCollection).DeleteMany(ctx, bson.M{"expenseID": expenseID})
+
+	return err
+}
+
+// RemoveUserAttachments - Removes the attachments of every expense the user recorded
+func (dao *DAO) RemoveUserAttachments(ctx context.Context, user string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.AttachmentCollection).DeleteMany(ctx, bson.M{"userID": user})
+
+	return err
+}
+
+func (dao *DAO) findAttachments(ctx context.Context, filter bson.M) ([]model.Attachment, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.AttachmentCollection).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var attachments []model.Attachment
+	err = cursor.All(ctx, &attachments)
+
+	return attachments, err
+}
+
+// InsertRefreshToken - Inserts a refresh token
+func (dao *DAO) InsertRefreshToken(ctx context.Context, token model.RefreshToken) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.RefreshCollection).InsertOne(ctx, &token)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// FindRefreshToken - Returns the refresh token with the id
+func (dao *DAO) FindRefreshToken(ctx context.Context, id string) (model.RefreshToken, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var token model.RefreshToken
+
+	err := dao.db.Collection(dao.RefreshCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&token)
+
+	return token, mongoErr(err)
+}
+
+// UseRefreshToken - Marks the refresh token exchanged, unless it already was
+func (dao *DAO) UseRefreshToken(ctx context.Context, id string, at time.Time) error {
+	writeCtx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	res, err := dao.db.Collection(dao.RefreshCollection).UpdateOne(writeCtx,
+		bson.M{"_id": id, "used": time.Time{}}, bson.M{"$set": bson.M{"used": at.UTC()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	if _, err := dao.FindRefreshToken(ctx, id); err != nil {
+		return err
+	}
+
+	return ErrTokenUsed
+}
+
+// RemoveTokenFamily - Removes every refresh token in the family
+func (dao *DAO) RemoveTokenFamily(ctx context.Context, familyID string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.RefreshCollection).DeleteMany(ctx, bson.M{"familyID": familyID})
+
+	return err
+}
+
+// RemoveUserRefreshTokens - Removes all of a user's refresh tokens
+func (dao *DAO) RemoveUserRefreshTokens(ctx context.Context, user string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.RefreshCollection).DeleteMany(ctx, bson.M{"userID": user})
+
+	return err
+}
+
+// FindTokenFamilies - Returns the logins the user still holds refresh tokens for
+func (dao *DAO) FindTokenFamilies(ctx context.Context, user string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	var families []string
+	err := dao.db.Collection(dao.RefreshCollection).Distinct(ctx, "familyID", bson.M{"userID": user}).Decode(&families)
+
+	return families, err
+}
+
+// InsertUserToken - Inserts a mailed token
+func (dao *DAO) InsertUserToken(ctx context.Context, token model.UserToken) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.UserTokenCollection).InsertOne(ctx, &token)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// FindUserTokens - Returns the user's tokens for the purpose, oldest first
+func (dao *DAO) FindUserTokens(ctx context.Context, user string, purpose string) ([]model.UserToken, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	cursor, err := dao.db.Collection(dao.UserTokenCollection).Find(ctx, bson.M{"userID": user, "purpose": purpose},
+		options.Find().SetSort(bson.D{{Key: "created", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []model.UserToken
+	err = cursor.All(ctx, &tokens)
+
+	return tokens, err
+}
+
+// ConsumeUserToken - Removes the token for the purpose and returns it
+func (dao *DAO) ConsumeUserToken(ctx context.Context, id string, purpose string) (model.UserToken, error) {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	var token model.UserToken
+
+	err := dao.db.Collection(dao.UserTokenCollection).FindOneAndDelete(ctx, bson.M{"_id": id, "purpose": purpose}).Decode(&token)
+
+	return token, mongoErr(err)
+}
+
+// RemoveUserTokens - Removes the user's tokens for the purpose, or all of them when it is empty
+func (dao *DAO) RemoveUserTokens(ctx context.Context, user string, purpose string) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	filter := bson.M{"userID": user}
+	if purpose != "" {
+		filter["purpose"] = purpose
+	}
+
+	_, err := dao.db.Collection(dao.UserTokenCollection).DeleteMany(ctx, filter)
+
+	return err
+}
+
+// RevokeToken - Revokes the token or login family with the id until it expires.
+// MongoDB deletes the revocation once it has expired.
+func (dao *DAO) RevokeToken(ctx context.Context, id string, expires time.Time) error {
+	ctx, cancel := withTimeout(ctx, dao.WriteTimeout)
+	defer cancel()
+
+	_, err := dao.db.Collection(dao.RevokedCollection).UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$max": bson.M{"expires": expires.UTC()}}, options.UpdateOne().SetUpsert(true))
+
+	return err
+}
+
+// TokenRevoked - Reports whether any of the ids has been revoked and not yet expired
+func (dao *DAO) TokenRevoked(ctx context.Context, ids ...string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, dao.ReadTimeout)
+	defer cancel()
+
+	// The TTL monitor only runs every minute, so expiry is checked here too
+	n, err := dao.db.Collection(dao.RevokedCollection).CountDocuments(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "expires": bson.M{"$gt": time.Now().UTC()}})
+
+	return n > 0, err
+}
+
+// Deletes the ledger, then its invites, and moves its expenses back to whoever recorded them
+func (dao *DAO) removeLedger(ctx context.Context, id string) error {
+	res, err := dao.db.Collection(dao.LedgerCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := dao.db.Collection(dao.InviteCollection).DeleteMany(ctx, bson.M{"ledgerID": id}); err != nil {
+		return err
+	}
+
+	_, err = dao.db.Collection(dao.ExpenseCollection).UpdateMany(ctx, bson.M{"ledgerID": id}, bson.M{"$unset": bson.M{"ledgerID": ""}})
+
+	return err
+}
+
+// Drains a cursor of expense documents into model expenses
+func decodeExpenses(ctx context.Context, cursor *mongo.Cursor) ([]model.Expense, error) {
+	var docs []expenseDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	var expenses []model.Expense
+	for _, doc := range docs {
+		expenses = append(expenses, doc.expense())
+	}
+
+	return expenses, nil
+}
+
+// Derives a context bounded by the configured timeout, a zero timeout leaves ctx untouched
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Translates driver errors into the storage-agnostic errors of this package
+func mongoErr(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,17 @@
+package dao
+
+import (
+	"errors"
+)
+
+// ErrNotFound - Returned by every backend when the requested record doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrDuplicate - Returned when inserting a record whose ID is already taken
+var ErrDuplicate = errors.New("Record already exists")
+
+// ErrEmailInUse - Returned when inserting a user whose email is already registered
+var ErrEmailInUse = errors.New("Email address already in use by another user")
+
+// ErrTokenUsed - Returned when exchanging a refresh token that has already been exchanged
+var ErrTokenUsed = errors.New("Refresh token has already been used")
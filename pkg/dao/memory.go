@@ -0,0 +1,1464 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// MemoryStore - Thread-safe in-memory implementation of Store.
+// Nothing is persisted, which makes it useful for local development and CI.
+type MemoryStore struct {
+	*MemoryRevocations
+
+	mu          sync.RWMutex
+	users       map[string]model.User
+	expenses    []model.Expense
+	categories  []model.Category
+	budgets     []model.Budget
+	recurrences []model.Recurrence
+	goals       []model.SavingsGoal
+	accounts    []model.Account
+	ledgers     []model.Ledger
+	invites     []model.LedgerInvite
+	attachments []model.Attachment
+	refresh     map[string]model.RefreshToken
+	userTokens  map[string]model.UserToken
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore - Returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		MemoryRevocations: NewMemoryRevocations(),
+
+		users:      make(map[string]model.User),
+		refresh:    make(map[string]model.RefreshToken),
+		userTokens: make(map[string]model.UserToken),
+	}
+}
+
+// InsertUser - Inserts a user, rejecting emails that are already registered
+func (m *MemoryStore) InsertUser(ctx context.Context, user model.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.Email]; ok {
+		return ErrEmailInUse
+	}
+
+	m.users[user.Email] = user
+
+	return nil
+}
+
+// FindUserByEmail - Returns the user with the email
+func (m *MemoryStore) FindUserByEmail(ctx context.Context, email string) (model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[email]
+	if !ok {
+		return model.User{}, ErrNotFound
+	}
+
+	return user, nil
+}
+
+// UpdateUser - Replaces the user with the same email
+func (m *MemoryStore) UpdateUser(ctx context.Context, user model.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.Email]; !ok {
+		return ErrNotFound
+	}
+
+	m.users[user.Email] = user
+
+	return nil
+}
+
+// RemoveUserByEmail - Removes the user with the email
+func (m *MemoryStore) RemoveUserByEmail(ctx context.Context, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[email]; !ok {
+		return ErrNotFound
+	}
+
+	delete(m.users, email)
+
+	return nil
+}
+
+// UserExists - Checks whether a user is already using the provided email
+func (m *MemoryStore) UserExists(ctx context.Context, email string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.users[email]
+
+	return ok, nil
+}
+
+// FindAllExpenses - Returns all expense records relating to the user specified, in insertion order
+func (m *MemoryStore) FindAllExpenses(ctx context.Context, user string) ([]model.Expense, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var expenses []model.Expense
+	for _, expense := range m.expenses {
+		if expense.UserID == user {
+			expenses = append(expenses, expense)
+		}
+	}
+
+	return expenses, nil
+}
+
+// FindExpenses - Returns one page of the user's expenses matching the query, and a cursor to the next page if any
+func (m *MemoryStore) FindExpenses(ctx context.Context, user string, q ExpenseQuery) ([]model.Expense, *Cursor, error) {
+	if err := q.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var expenses []model.Expense
+	for _, expense := range m.expenses {
+		if inScope(q, user, expense) && matchesQuery(q, expense) {
+			expenses = append(expenses, expense)
+		}
+	}
+
+	sort.SliceStable(expenses, func(i, j int) bool {
+		return compareExpenses(q, expenses[i], newCursor(q, expenses[j])) < 0
+	})
+
+	if q.After != nil {
+		i := 0
+		for i < len(expenses) && compareExpenses(q, expenses[i], q.After) <= 0 {
+			i++
+		}
+		expenses = expenses[i:]
+	}
+
+	expenses, next := paginate(q, expenses)
+
+	return expenses, next, nil
+}
+
+// Whether the expense is in the ledger asked for, or recorded by the user when there is none
+func inScope(q ExpenseQuery, user string, expense model.Expense) bool {
+	if q.LedgerID != "" {
+		return expense.LedgerID == q.LedgerID
+	}
+
+	return expense.UserID == user
+}
+
+// Applies the filters of the query, everything except the cursor
+func matchesQuery(q ExpenseQuery, expense model.Expense) bool {
+	switch {
+	case !q.From.IsZero() && expense.Date.Before(q.From):
+		return false
+	case !q.To.IsZero() && !expense.Date.Before(q.To):
+		return false
+	case len(q.Types) > 0 && !containsString(q.Types, expense.Type):
+		return false
+	case q.IsSaving != nil && expense.IsSaving != *q.IsSaving:
+		return false
+	case q.Title != "" && !strings.Contains(strings.ToLower(expense.Title), strings.ToLower(q.Title)):
+		return false
+	case q.MinPrice != nil && expense.Price < *q.MinPrice:
+		return false
+	case q.MaxPrice != nil && expense.Price > *q.MaxPrice:
+		return false
+	case q.Icon != "" && expense.Icon != q.Icon:
+		return false
+	case q.CategoryID != "" && !matchesCategory(q, expense):
+		return false
+	case len(q.Tags) > 0 && !matchesTags(q, expense.Tags):
+		return false
+	case q.GoalID != "" && expense.GoalID != q.GoalID:
+		return false
+	case q.AccountID != "" && expense.AccountID != q.AccountID:
+		return false
+	case q.TransferID != "" && expense.TransferID != q.TransferID:
+		return false
+	}
+
+	return true
+}
+
+// Whether any line of the expense is in the category asked for, or has no category for NoCategory
+func matchesCategory(q ExpenseQuery, expense model.Expense) bool {
+	category := q.CategoryID
+	if category == NoCategory {
+		category = ""
+	}
+
+	for _, line := range expense.Lines() {
+		if line.CategoryID == category {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether the tags satisfy the any or all tag filter of the query
+func matchesTags(q ExpenseQuery, tags []string) bool {
+	found := 0
+	for _, tag := range q.Tags {
+		if containsString(tags, tag) {
+			found++
+		}
+	}
+
+	if q.AllTags {
+		return found == len(q.Tags)
+	}
+
+	return found > 0
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Orders an expense against a cursor position in the query's ordering: negative means it comes first
+func compareExpenses(q ExpenseQuery, expense model.Expense, c *Cursor) int {
+	var n int
+
+	switch q.sortField() {
+	case SortByPrice:
+		n = compareInt64(int64(expense.Price), int64(c.Price))
+	case SortByTitle:
+		n = strings.Compare(expense.Title, c.Title)
+	default:
+		n = compareTimes(expense.Date.Time, c.Date)
+	}
+
+	if n == 0 {
+		n = strings.Compare(expense.ID, c.ID)
+	}
+
+	if q.Descending {
+		return -n
+	}
+
+	return n
+}
+
+func compareTimes(a time.Time, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+
+	return 0
+}
+
+func compareInt64(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// FindExpenseByID - Returns the expense with the id
+func (m *MemoryStore) FindExpenseByID(ctx context.Context, id string) (model.Expense, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.indexOfExpense(id)
+	if i < 0 {
+		return model.Expense{}, ErrNotFound
+	}
+
+	return m.expenses[i], nil
+}
+
+// InsertExpense - Inserts an expense record
+func (m *MemoryStore) InsertExpense(ctx context.Context, expense model.Expense) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.indexOfExpense(expense.ID) >= 0 {
+		return ErrDuplicate
+	}
+
+	m.expenses = append(m.expenses, expense)
+
+	return nil
+}
+
+// InsertTransfer - Inserts both entries of a transfer, or neither
+func (m *MemoryStore) InsertTransfer(ctx context.Context, out model.Expense, in model.Expense) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.indexOfExpense(out.ID) >= 0 || m.indexOfExpense(in.ID) >= 0 {
+		return ErrDuplicate
+	}
+
+	m.expenses = append(m.expenses, out, in)
+
+	return nil
+}
+
+// UpdateExpense - Replaces the expense record with the same id
+func (m *MemoryStore) UpdateExpense(ctx context.Context, expense model.Expense) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOfExpense(expense.ID)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	m.expenses[i] = expense
+
+	return nil
+}
+
+// RemoveExpenseByID - Removes an expense by id
+func (m *MemoryStore) RemoveExpenseByID(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOfExpense(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	m.expenses = append(m.expenses[:i], m.expenses[i+1:]...)
+
+	return nil
+}
+
+// RemoveTransfer - Removes both entries of a transfer
+func (m *MemoryStore) RemoveTransfer(ctx context.Context, transferID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.expenses[:0]
+	for _, expense := range m.expenses {
+		if expense.TransferID != transferID {
+			kept = append(kept, expense)
+		}
+	}
+	if len(kept) == len(m.expenses) {
+		return ErrNotFound
+	}
+	m.expenses = kept
+
+	return nil
+}
+
+// RemoveUserExpenses - Removes all expenses relating to a user
+func (m *MemoryStore) RemoveUserExpenses(ctx context.Context, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.expenses[:0]
+	for _, expense := range m.expenses {
+		if expense.UserID != email {
+			kept = append(kept, expense)
+		}
+	}
+	m.expenses = kept
+
+	return nil
+}
+
+// ReassignExpenseCategory - Moves all of the user's expenses in one category to another
+func (m *MemoryStore) ReassignExpenseCategory(ctx context.Context, user string, from string, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, expense := range m.expenses {
+		if expense.UserID != user {
+			continue
+		}
+		if expense.CategoryID == from {
+			m.expenses[i].CategoryID = to
+		}
+
+		// Split lines are copied before changing them, callers may still hold the old slice
+		var splits []model.Split
+		for j, line := range expense.Splits {
+			if line.CategoryID != from {
+				continue
+			}
+			if splits == nil {
+				splits = append([]model.Split(nil), expense.Splits...)
+			}
+			splits[j].CategoryID = to
+		}
+		if splits != nil {
+			m.expenses[i].Splits = splits
+		}
+	}
+
+	return nil
+}
+
+// ReassignExpenseGoal - Moves all of the user's savings linked to one goal to another
+func (m *MemoryStore) ReassignExpenseGoal(ctx context.Context, user string, from string, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, expense := range m.expenses {
+		if expense.UserID == user && expense.GoalID == from {
+			m.expenses[i].GoalID = to
+		}
+	}
+
+	return nil
+}
+
+// TagCounts - Returns every tag the user has used and how many expenses carry it, ordered by tag
+func (m *MemoryStore) TagCounts(ctx context.Context, user string) ([]model.TagCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	index := make(map[string]int)
+	var counts []model.TagCount
+
+	for _, expense := range m.expenses {
+		if expense.UserID != user {
+			continue
+		}
+		for _, tag := range expense.Tags {
+			i, ok := index[tag]
+			if !ok {
+				i = len(counts)
+				index[tag] = i
+				counts = append(counts, model.TagCount{Tag: tag})
+			}
+			counts[i].Count++
+		}
+	}
+
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Tag < counts[j].Tag })
+
+	return counts, nil
+}
+
+// ReplaceTag - Swaps one tag for another on all of the user's expenses carrying it
+func (m *MemoryStore) ReplaceTag(ctx context.Context, user string, from string, to string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := 0
+	for i, expense := range m.expenses {
+		if expense.UserID != user || !containsString(expense.Tags, from) {
+			continue
+		}
+
+		// Build a new slice, the old one may still be held by a caller
+		tags := []string{to}
+		for _, tag := range expense.Tags {
+			if tag != from && tag != to {
+				tags = append(tags, tag)
+			}
+		}
+		sort.Strings(tags)
+
+		m.expenses[i].Tags = tags
+		changed++
+	}
+
+	return changed, nil
+}
+
+// InsertCategory - Inserts a category
+func (m *MemoryStore) InsertCategory(ctx context.Context, category model.Category) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.categories = append(m.categories, category)
+
+	return nil
+}
+
+// FindCategories - Returns all of the user's categories, ordered by name
+func (m *MemoryStore) FindCategories(ctx context.Context, user string) ([]model.Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var categories []model.Category
+	for _, category := range m.categories {
+		if category.UserID == user {
+			categories = append(categories, category)
+		}
+	}
+
+	sort.SliceStable(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+
+	return categories, nil
+}
+
+// FindCategoryByID - Returns the category with the id
+func (m *MemoryStore) FindCategoryByID(ctx context.Context, id string) (model.Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, category := range m.categories {
+		if category.ID == id {
+			return category, nil
+		}
+	}
+
+	return model.Category{}, ErrNotFound
+}
+
+// UpdateCategory - Replaces the category with the same id
+func (m *MemoryStore) UpdateCategory(ctx context.Context, category model.Category) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.categories {
+		if m.categories[i].ID == category.ID {
+			m.categories[i] = category
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveCategoryByID - Removes a category by id
+func (m *MemoryStore) RemoveCategoryByID(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.categories {
+		if m.categories[i].ID == id {
+			m.categories = append(m.categories[:i], m.categories[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveUserCategories - Removes all categories relating to a user
+func (m *MemoryStore) RemoveUserCategories(ctx context.Context, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.categories[:0]
+	for _, category := range m.categories {
+		if category.UserID != user {
+			kept = append(kept, category)
+		}
+	}
+	m.categories = kept
+
+	return nil
+}
+
+// InsertBudget - Inserts a budget
+func (m *MemoryStore) InsertBudget(ctx context.Context, budget model.Budget) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.budgets = append(m.budgets, budget)
+
+	return nil
+}
+
+// FindBudgets - Returns all of the user's budgets, ordered by name
+func (m *MemoryStore) FindBudgets(ctx context.Context, user string) ([]model.Budget, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var budgets []model.Budget
+	for _, budget := range m.budgets {
+		if budget.UserID == user {
+			budgets = append(budgets, budget)
+		}
+	}
+
+	sort.SliceStable(budgets, func(i, j int) bool { return budgets[i].Name < budgets[j].Name })
+
+	return budgets, nil
+}
+
+// FindBudgetByID - Returns the budget with the id
+func (m *MemoryStore) FindBudgetByID(ctx context.Context, id string) (model.Budget, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, budget := range m.budgets {
+		if budget.ID == id {
+			return budget, nil
+		}
+	}
+
+	return model.Budget{}, ErrNotFound
+}
+
+// UpdateBudget - Replaces the budget with the same id
+func (m *MemoryStore) UpdateBudget(ctx context.Context, budget model.Budget) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.budgets {
+		if m.budgets[i].ID == budget.ID {
+			m.budgets[i] = budget
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveBudgetByID - Removes a budget by id
+func (m *MemoryStore) RemoveBudgetByID(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.budgets {
+		if m.budgets[i].ID == id {
+			m.budgets = append(m.budgets[:i], m.budgets[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveUserBudgets - Removes all budgets relating to a user
+func (m *MemoryStore) RemoveUserBudgets(ctx context.Context, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.budgets[:0]
+	for _, budget := range m.budgets {
+		if budget.UserID != user {
+			kept = append(kept, budget)
+		}
+	}
+	m.budgets = kept
+
+	return nil
+}
+
+// InsertRecurrence - Inserts a recurring expense rule
+func (m *MemoryStore) InsertRecurrence(ctx context.Context, recurrence model.Recurrence) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.recurrences = append(m.recurrences, recurrence)
+
+	return nil
+}
+
+// FindRecurrences - Returns all of the user's recurring expense rules, ordered by title
+func (m *MemoryStore) FindRecurrences(ctx context.Context, user string) ([]model.Recurrence, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var recurrences []model.Recurrence
+	for _, recurrence := range m.recurrences {
+		if recurrence.UserID == user {
+			recurrences = append(recurrences, recurrence)
+		}
+	}
+
+	sort.SliceStable(recurrences, func(i, j int) bool { return recurrences[i].Title < recurrences[j].Title })
+
+	return recurrences, nil
+}
+
+// FindRecurrenceByID - Returns the recurring expense rule with the id
+func (m *MemoryStore) FindRecurrenceByID(ctx context.Context, id string) (model.Recurrence, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, recurrence := range m.recurrences {
+		if recurrence.ID == id {
+			return recurrence, nil
+		}
+	}
+
+	return model.Recurrence{}, ErrNotFound
+}
+
+// UpdateRecurrence - Replaces the recurring expense rule with the same id
+func (m *MemoryStore) UpdateRecurrence(ctx context.Context, recurrence model.Recurrence) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.recurrences {
+		if m.recurrences[i].ID == recurrence.ID {
+			m.recurrences[i] = recurrence
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveRecurrenceByID - Removes a recurring expense rule by id
+func (m *MemoryStore) RemoveRecurrenceByID(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.recurrences {
+		if m.recurrences[i].ID == id {
+			m.recurrences = append(m.recurrences[:i], m.recurrences[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveUserRecurrences - Removes all recurring expense rules relating to a user
+func (m *MemoryStore) RemoveUserRecurrences(ctx context.Context, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.recurrences[:0]
+	for _, recurrence := range m.recurrences {
+		if recurrence.UserID != user {
+			kept = append(kept, recurrence)
+		}
+	}
+	m.recurrences = kept
+
+	return nil
+}
+
+// FindDueRecurrences - Returns every rule whose next occurrence is at or before now
+func (m *MemoryStore) FindDueRecurrences(ctx context.Context, now time.Time) ([]model.Recurrence, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var due []model.Recurrence
+	for _, recurrence := range m.recurrences {
+		if !recurrence.Next.IsZero() && !recurrence.Next.After(now) {
+			due = append(due, recurrence)
+		}
+	}
+
+	return due, nil
+}
+
+// AdvanceRecurrence - Sets the next occurrence of the rule, provided it is still from
+func (m *MemoryStore) AdvanceRecurrence(ctx context.Context, id string, from model.Date, to model.Date) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.recurrences {
+		if m.recurrences[i].ID == id && m.recurrences[i].Next.Equal(from.Time) {
+			m.recurrences[i].Next = to
+		}
+	}
+
+	return nil
+}
+
+// InsertGoal - Inserts a savings goal
+func (m *MemoryStore) InsertGoal(ctx context.Context, goal model.SavingsGoal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.goals = append(m.goals, goal)
+
+	return nil
+}
+
+// FindGoals - Returns all of the user's savings goals, ordered by name
+func (m *MemoryStore) FindGoals(ctx context.Context, user string) ([]model.SavingsGoal, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var goals []model.SavingsGoal
+	for _, goal := range m.goals {
+		if goal.UserID == user {
+			goals = append(goals, goal)
+		}
+	}
+
+	sort.SliceStable(goals, func(i, j int) bool { return goals[i].Name < goals[j].Name })
+
+	return goals, nil
+}
+
+// FindGoalByID - Returns the savings goal with the id
+func (m *MemoryStore) FindGoalByID(ctx context.Context, id string) (model.SavingsGoal, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, goal := range m.goals {
+		if goal.ID == id {
+			return goal, nil
+		}
+	}
+
+	return model.SavingsGoal{}, ErrNotFound
+}
+
+// UpdateGoal - Replaces the savings goal with the same id
+func (m *MemoryStore) UpdateGoal(ctx context.Context, goal model.SavingsGoal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.goals {
+		if m.goals[i].ID == goal.ID {
+			m.goals[i] = goal
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveGoalByID - Removes a savings goal by id
+func (m *MemoryStore) RemoveGoalByID(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.goals {
+		if m.goals[i].ID == id {
+			m.goals = append(m.goals[:i], m.goals[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveUserGoals - Removes all savings goals relating to a user
+func (m *MemoryStore) RemoveUserGoals(ctx context.Context, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.goals[:0]
+	for _, goal := range m.goals {
+		if goal.UserID != user {
+			kept = append(kept, goal)
+		}
+	}
+	m.goals = kept
+
+	return nil
+}
+
+// InsertAccount - Inserts an account
+func (m *MemoryStore) InsertAccount(ctx context.Context, account model.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.accounts = append(m.accounts, account)
+
+	return nil
+}
+
+// FindAccounts - Returns all of the user's accounts, ordered by name
+func (m *MemoryStore) FindAccounts(ctx context.Context, user string) ([]model.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var accounts []model.Account
+	for _, account := range m.accounts {
+		if account.UserID == user {
+			accounts = append(accounts, account)
+		}
+	}
+
+	sort.SliceStable(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+
+	return accounts, nil
+}
+
+// FindAccountByID - Returns the account with the id
+func (m *MemoryStore) FindAccountByID(ctx context.Context, id string) (model.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, account := range m.accounts {
+		if account.ID == id {
+			return account, nil
+		}
+	}
+
+	return model.Account{}, ErrNotFound
+}
+
+// UpdateAccount - Replaces the account with the same id
+func (m *MemoryStore) UpdateAccount(ctx context.Context, account model.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.accounts {
+		if m.accounts[i].ID == account.ID {
+			m.accounts[i] = account
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveAccountByID - Removes an account by id
+func (m *MemoryStore) RemoveAccountByID(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.accounts {
+		if m.accounts[i].ID == id {
+			m.accounts = append(m.accounts[:i], m.accounts[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveUserAccounts - Removes all accounts relating to a user
+func (m *MemoryStore) RemoveUserAccounts(ctx context.Context, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.accounts[:0]
+	for _, account := range m.accounts {
+		if account.UserID != user {
+			kept = append(kept, account)
+		}
+	}
+	m.accounts = kept
+
+	return nil
+}
+
+// InsertLedger - Inserts a ledger with its members
+func (m *MemoryStore) InsertLedger(ctx context.Context, ledger model.Ledger) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ledger.Members = append([]model.LedgerMember(nil), ledger.Members...)
+	m.ledgers = append(m.ledgers, ledger)
+
+	return nil
+}
+
+// FindLedgers - Returns the ledgers the user is a member of, ordered by name
+func (m *MemoryStore) FindLedgers(ctx context.Context, user string) ([]model.Ledger, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ledgers []model.Ledger
+	for _, ledger := range m.ledgers {
+		if ledger.Role(user) != "" {
+			ledgers = append(ledgers, ledger)
+		}
+	}
+
+	sort.SliceStable(ledgers, func(i, j int) bool { return ledgers[i].Name < ledgers[j].Name })
+
+	return ledgers, nil
+}
+
+// FindLedgerByID - Returns the ledger with the id
+func (m *MemoryStore) FindLedgerByID(ctx context.Context, id string) (model.Ledger, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if i := m.indexOfLedger(id); i >= 0 {
+		return m.ledgers[i], nil
+	}
+
+	return model.Ledger{}, ErrNotFound
+}
+
+// UpdateLedger - Renames the ledger with the same id
+func (m *MemoryStore) UpdateLedger(ctx context.Context, ledger model.Ledger) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOfLedger(ledger.ID)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	m.ledgers[i].Name = ledger.Name
+
+	return nil
+}
+
+// RemoveLedgerByID - Removes a ledger with its invites, making its expenses private again
+func (m *MemoryStore) RemoveLedgerByID(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOfLedger(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	m.removeLedgerAt(i)
+
+	return nil
+}
+
+// SetLedgerMember - Adds the member to the ledger or changes their role
+func (m *MemoryStore) SetLedgerMember(ctx context.Context, ledgerID string, member model.LedgerMember) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOfLedger(ledgerID)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	// Copied so ledgers already handed out keep their members
+	members := make([]model.LedgerMember, 0, len(m.ledgers[i].Members)+1)
+	found := false
+	for _, existing := range m.ledgers[i].Members {
+		if existing.UserID == member.UserID {
+			existing.Role = member.Role
+			found = true
+		}
+		members = append(members, existing)
+	}
+	if !found {
+		members = append(members, member)
+	}
+	m.ledgers[i].Members = members
+
+	return nil
+}
+
+// RemoveLedgerMember - Takes the user out of the ledger
+func (m *MemoryStore) RemoveLedgerMember(ctx context.Context, ledgerID string, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOfLedger(ledgerID)
+	if i < 0 || m.ledgers[i].Role(user) == "" {
+		return ErrNotFound
+	}
+
+	m.ledgers[i].Members = withoutMember(m.ledgers[i].Members, user)
+
+	return nil
+}
+
+// RemoveUserLedgers - Removes the ledgers the user owns, their memberships and the invites sent to them
+func (m *MemoryStore) RemoveUserLedgers(ctx context.Context, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.ledgers) - 1; i >= 0; i-- {
+		switch m.ledgers[i].Role(user) {
+		case model.RoleOwner:
+			m.removeLedgerAt(i)
+		case "":
+		default:
+			m.ledgers[i].Members = withoutMember(m.ledgers[i].Members, user)
+		}
+	}
+
+	kept := m.invites[:0]
+	for _, invite := range m.invites {
+		if invite.Email != user {
+			kept = append(kept, invite)
+		}
+	}
+	m.invites = kept
+
+	return nil
+}
+
+// InsertInvite - Inserts a ledger invite
+func (m *MemoryStore) InsertInvite(ctx context.Context, invite model.LedgerInvite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.invites = append(m.invites, invite)
+
+	return nil
+}
+
+// FindInvites - Returns the invites sent to the email, oldest first
+func (m *MemoryStore) FindInvites(ctx context.Context, email string) ([]model.LedgerInvite, error) {
+	return m.findInvites(func(invite model.LedgerInvite) bool { return invite.Email == email }), nil
+}
+
+// FindLedgerInvites - Returns the ledger's pending invites, oldest first
+func (m *MemoryStore) FindLedgerInvites(ctx context.Context, ledgerID string) ([]model.LedgerInvite, error) {
+	return m.findInvites(func(invite model.LedgerInvite) bool { return invite.LedgerID == ledgerID }), nil
+}
+
+// FindInviteByID - Returns the invite with the id
+func (m *MemoryStore) FindInviteByID(ctx context.Context, id string) (model.LedgerInvite, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, invite := range m.invites {
+		if invite.ID == id {
+			return invite, nil
+		}
+	}
+
+	return model.LedgerInvite{}, ErrNotFound
+}
+
+// RemoveInviteByID - Removes an invite by id
+func (m *MemoryStore) RemoveInviteByID(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.invites {
+		if m.invites[i].ID == id {
+			m.invites = append(m.invites[:i], m.invites[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (m *MemoryStore) findInvites(match func(invite model.LedgerInvite) bool) []model.LedgerInvite {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var invites []model.LedgerInvite
+	for _, invite := range m.invites {
+		if match(invite) {
+			invites = append(invites, invite)
+		}
+	}
+
+	sort.SliceStable(invites, func(i, j int) bool { return invites[i].Created.Before(invites[j].Created) })
+
+	return invites
+}
+
+// InsertAttachment - Inserts an attachment
+func (m *MemoryStore) InsertAttachment(ctx context.Context, attachment model.Attachment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attachments = append(m.attachments, attachment)
+
+	return nil
+}
+
+// FindAttachments - Returns the expense's attachments, oldest first
+func (m *MemoryStore) FindAttachments(ctx context.Context, expenseID string) ([]model.Attachment, error) {
+	return m.findAttachments(func(attachment model.Attachment) bool { return attachment.ExpenseID == expenseID }), nil
+}
+
+// FindUserAttachments - Returns the attachments of every expense the user recorded, oldest first
+func (m *MemoryStore) FindUserAttachments(ctx context.Context, user string) ([]model.Attachment, error) {
+	return m.findAttachments(func(attachment model.Attachment) bool { return attachment.UserID == user }), nil
+}
+
+// FindAttachmentByID - Returns the attachment with the id
+func (m *MemoryStore) FindAttachmentByID(ctx context.Context, id string) (model.Attachment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, attachment := range m.attachments {
+		if attachment.ID == id {
+			return attachment, nil
+		}
+	}
+
+	return model.Attachment{}, ErrNotFound
+}
+
+// RemoveAttachmentByID - Removes an attachment by id
+func (m *MemoryStore) RemoveAttachmentByID(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.attachments {
+		if m.attachments[i].ID == id {
+			m.attachments = append(m.attachments[:i], m.attachments[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RemoveExpenseAttachments - Removes all attachments of an expense
+func (m *MemoryStore) RemoveExpenseAttachments(ctx context.Context, expenseID string) error {
+	m.removeAttachments(func(attachment model.Attachment) bool { return attachment.ExpenseID == expenseID })
+
+	return nil
+}
+
+// RemoveUserAttachments - Removes the attachments of every expense the user recorded
+func (m *MemoryStore) RemoveUserAttachments(ctx context.Context, user string) error {
+	m.removeAttachments(func(attachment model.Attachment) bool { return attachment.UserID == user })
+
+	return nil
+}
+
+func (m *MemoryStore) findAttachments(match func(attachment model.Attachment) bool) []model.Attachment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var attachments []model.Attachment
+	for _, attachment := range m.attachments {
+		if match(attachment) {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	sort.SliceStable(attachments, func(i, j int) bool { return attachments[i].Created.Before(attachments[j].Created) })
+
+	return attachments
+}
+
+func (m *MemoryStore) removeAttachments(match func(attachment model.Attachment) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.attachments[:0]
+	for _, attachment := range m.attachments {
+		if !match(attachment) {
+			kept = append(kept, attachment)
+		}
+	}
+	m.attachments = kept
+}
+
+// InsertRefreshToken - Inserts a refresh token
+func (m *MemoryStore) InsertRefreshToken(ctx context.Context, token model.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.refresh[token.ID]; ok {
+		return ErrDuplicate
+	}
+
+	m.refresh[token.ID] = token
+
+	return nil
+}
+
+// FindRefreshToken - Returns the refresh token with the id
+func (m *MemoryStore) FindRefreshToken(ctx context.Context, id string) (model.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	token, ok := m.refresh[id]
+	if !ok {
+		return model.RefreshToken{}, ErrNotFound
+	}
+
+	return token, nil
+}
+
+// UseRefreshToken - Marks the refresh token exchanged, unless it already was
+func (m *MemoryStore) UseRefreshToken(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.refresh[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if !token.Used.IsZero() {
+		return ErrTokenUsed
+	}
+
+	token.Used = at
+	m.refresh[id] = token
+
+	return nil
+}
+
+// RemoveTokenFamily - Removes every refresh token in the family
+func (m *MemoryStore) RemoveTokenFamily(ctx context.Context, familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, token := range m.refresh {
+		if token.FamilyID == familyID {
+			delete(m.refresh, id)
+		}
+	}
+
+	return nil
+}
+
+// RemoveUserRefreshTokens - Removes all of a user's refresh tokens
+func (m *MemoryStore) RemoveUserRefreshTokens(ctx context.Context, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, token := range m.refresh {
+		if token.UserID == user {
+			delete(m.refresh, id)
+		}
+	}
+
+	return nil
+}
+
+// FindTokenFamilies - Returns the logins the user still holds refresh tokens for
+func (m *MemoryStore) FindTokenFamilies(ctx context.Context, user string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var families []string
+	for _, token := range m.refresh {
+		if token.UserID == user && !seen[token.FamilyID] {
+			seen[token.FamilyID] = true
+			families = append(families, token.FamilyID)
+		}
+	}
+
+	sort.Strings(families)
+
+	return families, nil
+}
+
+// InsertUserToken - Inserts a mailed token
+func (m *MemoryStore) InsertUserToken(ctx context.Context, token model.UserToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.userTokens[token.ID]; ok {
+		return ErrDuplicate
+	}
+
+	m.userTokens[token.ID] = token
+
+	return nil
+}
+
+// FindUserTokens - Returns the user's tokens for the purpose, oldest first
+func (m *MemoryStore) FindUserTokens(ctx context.Context, user string, purpose string) ([]model.UserToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tokens []model.UserToken
+	for _, token := range m.userTokens {
+		if token.UserID == user && token.Purpose == purpose {
+			tokens = append(tokens, token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Created.Before(tokens[j].Created)
+	})
+
+	return tokens, nil
+}
+
+// ConsumeUserToken - Removes the token for the purpose and returns it
+func (m *MemoryStore) ConsumeUserToken(ctx context.Context, id string, purpose string) (model.UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.userTokens[id]
+	if !ok || token.Purpose != purpose {
+		return model.UserToken{}, ErrNotFound
+	}
+
+	delete(m.userTokens, id)
+
+	return token, nil
+}
+
+// RemoveUserTokens - Removes the user's tokens for the purpose, or all of them when it is empty
+func (m *MemoryStore) RemoveUserTokens(ctx context.Context, user string, purpose string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, token := range m.userTokens {
+		if token.UserID == user && (purpose == "" || token.Purpose == purpose) {
+			delete(m.userTokens, id)
+		}
+	}
+
+	return nil
+}
+
+// Position of the ledger with the id, or -1. Callers must hold the lock.
+func (m *MemoryStore) indexOfLedger(id string) int {
+	for i, ledger := range m.ledgers {
+		if ledger.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Removes the ledger at i with its invites and detaches its expenses. Callers must hold the lock.
+func (m *MemoryStore) removeLedgerAt(i int) {
+	id := m.ledgers[i].ID
+	m.ledgers = append(m.ledgers[:i], m.ledgers[i+1:]...)
+
+	kept := m.invites[:0]
+	for _, invite := range m.invites {
+		if invite.LedgerID != id {
+			kept = append(kept, invite)
+		}
+	}
+	m.invites = kept
+
+	for j := range m.expenses {
+		if m.expenses[j].LedgerID == id {
+			m.expenses[j].LedgerID = ""
+		}
+	}
+}
+
+// Copy of the members without the user
+func withoutMember(members []model.LedgerMember, user string) []model.LedgerMember {
+	kept := make([]model.LedgerMember, 0, len(members))
+	for _, member := range members {
+		if member.UserID != user {
+			kept = append(kept, member)
+		}
+	}
+
+	return kept
+}
+
+// Position of the expense with the id, or -1. Callers must hold the lock.
+func (m *MemoryStore) indexOfExpense(id string) int {
+	for i, expense := range m.expenses {
+		if expense.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
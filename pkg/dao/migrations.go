@@ -0,0 +1,512 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// migration - A versioned schema change for the SQL backend.
+// Statements are kept in Go so they ship inside the binary,
+// Run is for the rare data change that needs values from the running store.
+type migration struct {
+	Version     int
+	Description string
+	Statements  []string
+	Run         func(ctx context.Context, tx *sql.Tx, s *SQLStore) error
+}
+
+// Migrations are applied in order and must never be edited once released, only appended to
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "create users and expenses",
+		Statements: []string{
+			`CREATE TABLE users (
+				email    TEXT PRIMARY KEY,
+				password TEXT NOT NULL,
+				token    TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE TABLE expenses (
+				id        TEXT PRIMARY KEY,
+				user_id   TEXT NOT NULL REFERENCES users (email) ON DELETE CASCADE,
+				title     TEXT NOT NULL,
+				price     REAL NOT NULL,
+				date      TEXT NOT NULL,
+				is_saving BOOLEAN NOT NULL,
+				icon      TEXT NOT NULL
+			)`,
+			`CREATE INDEX expenses_user_id ON expenses (user_id)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "index expenses by user and date",
+		Statements: []string{
+			`CREATE INDEX expenses_user_id_date ON expenses (user_id, date)`,
+			`DROP INDEX expenses_user_id`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "store prices as minor units with a currency",
+		Statements: []string{
+			`ALTER TABLE expenses ADD COLUMN price_minor BIGINT NOT NULL DEFAULT 0`,
+			`UPDATE expenses SET price_minor = CAST(ROUND(price * 100) AS BIGINT)`,
+			`ALTER TABLE expenses DROP COLUMN price`,
+			`ALTER TABLE expenses RENAME COLUMN price_minor TO price`,
+			`ALTER TABLE expenses ADD COLUMN currency TEXT NOT NULL DEFAULT ''`,
+		},
+		Run: func(ctx context.Context, tx *sql.Tx, s *SQLStore) error {
+			_, err := tx.ExecContext(ctx, s.rebind("UPDATE expenses SET currency = ? WHERE currency = ''"), s.DefaultCurrency)
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "add default currency to users",
+		Statements: []string{
+			`ALTER TABLE users ADD COLUMN currency TEXT NOT NULL DEFAULT ''`,
+		},
+		Run: func(ctx context.Context, tx *sql.Tx, s *SQLStore) error {
+			_, err := tx.ExecContext(ctx, s.rebind("UPDATE users SET currency = ? WHERE currency = ''"), s.DefaultCurrency)
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "parse free-form expense dates into timestamps",
+		Statements: []string{
+			`ALTER TABLE expenses ADD COLUMN occurred_at TIMESTAMP`,
+		},
+		Run: func(ctx context.Context, tx *sql.Tx, s *SQLStore) error {
+			rows, err := tx.QueryContext(ctx, "SELECT id, date FROM expenses")
+			if err != nil {
+				return err
+			}
+
+			dates := make(map[string]string)
+			for rows.Next() {
+				var id, date string
+				if err := rows.Scan(&id, &date); err != nil {
+					rows.Close()
+					return err
+				}
+				dates[id] = date
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			// The old column is dropped next, so dates that can't be parsed stop the migration instead of being lost
+			var unparseable []string
+			for id, date := range dates {
+				parsed, err := model.ParseLegacyDate(date)
+				if err != nil {
+					log.Printf("Expense %s: can't parse date %q", id, date)
+					unparseable = append(unparseable, id)
+					continue
+				}
+
+				if _, err := tx.ExecContext(ctx, s.rebind("UPDATE expenses SET occurred_at = ? WHERE id = ?"), parsed, id); err != nil {
+					return err
+				}
+			}
+
+			return unparseableDates(unparseable)
+		},
+	},
+	{
+		Version:     6,
+		Description: "replace the free-form date column",
+		Statements: []string{
+			`DROP INDEX expenses_user_id_date`,
+			`ALTER TABLE expenses DROP COLUMN date`,
+			`ALTER TABLE expenses RENAME COLUMN occurred_at TO date`,
+			`CREATE INDEX expenses_user_id_date ON expenses (user_id, date)`,
+		},
+	},
+	{
+		Version:     7,
+		Description: "add timezone to users",
+		Statements: []string{
+			`ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     8,
+		Description: "add categories",
+		Statements: []string{
+			`CREATE TABLE categories (
+				id        TEXT PRIMARY KEY,
+				user_id   TEXT NOT NULL REFERENCES users (email) ON DELETE CASCADE,
+				name      TEXT NOT NULL,
+				icon      TEXT NOT NULL,
+				colour    TEXT NOT NULL,
+				parent_id TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX categories_user_id ON categories (user_id)`,
+			`ALTER TABLE expenses ADD COLUMN category_id TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     9,
+		Description: "add expense tags",
+		Statements: []string{
+			`CREATE TABLE expense_tags (
+				expense_id TEXT NOT NULL REFERENCES expenses (id) ON DELETE CASCADE,
+				tag        TEXT NOT NULL,
+				PRIMARY KEY (expense_id, tag)
+			)`,
+			`CREATE INDEX expense_tags_tag ON expense_tags (tag)`,
+		},
+	},
+	{
+		Version:     10,
+		Description: "add budgets",
+		Statements: []string{
+			`CREATE TABLE budgets (
+				id            TEXT PRIMARY KEY,
+				user_id       TEXT NOT NULL REFERENCES users (email) ON DELETE CASCADE,
+				name          TEXT NOT NULL,
+				amount        BIGINT NOT NULL,
+				currency      TEXT NOT NULL,
+				period        TEXT NOT NULL,
+				category_id   TEXT NOT NULL DEFAULT '',
+				tag           TEXT NOT NULL DEFAULT '',
+				alert_percent INTEGER NOT NULL
+			)`,
+			`CREATE INDEX budgets_user_id ON budgets (user_id)`,
+		},
+	},
+	{
+		Version:     11,
+		Description: "add recurring expenses",
+		Statements: []string{
+			`CREATE TABLE recurrences (
+				id             TEXT PRIMARY KEY,
+				user_id        TEXT NOT NULL REFERENCES users (email) ON DELETE CASCADE,
+				title          TEXT NOT NULL,
+				price          BIGINT NOT NULL,
+				currency       TEXT NOT NULL,
+				is_saving      BOOLEAN NOT NULL,
+				icon           TEXT NOT NULL,
+				category_id    TEXT NOT NULL DEFAULT '',
+				tags           TEXT NOT NULL DEFAULT '',
+				frequency      TEXT NOT NULL,
+				interval_count INTEGER NOT NULL,
+				month_day      INTEGER NOT NULL,
+				start_date     TIMESTAMP NOT NULL,
+				until_date     TIMESTAMP,
+				timezone       TEXT NOT NULL,
+				next           TIMESTAMP
+			)`,
+			`CREATE INDEX recurrences_user_id ON recurrences (user_id)`,
+			`CREATE INDEX recurrences_next ON recurrences (next)`,
+			`ALTER TABLE expenses ADD COLUMN recurrence_id TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     12,
+		Description: "add savings goals",
+		Statements: []string{
+			`CREATE TABLE goals (
+				id         TEXT PRIMARY KEY,
+				user_id    TEXT NOT NULL REFERENCES users (email) ON DELETE CASCADE,
+				name       TEXT NOT NULL,
+				target     BIGINT NOT NULL,
+				currency   TEXT NOT NULL,
+				deadline   TIMESTAMP,
+				created_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX goals_user_id ON goals (user_id)`,
+			`ALTER TABLE expenses ADD COLUMN goal_id TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     13,
+		Description: "add transaction types",
+		Statements: []string{
+			`ALTER TABLE expenses ADD COLUMN type TEXT NOT NULL DEFAULT 'expense'`,
+			`UPDATE expenses SET type = 'saving' WHERE is_saving`,
+			`CREATE INDEX expenses_user_id_type_date ON expenses (user_id, type, date)`,
+			`ALTER TABLE recurrences ADD COLUMN type TEXT NOT NULL DEFAULT 'expense'`,
+			`UPDATE recurrences SET type = 'saving' WHERE is_saving`,
+		},
+	},
+	{
+		Version:     14,
+		Description: "add accounts and transfers",
+		Statements: []string{
+			`CREATE TABLE accounts (
+				id              TEXT PRIMARY KEY,
+				user_id         TEXT NOT NULL REFERENCES users (email) ON DELETE CASCADE,
+				name            TEXT NOT NULL,
+				type            TEXT NOT NULL,
+				currency        TEXT NOT NULL,
+				opening_balance BIGINT NOT NULL
+			)`,
+			`CREATE INDEX accounts_user_id ON accounts (user_id)`,
+			`ALTER TABLE expenses ADD COLUMN account_id TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE expenses ADD COLUMN transfer_id TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE expenses ADD COLUMN incoming BOOLEAN NOT NULL DEFAULT FALSE`,
+			`CREATE INDEX expenses_account_id_date ON expenses (account_id, date)`,
+			`CREATE INDEX expenses_transfer_id ON expenses (transfer_id)`,
+			`ALTER TABLE recurrences ADD COLUMN account_id TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     15,
+		Description: "add split expenses",
+		Statements: []string{
+			`CREATE TABLE expense_splits (
+				expense_id  TEXT NOT NULL REFERENCES expenses (id) ON DELETE CASCADE,
+				position    INTEGER NOT NULL,
+				amount      BIGINT NOT NULL,
+				category_id TEXT NOT NULL,
+				person      TEXT NOT NULL,
+				note        TEXT NOT NULL,
+				PRIMARY KEY (expense_id, position)
+			)`,
+			`CREATE INDEX expense_splits_category_id ON expense_splits (category_id)`,
+		},
+	},
+	{
+		Version:     16,
+		Description: "add shared ledgers",
+		Statements: []string{
+			`CREATE TABLE ledgers (
+				id   TEXT PRIMARY KEY,
+				name TEXT NOT NULL
+			)`,
+			// Members aren't cascaded from users, RemoveUserLedgers decides what happens to an owner's ledgers
+			`CREATE TABLE ledger_members (
+				ledger_id TEXT NOT NULL REFERENCES ledgers (id) ON DELETE CASCADE,
+				user_id   TEXT NOT NULL,
+				role      TEXT NOT NULL,
+				PRIMARY KEY (ledger_id, user_id)
+			)`,
+			`CREATE INDEX ledger_members_user_id ON ledger_members (user_id)`,
+			`CREATE TABLE ledger_invites (
+				id         TEXT PRIMARY KEY,
+				ledger_id  TEXT NOT NULL REFERENCES ledgers (id) ON DELETE CASCADE,
+				email      TEXT NOT NULL,
+				role       TEXT NOT NULL,
+				invited_by TEXT NOT NULL,
+				created    TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX ledger_invites_email ON ledger_invites (email)`,
+			`CREATE INDEX ledger_invites_ledger_id ON ledger_invites (ledger_id)`,
+			`ALTER TABLE expenses ADD COLUMN ledger_id TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX expenses_ledger_id_date ON expenses (ledger_id, date)`,
+		},
+	},
+	{
+		Version:     17,
+		Description: "add who paid for ledger expenses",
+		Statements: []string{
+			`ALTER TABLE expenses ADD COLUMN paid_by TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     18,
+		Description: "add expense attachments",
+		Statements: []string{
+			`CREATE TABLE attachments (
+				id           TEXT PRIMARY KEY,
+				expense_id   TEXT NOT NULL REFERENCES expenses (id) ON DELETE CASCADE,
+				user_id      TEXT NOT NULL,
+				file_name    TEXT NOT NULL,
+				content_type TEXT NOT NULL,
+				size         BIGINT NOT NULL,
+				created      TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX attachments_expense_id ON attachments (expense_id)`,
+			`CREATE INDEX attachments_user_id ON attachments (user_id)`,
+		},
+	},
+	{
+		Version:     19,
+		Description: "add refresh tokens",
+		Statements: []string{
+			`CREATE TABLE refresh_tokens (
+				id        TEXT PRIMARY KEY,
+				family_id TEXT NOT NULL,
+				user_id   TEXT NOT NULL REFERENCES users (email) ON DELETE CASCADE,
+				created   TIMESTAMP NOT NULL,
+				expires   TIMESTAMP NOT NULL,
+				used      TIMESTAMP
+			)`,
+			`CREATE INDEX refresh_tokens_family_id ON refresh_tokens (family_id)`,
+			`CREATE INDEX refresh_tokens_user_id ON refresh_tokens (user_id)`,
+		},
+	},
+	{
+		Version:     20,
+		Description: "add revoked tokens",
+		Statements: []string{
+			`CREATE TABLE revoked_tokens (
+				id      TEXT PRIMARY KEY,
+				expires TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX revoked_tokens_expires ON revoked_tokens (expires)`,
+		},
+	},
+	{
+		Version:     21,
+		Description: "add user tokens",
+		Statements: []string{
+			`CREATE TABLE user_tokens (
+				id      TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users (email) ON DELETE CASCADE,
+				purpose TEXT NOT NULL,
+				created TIMESTAMP NOT NULL,
+				expires TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX user_tokens_user_id ON user_tokens (user_id, purpose)`,
+		},
+	},
+	{
+		Version:     22,
+		Description: "add email verification to users",
+		Statements: []string{
+			`ALTER TABLE users ADD COLUMN verified BOOLEAN NOT NULL DEFAULT FALSE`,
+			// Everyone who signed up before verification existed is trusted as they are
+			`UPDATE users SET verified = TRUE`,
+		},
+	},
+}
+
+// mongoMigration - A versioned data change for the MongoDB backend, recorded in schema_migrations
+type mongoMigration struct {
+	Version     int
+	Description string
+	Run         func(ctx context.Context, dao *DAO) error
+}
+
+// Same rules as the SQL migrations: append only
+var mongoMigrations = []mongoMigration{
+	{
+		Version:     1,
+		Description: "store prices as minor units with a currency",
+		Run: func(ctx context.Context, dao *DAO) error {
+			expenses := dao.db.Collection(dao.ExpenseCollection)
+
+			// Prices used to be float32, stored as doubles
+			_, err := expenses.UpdateMany(ctx, bson.M{"price": bson.M{"$type": "double"}}, mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{"price": bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{"$price", 100}}, 0}}}}}},
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = expenses.UpdateMany(ctx, bson.M{"currency": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"currency": dao.DefaultCurrency}})
+
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "add default currency to users",
+		Run: func(ctx context.Context, dao *DAO) error {
+			_, err := dao.db.Collection(dao.UserCollection).UpdateMany(ctx,
+				bson.M{"currency": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"currency": dao.DefaultCurrency}})
+
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "parse free-form expense dates into dates",
+		Run: func(ctx context.Context, dao *DAO) error {
+			expenses := dao.db.Collection(dao.ExpenseCollection)
+
+			cursor, err := expenses.Find(ctx, bson.M{"date": bson.M{"$type": "string"}})
+			if err != nil {
+				return err
+			}
+			defer cursor.Close(ctx)
+
+			var unparseable []string
+			for cursor.Next(ctx) {
+				var doc struct {
+					ID   bson.ObjectID `bson:"_id"`
+					Date string        `bson:"date"`
+				}
+				if err := cursor.Decode(&doc); err != nil {
+					return err
+				}
+
+				parsed, err := model.ParseLegacyDate(doc.Date)
+				if err != nil {
+					log.Printf("Expense %s: can't parse date %q", doc.ID.Hex(), doc.Date)
+					unparseable = append(unparseable, doc.ID.Hex())
+					continue
+				}
+
+				if _, err := expenses.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"date": parsed}}); err != nil {
+					return err
+				}
+			}
+			if err := cursor.Err(); err != nil {
+				return err
+			}
+
+			// Dates that parsed stay converted, running the migration again picks up the rest once they're fixed
+			return unparseableDates(unparseable)
+		},
+	},
+	{
+		Version:     4,
+		Description: "add transaction types",
+		Run: func(ctx context.Context, dao *DAO) error {
+			// Entries from before types existed were either expenses or savings
+			for _, collection := range []string{dao.ExpenseCollection, dao.RecurrenceCollection} {
+				for _, isSaving := range []bool{false, true} {
+					t := model.TypeExpense
+					if isSaving {
+						t = model.TypeSaving
+					}
+
+					_, err := dao.db.Collection(collection).UpdateMany(ctx,
+						bson.M{"type": bson.M{"$exists": false}, "isSaving": isSaving}, bson.M{"$set": bson.M{"type": t}})
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			return nil
+		},
+	},
+	{
+		Version:     5,
+		Description: "mark existing users verified",
+		Run: func(ctx context.Context, dao *DAO) error {
+			// Everyone who signed up before verification existed is trusted as they are
+			_, err := dao.db.Collection(dao.UserCollection).UpdateMany(ctx,
+				bson.M{"verified": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"verified": true}})
+
+			return err
+		},
+	},
+}
+
+// Fails a date migration that came across expenses whose dates can't be parsed, rather than leaving them blank
+func unparseableDates(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	sort.Strings(ids)
+	return fmt.Errorf("expenses %s have dates that can't be parsed, correct them and migrate again", strings.Join(ids, ", "))
+}
@@ -0,0 +1,142 @@
+package dao
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// Fields FindExpenses can order by
+const (
+	SortByDate  = "date"
+	SortByPrice = "price"
+	SortByTitle = "title"
+)
+
+// NoCategory - ExpenseQuery.CategoryID value matching expenses without a category
+const NoCategory = "none"
+
+// ErrInvalidCursor - Returned when a cursor can't be decoded or belongs to a different ordering
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// ExpenseQuery - Filters, ordering and page position for FindExpenses.
+// Zero values mean "don't filter on this". Prices are compared in minor units whatever their currency.
+type ExpenseQuery struct {
+	// LedgerID matches every expense in the shared ledger, whoever recorded it, instead of those the user recorded
+	LedgerID string
+	// From is inclusive and To exclusive
+	From time.Time
+	To   time.Time
+	// Types matches any of the transaction types
+	Types    []string
+	IsSaving *bool
+	// Title matches case-insensitively anywhere in the title
+	Title    string
+	MinPrice *model.Money
+	MaxPrice *model.Money
+	Icon     string
+	// CategoryID matches expenses with a split line in the category, the whole expense counting as one
+	// line when it isn't split. Use NoCategory for uncategorised lines.
+	CategoryID string
+	// Tags matches expenses carrying any of the tags, or all of them when AllTags is set
+	Tags    []string
+	AllTags bool
+	// GoalID matches savings linked to the goal
+	GoalID string
+	// AccountID matches transactions of the account, TransferID both entries of a transfer
+	AccountID  string
+	TransferID string
+
+	// Sort is one of the SortBy constants, ties are broken by ID
+	Sort       string
+	Descending bool
+
+	// After continues from the end of a previous page, Limit <= 0 returns everything
+	After *Cursor
+	Limit int
+}
+
+// Cursor - Position of the last expense on a page, in terms of the ordering that produced it
+type Cursor struct {
+	Sort       string      `json:"s"`
+	Descending bool        `json:"d,omitempty"`
+	ID         string      `json:"i"`
+	Date       time.Time   `json:"t,omitempty"`
+	Price      model.Money `json:"p,omitempty"`
+	Title      string      `json:"n,omitempty"`
+}
+
+// Builds the cursor pointing just past the expense
+func newCursor(q ExpenseQuery, last model.Expense) *Cursor {
+	c := &Cursor{Sort: q.sortField(), Descending: q.Descending, ID: last.ID}
+
+	switch c.Sort {
+	case SortByPrice:
+		c.Price = last.Price
+	case SortByTitle:
+		c.Title = last.Title
+	default:
+		c.Date = last.Date.Time
+	}
+
+	return c
+}
+
+// Encode - Serialises the cursor into an opaque URL-safe string
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor - Parses a string produced by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// Checks the ordering is known and that the cursor came from the same ordering
+func (q ExpenseQuery) validate() error {
+	switch q.sortField() {
+	case SortByDate, SortByPrice, SortByTitle:
+	default:
+		return errors.New("unknown sort field " + q.Sort)
+	}
+
+	if q.After != nil && (q.After.Sort != q.sortField() || q.After.Descending != q.Descending) {
+		return ErrInvalidCursor
+	}
+
+	return nil
+}
+
+func (q ExpenseQuery) sortField() string {
+	if q.Sort == "" {
+		return SortByDate
+	}
+
+	return q.Sort
+}
+
+// Trims the extra expense fetched to find out whether there is another page, and points at it
+func paginate(q ExpenseQuery, expenses []model.Expense) ([]model.Expense, *Cursor) {
+	if q.Limit <= 0 || len(expenses) <= q.Limit {
+		return expenses, nil
+	}
+
+	expenses = expenses[:q.Limit]
+
+	return expenses, newCursor(q, expenses[len(expenses)-1])
+}
@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryRevocations - RevocationStore keeping revoked token IDs in memory, each forgotten once its
+// token would have expired. Only suited to running a single instance, as revocations aren't shared
+// and are lost on restart.
+type MemoryRevocations struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	// nextSweep is when expired revocations are next cleared out
+	nextSweep time.Time
+}
+
+var _ RevocationStore = (*MemoryRevocations)(nil)
+
+// How often expired revocations are cleared out of memory
+const revocationSweepInterval = time.Minute
+
+// NewMemoryRevocations - Returns an empty in-memory revocation store
+func NewMemoryRevocations() *MemoryRevocations {
+	return &MemoryRevocations{revoked: make(map[string]time.Time)}
+}
+
+// RevokeToken - Revokes the token or login family with the id until it expires
+func (m *MemoryRevocations) RevokeToken(ctx context.Context, id string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.After(m.nextSweep) {
+		for revoked, until := range m.revoked {
+			if now.After(until) {
+				delete(m.revoked, revoked)
+			}
+		}
+		m.nextSweep = now.Add(revocationSweepInterval)
+	}
+
+	if expires.After(m.revoked[id]) {
+		m.revoked[id] = expires
+	}
+
+	return nil
+}
+
+// TokenRevoked - Reports whether any of the ids has been revoked and not yet expired
+func (m *MemoryRevocations) TokenRevoked(ctx context.Context, ids ...string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, id := range ids {
+		if until, ok := m.revoked[id]; ok && now.Before(until) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
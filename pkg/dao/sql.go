@@ -0,0 +1,1615 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// SQLStore - database/sql implementation of Store, supporting SQLite and PostgreSQL
+type SQLStore struct {
+	// DefaultCurrency is assigned to users and expenses recorded before currencies were tracked
+	DefaultCurrency string
+
+	db     *sql.DB
+	driver string
+}
+
+var _ Store = (*SQLStore)(nil)
+var _ Migrator = (*SQLStore)(nil)
+
+// NewSQLStore - Opens a connection pool for the driver ("sqlite" or "postgres") and data source name
+func NewSQLStore(driver string, dsn string) (*SQLStore, error) {
+	var driverName string
+	switch driver {
+	case "sqlite":
+		driverName = "sqlite3"
+		// Foreign keys are enabled per connection, set in the DSN every connection the pool opens has them
+		if strings.Contains(dsn, "?") {
+			dsn += "&_foreign_keys=on"
+		} else {
+			dsn += "?_foreign_keys=on"
+		}
+	case "postgres":
+		driverName = "postgres"
+	default:
+		return nil, fmt.Errorf("unsupported SQL driver %q", driver)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if driver == "sqlite" {
+		// SQLite only allows a single writer
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Println("Successfully connected to " + driver + " database")
+
+	return &SQLStore{db: db, driver: driver}, nil
+}
+
+// Migrate - Applies every migration that hasn't been recorded in schema_migrations yet
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool)
+	rows, err := s.db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", m.Version, m.Description)
+		if err := s.apply(ctx, m); err != nil {
+			return fmt.Errorf("migration %d: %s", m.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// Runs a single migration and records it, all in one transaction
+func (s *SQLStore) apply(ctx context.Context, m migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.Statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	if m.Run != nil {
+		if err := m.Run(ctx, tx, s); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)"), m.Version, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const userColumns = "email, password, token, currency, timezone, verified"
+
+// InsertUser - Inserts a user into the users table
+func (s *SQLStore) InsertUser(ctx context.Context, user model.User) error {
+	_, err := s.exec(ctx, "INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		user.Email, user.Password, user.Token, user.Currency, user.Timezone, user.Verified)
+
+	if isUniqueViolation(err) {
+		return ErrEmailInUse
+	}
+
+	return err
+}
+
+// FindUserByEmail - Returns the user with the email
+func (s *SQLStore) FindUserByEmail(ctx context.Context, email string) (model.User, error) {
+	user, err := scanUser(s.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?", email))
+
+	return user, sqlErr(err)
+}
+
+// UpdateUser - Replaces the user with the same email
+func (s *SQLStore) UpdateUser(ctx context.Context, user model.User) error {
+	return s.execOne(ctx, "UPDATE users SET password = ?, token = ?, currency = ?, timezone = ?, verified = ? WHERE email = ?",
+		user.Password, user.Token, user.Currency, user.Timezone, user.Verified, user.Email)
+}
+
+// RemoveUserByEmail - Removes a user, cascading to their expenses
+func (s *SQLStore) RemoveUserByEmail(ctx context.Context, email string) error {
+	return s.execOne(ctx, "DELETE FROM users WHERE email = ?", email)
+}
+
+// UserExists - Checks whether a user is already using the provided email
+func (s *SQLStore) UserExists(ctx context.Context, email string) (bool, error) {
+	var n int
+
+	err := s.queryRow(ctx, "SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&n)
+
+	return n > 0, err
+}
+
+const expenseColumns = "id, user_id, title, price, currency, date, type, is_saving, icon, category_id, recurrence_id, goal_id, " +
+	"account_id, transfer_id, incoming, ledger_id, paid_by"
+
+// FindAllExpenses - Returns all expense records relating to the user specified
+func (s *SQLStore) FindAllExpenses(ctx context.Context, user string) ([]model.Expense, error) {
+	return s.queryExpenses(ctx, "SELECT "+expenseColumns+" FROM expenses WHERE user_id = ? ORDER BY id", user)
+}
+
+// FindExpenses - Returns one page of the user's expenses matching the query, and a cursor to the next page if any
+func (s *SQLStore) FindExpenses(ctx context.Context, user string, q ExpenseQuery) ([]model.Expense, *Cursor, error) {
+	if err := q.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	where := []string{"user_id = ?"}
+	args := []interface{}{user}
+	if q.LedgerID != "" {
+		where[0], args[0] = "ledger_id = ?", q.LedgerID
+	}
+
+	if !q.From.IsZero() {
+		where = append(where, "date >= ?")
+		args = append(args, model.NewDate(q.From))
+	}
+	if !q.To.IsZero() {
+		where = append(where, "date < ?")
+		args = append(args, model.NewDate(q.To))
+	}
+	if len(q.Types) > 0 {
+		where = append(where, "type IN (?"+strings.Repeat(", ?", len(q.Types)-1)+")")
+		for _, t := range q.Types {
+			args = append(args, t)
+		}
+	}
+	if q.IsSaving != nil {
+		where = append(where, "is_saving = ?")
+		args = append(args, *q.IsSaving)
+	}
+	if q.Title != "" {
+		where = append(where, `LOWER(title) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(strings.ToLower(q.Title))+"%")
+	}
+	if q.MinPrice != nil {
+		where = append(where, "price >= ?")
+		args = append(args, *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		where = append(where, "price <= ?")
+		args = append(args, *q.MaxPrice)
+	}
+	if q.Icon != "" {
+		where = append(where, "icon = ?")
+		args = append(args, q.Icon)
+	}
+	// Split expenses have no category of their own, their lines do
+	if q.CategoryID == NoCategory {
+		where = append(where, "((category_id = '' AND id NOT IN (SELECT expense_id FROM expense_splits)) OR "+
+			"id IN (SELECT expense_id FROM expense_splits WHERE category_id = ''))")
+	} else if q.CategoryID != "" {
+		where = append(where, "(category_id = ? OR id IN (SELECT expense_id FROM expense_splits WHERE category_id = ?))")
+		args = append(args, q.CategoryID, q.CategoryID)
+	}
+
+	if q.AccountID != "" {
+		where = append(where, "account_id = ?")
+		args = append(args, q.AccountID)
+	}
+	if q.TransferID != "" {
+		where = append(where, "transfer_id = ?")
+		args = append(args, q.TransferID)
+	}
+	if q.GoalID != "" {
+		where = append(where, "goal_id = ?")
+		args = append(args, q.GoalID)
+	}
+	if len(q.Tags) > 0 {
+		tags := "id IN (SELECT expense_id FROM expense_tags WHERE tag IN (?" + strings.Repeat(", ?", len(q.Tags)-1) + ")"
+		for _, tag := range q.Tags {
+			args = append(args, tag)
+		}
+		if q.AllTags {
+			tags += " GROUP BY expense_id HAVING COUNT(*) = ?"
+			args = append(args, len(q.Tags))
+		}
+		where = append(where, tags+")")
+	}
+
+	column := q.sortField()
+	op, direction := ">", "ASC"
+	if q.Descending {
+		op, direction = "<", "DESC"
+	}
+
+	if q.After != nil {
+		var value interface{}
+		switch column {
+		case SortByPrice:
+			value = q.After.Price
+		case SortByTitle:
+			value = q.After.Title
+		default:
+			value = model.NewDate(q.After.Date)
+		}
+
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, op))
+		args = append(args, value, value, q.After.ID)
+	}
+
+	query := "SELECT " + expenseColumns + " FROM expenses WHERE " + strings.Join(where, " AND ") +
+		fmt.Sprintf(" ORDER BY %[1]s %[2]s, id %[2]s", column, direction)
+
+	if q.Limit > 0 {
+		// One extra tells us whether there is another page
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
+
+	expenses, err := s.queryExpenses(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expenses, next := paginate(q, expenses)
+
+	return expenses, next, nil
+}
+
+// FindExpenseByID - Returns the expense with the id
+func (s *SQLStore) FindExpenseByID(ctx context.Context, id string) (model.Expense, error) {
+	expense, err := scanExpense(s.queryRow(ctx, "SELECT "+expenseColumns+" FROM expenses WHERE id = ?", id))
+	if err != nil {
+		return expense, sqlErr(err)
+	}
+
+	expenses := []model.Expense{expense}
+	if err := s.loadTags(ctx, expenses); err != nil {
+		return expense, err
+	}
+	err = s.loadSplits(ctx, expenses)
+
+	return expenses[0], err
+}
+
+// InsertExpense - Inserts an expense record into the expenses table
+func (s *SQLStore) InsertExpense(ctx context.Context, expense model.Expense) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.insertExpense(ctx, tx, expense)
+	})
+}
+
+// InsertTransfer - Inserts both entries of a transfer in one transaction
+func (s *SQLStore) InsertTransfer(ctx context.Context, out model.Expense, in model.Expense) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := s.insertExpense(ctx, tx, out); err != nil {
+			return err
+		}
+
+		return s.insertExpense(ctx, tx, in)
+	})
+}
+
+func (s *SQLStore) insertExpense(ctx context.Context, tx *sql.Tx, expense model.Expense) error {
+	_, err := tx.ExecContext(ctx, s.rebind("INSERT INTO expenses ("+expenseColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		expense.ID, expense.UserID, expense.Title, expense.Price, expense.Currency, expense.Date, expense.Type, expense.IsSaving, expense.Icon,
+		expense.CategoryID, expense.RecurrenceID, expense.GoalID, expense.AccountID, expense.TransferID, expense.Incoming, expense.LedgerID,
+		expense.PaidBy)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.insertTags(ctx, tx, expense); err != nil {
+		return err
+	}
+
+	return s.insertSplits(ctx, tx, expense)
+}
+
+// UpdateExpense - Updates an expense record in the expenses table
+func (s *SQLStore) UpdateExpense(ctx context.Context, expense model.Expense) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, s.rebind("UPDATE expenses SET user_id = ?, title = ?, price = ?, currency = ?, date = ?, type = ?, is_saving = ?, icon = ?, category_id = ?, recurrence_id = ?, goal_id = ?, account_id = ?, transfer_id = ?, incoming = ?, ledger_id = ?, paid_by = ? WHERE id = ?"),
+			expense.UserID, expense.Title, expense.Price, expense.Currency, expense.Date, expense.Type, expense.IsSaving, expense.Icon,
+			expense.CategoryID, expense.RecurrenceID, expense.GoalID, expense.AccountID, expense.TransferID, expense.Incoming, expense.LedgerID,
+			expense.PaidBy, expense.ID)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM expense_tags WHERE expense_id = ?"), expense.ID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM expense_splits WHERE expense_id = ?"), expense.ID); err != nil {
+			return err
+		}
+
+		if err := s.insertTags(ctx, tx, expense); err != nil {
+			return err
+		}
+
+		return s.insertSplits(ctx, tx, expense)
+	})
+}
+
+// RemoveExpenseByID - Removes an expense by id
+func (s *SQLStore) RemoveExpenseByID(ctx context.Context, id string) error {
+	return s.execOne(ctx, "DELETE FROM expenses WHERE id = ?", id)
+}
+
+// RemoveTransfer - Removes both entries of a transfer
+func (s *SQLStore) RemoveTransfer(ctx context.Context, transferID string) error {
+	res, err := s.exec(ctx, "DELETE FROM expenses WHERE transfer_id = ?", transferID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveUserExpenses - Removes all expenses relating to a user
+func (s *SQLStore) RemoveUserExpenses(ctx context.Context, email string) error {
+	_, err := s.exec(ctx, "DELETE FROM expenses WHERE user_id = ?", email)
+
+	return err
+}
+
+// ReassignExpenseCategory - Moves all of the user's expenses in one category to another
+func (s *SQLStore) ReassignExpenseCategory(ctx context.Context, user string, from string, to string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.rebind("UPDATE expenses SET category_id = ? WHERE user_id = ? AND category_id = ?"), to, user, from)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE expense_splits SET category_id = ?
+			WHERE category_id = ? AND expense_id IN (SELECT id FROM expenses WHERE user_id = ?)`), to, from, user)
+
+		return err
+	})
+}
+
+// ReassignExpenseGoal - Moves all of the user's savings linked to one goal to another
+func (s *SQLStore) ReassignExpenseGoal(ctx context.Context, user string, from string, to string) error {
+	_, err := s.exec(ctx, "UPDATE expenses SET goal_id = ? WHERE user_id = ? AND goal_id = ?", to, user, from)
+
+	return err
+}
+
+// TagCounts - Returns every tag the user has used and how many expenses carry it, ordered by tag
+func (s *SQLStore) TagCounts(ctx context.Context, user string) ([]model.TagCount, error) {
+	rows, err := s.query(ctx, `SELECT t.tag, COUNT(*) FROM expense_tags t
+		JOIN expenses e ON e.id = t.expense_id
+		WHERE e.user_id = ? GROUP BY t.tag ORDER BY t.tag`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []model.TagCount
+	for rows.Next() {
+		var count model.TagCount
+		if err := rows.Scan(&count.Tag, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// ReplaceTag - Swaps one tag for another on all of the user's expenses carrying it
+func (s *SQLStore) ReplaceTag(ctx context.Context, user string, from string, to string) (int, error) {
+	var changed int64
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		// Add the new tag first, skipping expenses that already carry it
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO expense_tags (expense_id, tag)
+			SELECT t.expense_id, ? FROM expense_tags t
+			JOIN expenses e ON e.id = t.expense_id
+			WHERE e.user_id = ? AND t.tag = ?
+			AND NOT EXISTS (SELECT 1 FROM expense_tags o WHERE o.expense_id = t.expense_id AND o.tag = ?)`),
+			to, user, from, to)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM expense_tags
+			WHERE tag = ? AND expense_id IN (SELECT id FROM expenses WHERE user_id = ?)`), from, user)
+		if err != nil {
+			return err
+		}
+
+		changed, err = res.RowsAffected()
+
+		return err
+	})
+
+	return int(changed), err
+}
+
+const categoryColumns = "id, user_id, name, icon, colour, parent_id"
+
+// InsertCategory - Inserts a category into the categories table
+func (s *SQLStore) InsertCategory(ctx context.Context, category model.Category) error {
+	_, err := s.exec(ctx, "INSERT INTO categories ("+categoryColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		category.ID, category.UserID, category.Name, category.Icon, category.Colour, category.ParentID)
+
+	return err
+}
+
+// FindCategories - Returns all of the user's categories, ordered by name
+func (s *SQLStore) FindCategories(ctx context.Context, user string) ([]model.Category, error) {
+	rows, err := s.query(ctx, "SELECT "+categoryColumns+" FROM categories WHERE user_id = ? ORDER BY name, id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []model.Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// FindCategoryByID - Returns the category with the id
+func (s *SQLStore) FindCategoryByID(ctx context.Context, id string) (model.Category, error) {
+	category, err := scanCategory(s.queryRow(ctx, "SELECT "+categoryColumns+" FROM categories WHERE id = ?", id))
+
+	return category, sqlErr(err)
+}
+
+// UpdateCategory - Replaces the category with the same id
+func (s *SQLStore) UpdateCategory(ctx context.Context, category model.Category) error {
+	return s.execOne(ctx, "UPDATE categories SET user_id = ?, name = ?, icon = ?, colour = ?, parent_id = ? WHERE id = ?",
+		category.UserID, category.Name, category.Icon, category.Colour, category.ParentID, category.ID)
+}
+
+// RemoveCategoryByID - Removes a category by id
+func (s *SQLStore) RemoveCategoryByID(ctx context.Context, id string) error {
+	return s.execOne(ctx, "DELETE FROM categories WHERE id = ?", id)
+}
+
+// RemoveUserCategories - Removes all categories relating to a user
+func (s *SQLStore) RemoveUserCategories(ctx context.Context, user string) error {
+	_, err := s.exec(ctx, "DELETE FROM categories WHERE user_id = ?", user)
+
+	return err
+}
+
+const budgetColumns = "id, user_id, name, amount, currency, period, category_id, tag, alert_percent"
+
+// InsertBudget - Inserts a budget into the budgets table
+func (s *SQLStore) InsertBudget(ctx context.Context, budget model.Budget) error {
+	_, err := s.exec(ctx, "INSERT INTO budgets ("+budgetColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		budget.ID, budget.UserID, budget.Name, budget.Amount, budget.Currency, budget.Period, budget.CategoryID, budget.Tag,
+		budget.AlertPercent)
+
+	return err
+}
+
+// FindBudgets - Returns all of the user's budgets, ordered by name
+func (s *SQLStore) FindBudgets(ctx context.Context, user string) ([]model.Budget, error) {
+	rows, err := s.query(ctx, "SELECT "+budgetColumns+" FROM budgets WHERE user_id = ? ORDER BY name, id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var budgets []model.Budget
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+
+	return budgets, rows.Err()
+}
+
+// FindBudgetByID - Returns the budget with the id
+func (s *SQLStore) FindBudgetByID(ctx context.Context, id string) (model.Budget, error) {
+	budget, err := scanBudget(s.queryRow(ctx, "SELECT "+budgetColumns+" FROM budgets WHERE id = ?", id))
+
+	return budget, sqlErr(err)
+}
+
+// UpdateBudget - Replaces the budget with the same id
+func (s *SQLStore) UpdateBudget(ctx context.Context, budget model.Budget) error {
+	return s.execOne(ctx, "UPDATE budgets SET user_id = ?, name = ?, amount = ?, currency = ?, period = ?, category_id = ?, tag = ?, alert_percent = ? WHERE id = ?",
+		budget.UserID, budget.Name, budget.Amount, budget.Currency, budget.Period, budget.CategoryID, budget.Tag,
+		budget.AlertPercent, budget.ID)
+}
+
+// RemoveBudgetByID - Removes a budget by id
+func (s *SQLStore) RemoveBudgetByID(ctx context.Context, id string) error {
+	return s.execOne(ctx, "DELETE FROM budgets WHERE id = ?", id)
+}
+
+// RemoveUserBudgets - Removes all budgets relating to a user
+func (s *SQLStore) RemoveUserBudgets(ctx context.Context, user string) error {
+	_, err := s.exec(ctx, "DELETE FROM budgets WHERE user_id = ?", user)
+
+	return err
+}
+
+const goalColumns = "id, user_id, name, target, currency, deadline, created_at"
+
+// InsertGoal - Inserts a savings goal into the goals table
+func (s *SQLStore) InsertGoal(ctx context.Context, goal model.SavingsGoal) error {
+	_, err := s.exec(ctx, "INSERT INTO goals ("+goalColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		goal.ID, goal.UserID, goal.Name, goal.Target, goal.Currency, goal.Deadline, goal.CreatedAt)
+
+	return err
+}
+
+// FindGoals - Returns all of the user's savings goals, ordered by name
+func (s *SQLStore) FindGoals(ctx context.Context, user string) ([]model.SavingsGoal, error) {
+	rows, err := s.query(ctx, "SELECT "+goalColumns+" FROM goals WHERE user_id = ? ORDER BY name, id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var goals []model.SavingsGoal
+	for rows.Next() {
+		goal, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+
+	return goals, rows.Err()
+}
+
+// FindGoalByID - Returns the savings goal with the id
+func (s *SQLStore) FindGoalByID(ctx context.Context, id string) (model.SavingsGoal, error) {
+	goal, err := scanGoal(s.queryRow(ctx, "SELECT "+goalColumns+" FROM goals WHERE id = ?", id))
+
+	return goal, sqlErr(err)
+}
+
+// UpdateGoal - Replaces the savings goal with the same id
+func (s *SQLStore) UpdateGoal(ctx context.Context, goal model.SavingsGoal) error {
+	return s.execOne(ctx, "UPDATE goals SET user_id = ?, name = ?, target = ?, currency = ?, deadline = ?, created_at = ? WHERE id = ?",
+		goal.UserID, goal.Name, goal.Target, goal.Currency, goal.Deadline, goal.CreatedAt, goal.ID)
+}
+
+// RemoveGoalByID - Removes a savings goal by id
+func (s *SQLStore) RemoveGoalByID(ctx context.Context, id string) error {
+	return s.execOne(ctx, "DELETE FROM goals WHERE id = ?", id)
+}
+
+// RemoveUserGoals - Removes all savings goals relating to a user
+func (s *SQLStore) RemoveUserGoals(ctx context.Context, user string) error {
+	_, err := s.exec(ctx, "DELETE FROM goals WHERE user_id = ?", user)
+
+	return err
+}
+
+const accountColumns = "id, user_id, name, type, currency, opening_balance"
+
+// InsertAccount - Inserts an account into the accounts table
+func (s *SQLStore) InsertAccount(ctx context.Context, account model.Account) error {
+	_, err := s.exec(ctx, "INSERT INTO accounts ("+accountColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		account.ID, account.UserID, account.Name, account.Type, account.Currency, account.OpeningBalance)
+
+	return err
+}
+
+// FindAccounts - Returns all of the user's accounts, ordered by name
+func (s *SQLStore) FindAccounts(ctx context.Context, user string) ([]model.Account, error) {
+	rows, err := s.query(ctx, "SELECT "+accountColumns+" FROM accounts WHERE user_id = ? ORDER BY name, id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []model.Account
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
+// FindAccountByID - Returns the account with the id
+func (s *SQLStore) FindAccountByID(ctx context.Context, id string) (model.Account, error) {
+	account, err := scanAccount(s.queryRow(ctx, "SELECT "+accountColumns+" FROM accounts WHERE id = ?", id))
+
+	return account, sqlErr(err)
+}
+
+// UpdateAccount - Replaces the account with the same id
+func (s *SQLStore) UpdateAccount(ctx context.Context, account model.Account) error {
+	return s.execOne(ctx, "UPDATE accounts SET user_id = ?, name = ?, type = ?, currency = ?, opening_balance = ? WHERE id = ?",
+		account.UserID, account.Name, account.Type, account.Currency, account.OpeningBalance, account.ID)
+}
+
+// RemoveAccountByID - Removes an account by id
+func (s *SQLStore) RemoveAccountByID(ctx context.Context, id string) error {
+	return s.execOne(ctx, "DELETE FROM accounts WHERE id = ?", id)
+}
+
+// RemoveUserAccounts - Removes all accounts relating to a user
+func (s *SQLStore) RemoveUserAccounts(ctx context.Context, user string) error {
+	_, err := s.exec(ctx, "DELETE FROM accounts WHERE user_id = ?", user)
+
+	return err
+}
+
+// InsertLedger - Inserts a ledger with its members
+func (s *SQLStore) InsertLedger(ctx context.Context, ledger model.Ledger) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO ledgers (id, name) VALUES (?, ?)"), ledger.ID, ledger.Name); err != nil {
+			return err
+		}
+
+		for _, member := range ledger.Members {
+			_, err := tx.ExecContext(ctx, s.rebind("INSERT INTO ledger_members (ledger_id, user_id, role) VALUES (?, ?, ?)"),
+				ledger.ID, member.UserID, member.Role)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// FindLedgers - Returns the ledgers the user is a member of, ordered by name
+func (s *SQLStore) FindLedgers(ctx context.Context, user string) ([]model.Ledger, error) {
+	return s.queryLedgers(ctx, `SELECT id, name FROM ledgers
+		WHERE id IN (SELECT ledger_id FROM ledger_members WHERE user_id = ?) ORDER BY name, id`, user)
+}
+
+// FindLedgerByID - Returns the ledger with the id
+func (s *SQLStore) FindLedgerByID(ctx context.Context, id string) (model.Ledger, error) {
+	ledgers, err := s.queryLedgers(ctx, "SELECT id, name FROM ledgers WHERE id = ?", id)
+	if err != nil {
+		return model.Ledger{}, err
+	}
+	if len(ledgers) == 0 {
+		return model.Ledger{}, ErrNotFound
+	}
+
+	return ledgers[0], nil
+}
+
+// UpdateLedger - Renames the ledger with the same id
+func (s *SQLStore) UpdateLedger(ctx context.Context, ledger model.Ledger) error {
+	return s.execOne(ctx, "UPDATE ledgers SET name = ? WHERE id = ?", ledger.Name, ledger.ID)
+}
+
+// RemoveLedgerByID - Removes a ledger, cascading to its members and invites, and makes its expenses private again
+func (s *SQLStore) RemoveLedgerByID(ctx context.Context, id string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.removeLedger(ctx, tx, id)
+	})
+}
+
+// SetLedgerMember - Adds the member to the ledger or changes their role
+func (s *SQLStore) SetLedgerMember(ctx context.Context, ledgerID string, member model.LedgerMember) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		var n int
+		if err := tx.QueryRowContext(ctx, s.rebind("SELECT COUNT(*) FROM ledgers WHERE id = ?"), ledgerID).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+
+		res, err := tx.ExecContext(ctx, s.rebind("UPDATE ledger_members SET role = ? WHERE ledger_id = ? AND user_id = ?"),
+			member.Role, ledgerID, member.UserID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind("INSERT INTO ledger_members (ledger_id, user_id, role) VALUES (?, ?, ?)"),
+			ledgerID, member.UserID, member.Role)
+
+		return err
+	})
+}
+
+// RemoveLedgerMember - Takes the user out of the ledger
+func (s *SQLStore) RemoveLedgerMember(ctx context.Context, ledgerID string, user string) error {
+	return s.execOne(ctx, "DELETE FROM ledger_members WHERE ledger_id = ? AND user_id = ?", ledgerID, user)
+}
+
+// RemoveUserLedgers - Removes the ledgers the user owns, their memberships and the invites sent to them
+func (s *SQLStore) RemoveUserLedgers(ctx context.Context, user string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, s.rebind("SELECT ledger_id FROM ledger_members WHERE user_id = ? AND role = ?"), user, model.RoleOwner)
+		if err != nil {
+			return err
+		}
+
+		var owned []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			owned = append(owned, id)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, id := range owned {
+			if err := s.removeLedger(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM ledger_members WHERE user_id = ?"), user); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind("DELETE FROM ledger_invites WHERE email = ?"), user)
+
+		return err
+	})
+}
+
+const inviteColumns = "id, ledger_id, email, role, invited_by, created"
+
+// InsertInvite - Inserts an invite into the ledger_invites table
+func (s *SQLStore) InsertInvite(ctx context.Context, invite model.LedgerInvite) error {
+	_, err := s.exec(ctx, "INSERT INTO ledger_invites ("+inviteColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		invite.ID, invite.LedgerID, invite.Email, invite.Role, invite.InvitedBy, invite.Created.UTC())
+
+	return err
+}
+
+// FindInvites - Returns the invites sent to the email, oldest first
+func (s *SQLStore) FindInvites(ctx context.Context, email string) ([]model.LedgerInvite, error) {
+	return s.queryInvites(ctx, "SELECT "+inviteColumns+" FROM ledger_invites WHERE email = ? ORDER BY created, id", email)
+}
+
+// FindLedgerInvites - Returns the ledger's pending invites, oldest first
+func (s *SQLStore) FindLedgerInvites(ctx context.Context, ledgerID string) ([]model.LedgerInvite, error) {
+	return s.queryInvites(ctx, "SELECT "+inviteColumns+" FROM ledger_invites WHERE ledger_id = ? ORDER BY created, id", ledgerID)
+}
+
+// FindInviteByID - Returns the invite with the id
+func (s *SQLStore) FindInviteByID(ctx context.Context, id string) (model.LedgerInvite, error) {
+	invite, err := scanInvite(s.queryRow(ctx, "SELECT "+inviteColumns+" FROM ledger_invites WHERE id = ?", id))
+
+	return invite, sqlErr(err)
+}
+
+// RemoveInviteByID - Removes an invite by id
+func (s *SQLStore) RemoveInviteByID(ctx context.Context, id string) error {
+	return s.execOne(ctx, "DELETE FROM ledger_invites WHERE id = ?", id)
+}
+
+// Detaches the ledger's expenses and deletes it, its members and invites going with it
+func (s *SQLStore) removeLedger(ctx context.Context, tx *sql.Tx, id string) error {
+	if _, err := tx.ExecContext(ctx, s.rebind("UPDATE expenses SET ledger_id = '' WHERE ledger_id = ?"), id); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, s.rebind("DELETE FROM ledgers WHERE id = ?"), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Runs a query for ledger ids and names, filling in each ledger's members
+func (s *SQLStore) queryLedgers(ctx context.Context, query string, args ...interface{}) ([]model.Ledger, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ledgers []model.Ledger
+	index := make(map[string]int)
+	for rows.Next() {
+		var ledger model.Ledger
+		if err := rows.Scan(&ledger.ID, &ledger.Name); err != nil {
+			return nil, err
+		}
+		index[ledger.ID] = len(ledgers)
+		ledgers = append(ledgers, ledger)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(ledgers) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]interface{}, 0, len(ledgers))
+	for _, ledger := range ledgers {
+		ids = append(ids, ledger.ID)
+	}
+
+	rows, err = s.query(ctx, "SELECT ledger_id, user_id, role FROM ledger_members WHERE ledger_id IN (?"+
+		strings.Repeat(", ?", len(ids)-1)+") ORDER BY ledger_id, user_id", ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var member model.LedgerMember
+		if err := rows.Scan(&id, &member.UserID, &member.Role); err != nil {
+			return nil, err
+		}
+		i := index[id]
+		ledgers[i].Members = append(ledgers[i].Members, member)
+	}
+
+	return ledgers, rows.Err()
+}
+
+func (s *SQLStore) queryInvites(ctx context.Context, query string, args ...interface{}) ([]model.LedgerInvite, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []model.LedgerInvite
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+
+	return invites, rows.Err()
+}
+
+const attachmentColumns = "id, expense_id, user_id, file_name, content_type, size, created"
+
+// InsertAttachment - Inserts an attachment into the attachments table
+func (s *SQLStore) InsertAttachment(ctx context.Context, attachment model.Attachment) error {
+	_, err := s.exec(ctx, "INSERT INTO attachments ("+attachmentColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		attachment.ID, attachment.ExpenseID, attachment.UserID, attachment.FileName, attachment.ContentType,
+		attachment.Size, attachment.Created.UTC())
+
+	return err
+}
+
+// FindAttachments - Returns the expense's attachments, oldest first
+func (s *SQLStore) FindAttachments(ctx context.Context, expenseID string) ([]model.Attachment, error) {
+	return s.queryAttachments(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE expense_id = ? ORDER BY created, id", expenseID)
+}
+
+// FindUserAttachments - Returns the attachments of every expense the user recorded, oldest first
+func (s *SQLStore) FindUserAttachments(ctx context.Context, user string) ([]model.Attachment, error) {
+	return s.queryAttachments(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE user_id = ? ORDER BY created, id", user)
+}
+
+// FindAttachmentByID - Returns the attachment with the id
+func (s *SQLStore) FindAttachmentByID(ctx context.Context, id string) (model.Attachment, error) {
+	attachment, err := scanAttachment(s.queryRow(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id = ?", id))
+
+	return attachment, sqlErr(err)
+}
+
+// RemoveAttachmentByID - Removes an attachment by id
+func (s *SQLStore) RemoveAttachmentByID(ctx context.Context, id string) error {
+	return s.execOne(ctx, "DELETE FROM attachments WHERE id = ?", id)
+}
+
+// RemoveExpenseAttachments - Removes all attachments of an expense
+func (s *SQLStore) RemoveExpenseAttachments(ctx context.Context, expenseID string) error {
+	_, err := s.exec(ctx, "DELETE FROM attachments WHERE expense_id = ?", expenseID)
+
+	return err
+}
+
+// RemoveUserAttachments - Removes the attachments of every expense the user recorded
+func (s *SQLStore) RemoveUserAttachments(ctx context.Context, user string) error {
+	_, err := s.exec(ctx, "DELETE FROM attachments WHERE user_id = ?", user)
+
+	return err
+}
+
+func (s *SQLStore) queryAttachments(ctx context.Context, query string, args ...interface{}) ([]model.Attachment, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []model.Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+const refreshTokenColumns = "id, family_id, user_id, created, expires, used"
+
+// InsertRefreshToken - Inserts a refresh token into the refresh_tokens table
+func (s *SQLStore) InsertRefreshToken(ctx context.Context, token model.RefreshToken) error {
+	_, err := s.exec(ctx, "INSERT INTO refresh_tokens (id, family_id, user_id, created, expires) VALUES (?, ?, ?, ?, ?)",
+		token.ID, token.FamilyID, token.UserID, token.Created.UTC(), token.Expires.UTC())
+
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// FindRefreshToken - Returns the refresh token with the id
+func (s *SQLStore) FindRefreshToken(ctx context.Context, id string) (model.RefreshToken, error) {
+	token, err := scanRefreshToken(s.queryRow(ctx, "SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE id = ?", id))
+
+	return token, sqlErr(err)
+}
+
+// UseRefreshToken - Marks the refresh token exchanged, unless it already was
+func (s *SQLStore) UseRefreshToken(ctx context.Context, id string, at time.Time) error {
+	err := s.execOne(ctx, "UPDATE refresh_tokens SET used = ? WHERE id = ? AND used IS NULL", at.UTC(), id)
+	if err != ErrNotFound {
+		return err
+	}
+
+	if _, err := s.FindRefreshToken(ctx, id); err != nil {
+		return err
+	}
+
+	return ErrTokenUsed
+}
+
+// RemoveTokenFamily - Removes every refresh token in the family
+func (s *SQLStore) RemoveTokenFamily(ctx context.Context, familyID string) error {
+	_, err := s.exec(ctx, "DELETE FROM refresh_tokens WHERE family_id = ?", familyID)
+
+	return err
+}
+
+// RemoveUserRefreshTokens - Removes all of a user's refresh tokens
+func (s *SQLStore) RemoveUserRefreshTokens(ctx context.Context, user string) error {
+	_, err := s.exec(ctx, "DELETE FROM refresh_tokens WHERE user_id = ?", user)
+
+	return err
+}
+
+// FindTokenFamilies - Returns the logins the user still holds refresh tokens for
+func (s *SQLStore) FindTokenFamilies(ctx context.Context, user string) ([]string, error) {
+	rows, err := s.query(ctx, "SELECT DISTINCT family_id FROM refresh_tokens WHERE user_id = ? ORDER BY family_id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var families []string
+	for rows.Next() {
+		var family string
+		if err := rows.Scan(&family); err != nil {
+			return nil, err
+		}
+		families = append(families, family)
+	}
+
+	return families, rows.Err()
+}
+
+const userTokenColumns = "id, user_id, purpose, created, expires"
+
+// InsertUserToken - Inserts a mailed token into the user_tokens table
+func (s *SQLStore) InsertUserToken(ctx context.Context, token model.UserToken) error {
+	_, err := s.exec(ctx, "INSERT INTO user_tokens ("+userTokenColumns+") VALUES (?, ?, ?, ?, ?)",
+		token.ID, token.UserID, token.Purpose, token.Created.UTC(), token.Expires.UTC())
+
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// FindUserTokens - Returns the user's tokens for the purpose, oldest first
+func (s *SQLStore) FindUserTokens(ctx context.Context, user string, purpose string) ([]model.UserToken, error) {
+	rows, err := s.query(ctx, "SELECT "+userTokenColumns+" FROM user_tokens WHERE user_id = ? AND purpose = ? ORDER BY created, id", user, purpose)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []model.UserToken
+	for rows.Next() {
+		token, err := scanUserToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// ConsumeUserToken - Removes the token for the purpose and returns it. Whichever use deletes the
+// row gets the token, any other finds nothing.
+func (s *SQLStore) ConsumeUserToken(ctx context.Context, id string, purpose string) (model.UserToken, error) {
+	token, err := scanUserToken(s.queryRow(ctx, "SELECT "+userTokenColumns+" FROM user_tokens WHERE id = ? AND purpose = ?", id, purpose))
+	if err != nil {
+		return token, sqlErr(err)
+	}
+
+	if err := s.execOne(ctx, "DELETE FROM user_tokens WHERE id = ?", id); err != nil {
+		return model.UserToken{}, err
+	}
+
+	return token, nil
+}
+
+// RemoveUserTokens - Removes the user's tokens for the purpose, or all of them when it is empty
+func (s *SQLStore) RemoveUserTokens(ctx context.Context, user string, purpose string) error {
+	if purpose == "" {
+		_, err := s.exec(ctx, "DELETE FROM user_tokens WHERE user_id = ?", user)
+		return err
+	}
+
+	_, err := s.exec(ctx, "DELETE FROM user_tokens WHERE user_id = ? AND purpose = ?", user, purpose)
+
+	return err
+}
+
+// RevokeToken - Revokes the token or login family with the id until it expires, clearing out
+// revocations that have expired
+func (s *SQLStore) RevokeToken(ctx context.Context, id string, expires time.Time) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM revoked_tokens WHERE expires < ?"), time.Now().UTC()); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO revoked_tokens (id, expires) VALUES (?, ?)
+			ON CONFLICT (id) DO UPDATE SET expires = excluded.expires`), id, expires.UTC())
+
+		return err
+	})
+}
+
+// TokenRevoked - Reports whether any of the ids has been revoked and not yet expired
+func (s *SQLStore) TokenRevoked(ctx context.Context, ids ...string) (bool, error) {
+	if len(ids) == 0 {
+		return false, nil
+	}
+
+	args := []interface{}{time.Now().UTC()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	var n int
+	err := s.queryRow(ctx, "SELECT COUNT(*) FROM revoked_tokens WHERE expires > ? AND id IN (?"+
+		strings.Repeat(", ?", len(ids)-1)+")", args...).Scan(&n)
+
+	return n > 0, err
+}
+
+const recurrenceColumns = "id, user_id, title, price, currency, type, is_saving, icon, category_id, tags, " +
+	"frequency, interval_count, month_day, start_date, until_date, timezone, next, account_id"
+
+// InsertRecurrence - Inserts a recurring expense rule into the recurrences table
+func (s *SQLStore) InsertRecurrence(ctx context.Context, recurrence model.Recurrence) error {
+	_, err := s.exec(ctx, "INSERT INTO recurrences ("+recurrenceColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		recurrence.ID, recurrence.UserID, recurrence.Title, recurrence.Price, recurrence.Currency, recurrence.Type, recurrence.IsSaving,
+		recurrence.Icon, recurrence.CategoryID, strings.Join(recurrence.Tags, ","), recurrence.Frequency, recurrence.Interval,
+		recurrence.MonthDay, recurrence.Start, recurrence.Until, recurrence.Timezone, recurrence.Next, recurrence.AccountID)
+
+	return err
+}
+
+// FindRecurrences - Returns all of the user's recurring expense rules, ordered by title
+func (s *SQLStore) FindRecurrences(ctx context.Context, user string) ([]model.Recurrence, error) {
+	return s.queryRecurrences(ctx, "SELECT "+recurrenceColumns+" FROM recurrences WHERE user_id = ? ORDER BY title, id", user)
+}
+
+// FindRecurrenceByID - Returns the recurring expense rule with the id
+func (s *SQLStore) FindRecurrenceByID(ctx context.Context, id string) (model.Recurrence, error) {
+	recurrence, err := scanRecurrence(s.queryRow(ctx, "SELECT "+recurrenceColumns+" FROM recurrences WHERE id = ?", id))
+
+	return recurrence, sqlErr(err)
+}
+
+// UpdateRecurrence - Replaces the recurring expense rule with the same id
+func (s *SQLStore) UpdateRecurrence(ctx context.Context, recurrence model.Recurrence) error {
+	return s.execOne(ctx, `UPDATE recurrences SET user_id = ?, title = ?, price = ?, currency = ?, type = ?, is_saving = ?,
+		icon = ?, category_id = ?, tags = ?, frequency = ?, interval_count = ?, month_day = ?, start_date = ?, until_date = ?,
+		timezone = ?, next = ?, account_id = ? WHERE id = ?`,
+		recurrence.UserID, recurrence.Title, recurrence.Price, recurrence.Currency, recurrence.Type, recurrence.IsSaving, recurrence.Icon,
+		recurrence.CategoryID, strings.Join(recurrence.Tags, ","), recurrence.Frequency, recurrence.Interval,
+		recurrence.MonthDay, recurrence.Start, recurrence.Until, recurrence.Timezone, recurrence.Next, recurrence.AccountID, recurrence.ID)
+}
+
+// RemoveRecurrenceByID - Removes a recurring expense rule by id
+func (s *SQLStore) RemoveRecurrenceByID(ctx context.Context, id string) error {
+	return s.execOne(ctx, "DELETE FROM recurrences WHERE id = ?", id)
+}
+
+// RemoveUserRecurrences - Removes all recurring expense rules relating to a user
+func (s *SQLStore) RemoveUserRecurrences(ctx context.Context, user string) error {
+	_, err := s.exec(ctx, "DELETE FROM recurrences WHERE user_id = ?", user)
+
+	return err
+}
+
+// FindDueRecurrences - Returns every rule whose next occurrence is at or before now
+func (s *SQLStore) FindDueRecurrences(ctx context.Context, now time.Time) ([]model.Recurrence, error) {
+	return s.queryRecurrences(ctx, "SELECT "+recurrenceColumns+" FROM recurrences WHERE next IS NOT NULL AND next <= ?", model.NewDate(now))
+}
+
+// AdvanceRecurrence - Sets the next occurrence of the rule, provided it is still from
+func (s *SQLStore) AdvanceRecurrence(ctx context.Context, id string, from model.Date, to model.Date) error {
+	_, err := s.exec(ctx, "UPDATE recurrences SET next = ? WHERE id = ? AND next = ?", to, id, from)
+
+	return err
+}
+
+func (s *SQLStore) queryRecurrences(ctx context.Context, query string, args ...interface{}) ([]model.Recurrence, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recurrences []model.Recurrence
+	for rows.Next() {
+		recurrence, err := scanRecurrence(rows)
+		if err != nil {
+			return nil, err
+		}
+		recurrences = append(recurrences, recurrence)
+	}
+
+	return recurrences, rows.Err()
+}
+
+// scanner - Satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (s *SQLStore) queryExpenses(ctx context.Context, query string, args ...interface{}) ([]model.Expense, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expenses []model.Expense
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, expense)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// SQLite has a single connection, so the rows must be released before the tags are queried
+	rows.Close()
+
+	if err := s.loadTags(ctx, expenses); err != nil {
+		return nil, err
+	}
+	if err := s.loadSplits(ctx, expenses); err != nil {
+		return nil, err
+	}
+
+	return expenses, nil
+}
+
+// How many expense IDs go in each IN list, comfortably below SQLite's variable limit
+const idBatchSize = 500
+
+// Fills in the tags of the expenses from the expense_tags table
+func (s *SQLStore) loadTags(ctx context.Context, expenses []model.Expense) error {
+	index := make(map[string]int, len(expenses))
+	for i, expense := range expenses {
+		index[expense.ID] = i
+	}
+
+	for start := 0; start < len(expenses); start += idBatchSize {
+		end := start + idBatchSize
+		if end > len(expenses) {
+			end = len(expenses)
+		}
+
+		args := make([]interface{}, 0, end-start)
+		for _, expense := range expenses[start:end] {
+			args = append(args, expense.ID)
+		}
+
+		rows, err := s.query(ctx, "SELECT expense_id, tag FROM expense_tags WHERE expense_id IN (?"+
+			strings.Repeat(", ?", len(args)-1)+") ORDER BY expense_id, tag", args...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var id, tag string
+			if err := rows.Scan(&id, &tag); err != nil {
+				rows.Close()
+				return err
+			}
+			i := index[id]
+			expenses[i].Tags = append(expenses[i].Tags, tag)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes the expense's tags, which must not be stored yet
+func (s *SQLStore) insertTags(ctx context.Context, tx *sql.Tx, expense model.Expense) error {
+	for _, tag := range expense.Tags {
+		_, err := tx.ExecContext(ctx, s.rebind("INSERT INTO expense_tags (expense_id, tag) VALUES (?, ?)"), expense.ID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fills in the split lines of the expenses from the expense_splits table
+func (s *SQLStore) loadSplits(ctx context.Context, expenses []model.Expense) error {
+	index := make(map[string]int, len(expenses))
+	for i, expense := range expenses {
+		index[expense.ID] = i
+	}
+
+	for start := 0; start < len(expenses); start += idBatchSize {
+		end := start + idBatchSize
+		if end > len(expenses) {
+			end = len(expenses)
+		}
+
+		args := make([]interface{}, 0, end-start)
+		for _, expense := range expenses[start:end] {
+			args = append(args, expense.ID)
+		}
+
+		rows, err := s.query(ctx, "SELECT expense_id, amount, category_id, person, note FROM expense_splits WHERE expense_id IN (?"+
+			strings.Repeat(", ?", len(args)-1)+") ORDER BY expense_id, position", args...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var id string
+			var line model.Split
+			if err := rows.Scan(&id, &line.Amount, &line.CategoryID, &line.Person, &line.Note); err != nil {
+				rows.Close()
+				return err
+			}
+			i := index[id]
+			expenses[i].Splits = append(expenses[i].Splits, line)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes the expense's split lines in order, which must not be stored yet
+func (s *SQLStore) insertSplits(ctx context.Context, tx *sql.Tx, expense model.Expense) error {
+	for i, line := range expense.Splits {
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO expense_splits (expense_id, position, amount, category_id, person, note)
+			VALUES (?, ?, ?, ?, ?, ?)`), expense.ID, i, line.Amount, line.CategoryID, line.Person, line.Note)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scanUser(row scanner) (model.User, error) {
+	var user model.User
+
+	err := row.Scan(&user.Email, &user.Password, &user.Token, &user.Currency, &user.Timezone, &user.Verified)
+
+	return user, err
+}
+
+func scanCategory(row scanner) (model.Category, error) {
+	var category model.Category
+
+	err := row.Scan(&category.ID, &category.UserID, &category.Name, &category.Icon, &category.Colour, &category.ParentID)
+
+	return category, err
+}
+
+func scanBudget(row scanner) (model.Budget, error) {
+	var budget model.Budget
+
+	err := row.Scan(&budget.ID, &budget.UserID, &budget.Name, &budget.Amount, &budget.Currency, &budget.Period,
+		&budget.CategoryID, &budget.Tag, &budget.AlertPercent)
+
+	return budget, err
+}
+
+func scanAccount(row scanner) (model.Account, error) {
+	var account model.Account
+
+	err := row.Scan(&account.ID, &account.UserID, &account.Name, &account.Type, &account.Currency, &account.OpeningBalance)
+
+	return account, err
+}
+
+func scanInvite(row scanner) (model.LedgerInvite, error) {
+	var invite model.LedgerInvite
+
+	err := row.Scan(&invite.ID, &invite.LedgerID, &invite.Email, &invite.Role, &invite.InvitedBy, &invite.Created)
+
+	return invite, err
+}
+
+func scanAttachment(row scanner) (model.Attachment, error) {
+	var attachment model.Attachment
+
+	err := row.Scan(&attachment.ID, &attachment.ExpenseID, &attachment.UserID, &attachment.FileName,
+		&attachment.ContentType, &attachment.Size, &attachment.Created)
+
+	return attachment, err
+}
+
+func scanRefreshToken(row scanner) (model.RefreshToken, error) {
+	var token model.RefreshToken
+	var used sql.NullTime
+
+	err := row.Scan(&token.ID, &token.FamilyID, &token.UserID, &token.Created, &token.Expires, &used)
+	token.Used = used.Time
+
+	return token, err
+}
+
+func scanUserToken(row scanner) (model.UserToken, error) {
+	var token model.UserToken
+
+	err := row.Scan(&token.ID, &token.UserID, &token.Purpose, &token.Created, &token.Expires)
+
+	return token, err
+}
+
+func scanGoal(row scanner) (model.SavingsGoal, error) {
+	var goal model.SavingsGoal
+
+	err := row.Scan(&goal.ID, &goal.UserID, &goal.Name, &goal.Target, &goal.Currency, &goal.Deadline, &goal.CreatedAt)
+
+	return goal, err
+}
+
+func scanRecurrence(row scanner) (model.Recurrence, error) {
+	var recurrence model.Recurrence
+	var tags string
+
+	err := row.Scan(&recurrence.ID, &recurrence.UserID, &recurrence.Title, &recurrence.Price, &recurrence.Currency,
+		&recurrence.Type, &recurrence.IsSaving, &recurrence.Icon, &recurrence.CategoryID, &tags, &recurrence.Frequency, &recurrence.Interval,
+		&recurrence.MonthDay, &recurrence.Start, &recurrence.Until, &recurrence.Timezone, &recurrence.Next, &recurrence.AccountID)
+
+	// Tags can't contain commas, so they are kept in a single column
+	if tags != "" {
+		recurrence.Tags = strings.Split(tags, ",")
+	}
+
+	return recurrence, err
+}
+
+func scanExpense(row scanner) (model.Expense, error) {
+	var expense model.Expense
+
+	err := row.Scan(&expense.ID, &expense.UserID, &expense.Title, &expense.Price, &expense.Currency,
+		&expense.Date, &expense.Type, &expense.IsSaving, &expense.Icon, &expense.CategoryID, &expense.RecurrenceID, &expense.GoalID,
+		&expense.AccountID, &expense.TransferID, &expense.Incoming, &expense.LedgerID, &expense.PaidBy)
+
+	return expense, err
+}
+
+// Runs fn in a transaction, committed only when fn succeeds
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.db.ExecContext(ctx, s.rebind(query), args...)
+}
+
+// Executes a statement that must affect exactly one row, otherwise ErrNotFound
+func (s *SQLStore) execOne(ctx context.Context, query string, args ...interface{}) error {
+	res, err := s.exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStore) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, s.rebind(query), args...)
+}
+
+func (s *SQLStore) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.rebind(query), args...)
+}
+
+// Queries are written with ? placeholders, PostgreSQL wants $1, $2, ...
+func (s *SQLStore) rebind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Escapes the LIKE wildcards so user input only ever matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Translates driver errors into the storage-agnostic errors of this package
+func sqlErr(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	switch e := err.(type) {
+	case sqlite3.Error:
+		return e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	case *pq.Error:
+		return e.Code == "23505"
+	}
+
+	return false
+}
@@ -0,0 +1,189 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// UserStore - Persists and retrieves users, independent of the storage backend
+type UserStore interface {
+	InsertUser(ctx context.Context, user model.User) error
+	FindUserByEmail(ctx context.Context, email string) (model.User, error)
+	UpdateUser(ctx context.Context, user model.User) error
+	RemoveUserByEmail(ctx context.Context, email string) error
+	UserExists(ctx context.Context, email string) (bool, error)
+}
+
+// ExpenseStore - Persists and retrieves expenses, independent of the storage backend
+type ExpenseStore interface {
+	FindAllExpenses(ctx context.Context, user string) ([]model.Expense, error)
+	FindExpenses(ctx context.Context, user string, q ExpenseQuery) ([]model.Expense, *Cursor, error)
+	FindExpenseByID(ctx context.Context, id string) (model.Expense, error)
+	InsertExpense(ctx context.Context, expense model.Expense) error
+	// InsertTransfer stores both entries of a transfer, or neither
+	InsertTransfer(ctx context.Context, out model.Expense, in model.Expense) error
+	UpdateExpense(ctx context.Context, expense model.Expense) error
+	RemoveExpenseByID(ctx context.Context, id string) error
+	RemoveTransfer(ctx context.Context, transferID string) error
+	RemoveUserExpenses(ctx context.Context, email string) error
+	ReassignExpenseCategory(ctx context.Context, user string, from string, to string) error
+	ReassignExpenseGoal(ctx context.Context, user string, from string, to string) error
+}
+
+// CategoryStore - Persists and retrieves expense categories
+type CategoryStore interface {
+	InsertCategory(ctx context.Context, category model.Category) error
+	FindCategories(ctx context.Context, user string) ([]model.Category, error)
+	FindCategoryByID(ctx context.Context, id string) (model.Category, error)
+	UpdateCategory(ctx context.Context, category model.Category) error
+	RemoveCategoryByID(ctx context.Context, id string) error
+	RemoveUserCategories(ctx context.Context, user string) error
+}
+
+// TagStore - Reads and rewrites the tags across all of a user's expenses
+type TagStore interface {
+	TagCounts(ctx context.Context, user string) ([]model.TagCount, error)
+	// ReplaceTag swaps one tag for another on every expense carrying it, merging with the new
+	// tag where an expense already has both. Returns the number of expenses changed.
+	ReplaceTag(ctx context.Context, user string, from string, to string) (int, error)
+}
+
+// BudgetStore - Persists and retrieves spending budgets
+type BudgetStore interface {
+	InsertBudget(ctx context.Context, budget model.Budget) error
+	FindBudgets(ctx context.Context, user string) ([]model.Budget, error)
+	FindBudgetByID(ctx context.Context, id string) (model.Budget, error)
+	UpdateBudget(ctx context.Context, budget model.Budget) error
+	RemoveBudgetByID(ctx context.Context, id string) error
+	RemoveUserBudgets(ctx context.Context, user string) error
+}
+
+// RecurrenceStore - Persists recurring expense rules and tracks which occurrence is due next
+type RecurrenceStore interface {
+	InsertRecurrence(ctx context.Context, recurrence model.Recurrence) error
+	FindRecurrences(ctx context.Context, user string) ([]model.Recurrence, error)
+	FindRecurrenceByID(ctx context.Context, id string) (model.Recurrence, error)
+	UpdateRecurrence(ctx context.Context, recurrence model.Recurrence) error
+	RemoveRecurrenceByID(ctx context.Context, id string) error
+	RemoveUserRecurrences(ctx context.Context, user string) error
+	// FindDueRecurrences returns every user's rules with an occurrence due at or before now
+	FindDueRecurrences(ctx context.Context, now time.Time) ([]model.Recurrence, error)
+	// AdvanceRecurrence moves Next on only if it is still from, so racing schedulers can't move it back
+	AdvanceRecurrence(ctx context.Context, id string, from model.Date, to model.Date) error
+}
+
+// GoalStore - Persists and retrieves savings goals
+type GoalStore interface {
+	InsertGoal(ctx context.Context, goal model.SavingsGoal) error
+	FindGoals(ctx context.Context, user string) ([]model.SavingsGoal, error)
+	FindGoalByID(ctx context.Context, id string) (model.SavingsGoal, error)
+	UpdateGoal(ctx context.Context, goal model.SavingsGoal) error
+	RemoveGoalByID(ctx context.Context, id string) error
+	RemoveUserGoals(ctx context.Context, user string) error
+}
+
+// AccountStore - Persists and retrieves the accounts transactions are linked to
+type AccountStore interface {
+	InsertAccount(ctx context.Context, account model.Account) error
+	FindAccounts(ctx context.Context, user string) ([]model.Account, error)
+	FindAccountByID(ctx context.Context, id string) (model.Account, error)
+	UpdateAccount(ctx context.Context, account model.Account) error
+	RemoveAccountByID(ctx context.Context, id string) error
+	RemoveUserAccounts(ctx context.Context, user string) error
+}
+
+// LedgerStore - Persists shared ledgers, their members and pending invites
+type LedgerStore interface {
+	InsertLedger(ctx context.Context, ledger model.Ledger) error
+	// FindLedgers returns the ledgers the user is a member of
+	FindLedgers(ctx context.Context, user string) ([]model.Ledger, error)
+	FindLedgerByID(ctx context.Context, id string) (model.Ledger, error)
+	// UpdateLedger renames the ledger, members are changed with SetLedgerMember and RemoveLedgerMember
+	UpdateLedger(ctx context.Context, ledger model.Ledger) error
+	// RemoveLedgerByID removes the ledger with its members and invites. Its expenses stay with
+	// whoever recorded them, as private expenses.
+	RemoveLedgerByID(ctx context.Context, id string) error
+	// SetLedgerMember adds the member, or changes their role when they already belong to the ledger
+	SetLedgerMember(ctx context.Context, ledgerID string, member model.LedgerMember) error
+	RemoveLedgerMember(ctx context.Context, ledgerID string, user string) error
+	// RemoveUserLedgers removes the ledgers the user owns, their other memberships and the invites sent to them
+	RemoveUserLedgers(ctx context.Context, user string) error
+
+	InsertInvite(ctx context.Context, invite model.LedgerInvite) error
+	// FindInvites returns the invites sent to the email, oldest first
+	FindInvites(ctx context.Context, email string) ([]model.LedgerInvite, error)
+	// FindLedgerInvites returns the ledger's pending invites, oldest first
+	FindLedgerInvites(ctx context.Context, ledgerID string) ([]model.LedgerInvite, error)
+	FindInviteByID(ctx context.Context, id string) (model.LedgerInvite, error)
+	RemoveInviteByID(ctx context.Context, id string) error
+}
+
+// AttachmentStore - Persists what is known about the files attached to expenses, not their content
+type AttachmentStore interface {
+	InsertAttachment(ctx context.Context, attachment model.Attachment) error
+	// FindAttachments returns the expense's attachments, oldest first
+	FindAttachments(ctx context.Context, expenseID string) ([]model.Attachment, error)
+	// FindUserAttachments returns the attachments of every expense the user recorded
+	FindUserAttachments(ctx context.Context, user string) ([]model.Attachment, error)
+	FindAttachmentByID(ctx context.Context, id string) (model.Attachment, error)
+	RemoveAttachmentByID(ctx context.Context, id string) error
+	RemoveExpenseAttachments(ctx context.Context, expenseID string) error
+	RemoveUserAttachments(ctx context.Context, user string) error
+}
+
+// RefreshTokenStore - Persists refresh tokens, keyed by their hash
+type RefreshTokenStore interface {
+	InsertRefreshToken(ctx context.Context, token model.RefreshToken) error
+	FindRefreshToken(ctx context.Context, id string) (model.RefreshToken, error)
+	// UseRefreshToken marks the token exchanged at the time, returning ErrTokenUsed when it
+	// already was so only one of two racing exchanges succeeds
+	UseRefreshToken(ctx context.Context, id string, at time.Time) error
+	// RemoveTokenFamily revokes every refresh token descending from the same login
+	RemoveTokenFamily(ctx context.Context, familyID string) error
+	RemoveUserRefreshTokens(ctx context.Context, user string) error
+	// FindTokenFamilies returns the logins the user still holds refresh tokens for
+	FindTokenFamilies(ctx context.Context, user string) ([]string, error)
+}
+
+// UserTokenStore - Persists the single use tokens mailed to users, keyed by their hash
+type UserTokenStore interface {
+	InsertUserToken(ctx context.Context, token model.UserToken) error
+	// FindUserTokens returns the user's tokens for the purpose, oldest first
+	FindUserTokens(ctx context.Context, user string, purpose string) ([]model.UserToken, error)
+	// ConsumeUserToken removes the token for the purpose and returns it, so only one of two racing uses succeeds
+	ConsumeUserToken(ctx context.Context, id string, purpose string) (model.UserToken, error)
+	// RemoveUserTokens removes the user's tokens for the purpose, or for every purpose when it is empty
+	RemoveUserTokens(ctx context.Context, user string, purpose string) error
+}
+
+// RevocationStore - Remembers revoked access tokens, by their own ID or the ID of the login family
+// they belong to, until the tokens would have expired anyway
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, id string, expires time.Time) error
+	// TokenRevoked reports whether any of the IDs has been revoked and not yet expired
+	TokenRevoked(ctx context.Context, ids ...string) (bool, error)
+}
+
+// Store - A backend able to hold every kind of record used by the API
+type Store interface {
+	UserStore
+	ExpenseStore
+	CategoryStore
+	TagStore
+	BudgetStore
+	RecurrenceStore
+	GoalStore
+	AccountStore
+	LedgerStore
+	AttachmentStore
+	RefreshTokenStore
+	UserTokenStore
+	RevocationStore
+}
+
+// Migrator - Implemented by backends whose schema has to be brought up to date before use
+type Migrator interface {
+	Migrate(ctx context.Context) error
+}
@@ -0,0 +1,464 @@
+package dao
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// Runs the test against every backend that doesn't need a server, each with a fresh store holding the user
+func forEachStore(t *testing.T, user string, test func(t *testing.T, store Store)) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) Store
+	}{
+		{name: "memory", open: func(t *testing.T) Store { return NewMemoryStore() }},
+		{name: "sqlite", open: func(t *testing.T) Store { return newSQLiteStore(t) }},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.open(t)
+			if err := store.InsertUser(context.Background(), model.User{Email: user, Currency: "GBP"}); err != nil {
+				t.Fatal(err)
+			}
+
+			test(t, store)
+		})
+	}
+}
+
+func testExpense(user string, title string, price model.Money, day int, tags ...string) model.Expense {
+	return model.Expense{
+		ID:       model.NewID(),
+		UserID:   user,
+		Title:    title,
+		Price:    price,
+		Currency: "GBP",
+		Date:     model.NewDate(time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC)),
+		Type:     model.TypeExpense,
+		Tags:     tags,
+	}
+}
+
+func TestUsers(t *testing.T) {
+	forEachStore(t, "a@x.com", func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		if err := store.InsertUser(ctx, model.User{Email: "a@x.com"}); err != ErrEmailInUse {
+			t.Errorf("inserting the user again returned %v, want ErrEmailInUse", err)
+		}
+
+		user, err := store.FindUserByEmail(ctx, "a@x.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.Timezone = "Europe/London"
+		user.Verified = true
+		if err := store.UpdateUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+
+		if user, err = store.FindUserByEmail(ctx, "a@x.com"); err != nil {
+			t.Fatal(err)
+		}
+		if user.Timezone != "Europe/London" || !user.Verified {
+			t.Errorf("updated user = %+v", user)
+		}
+
+		if err := store.RemoveUserByEmail(ctx, "a@x.com"); err != nil {
+			t.Fatal(err)
+		}
+		if exists, err := store.UserExists(ctx, "a@x.com"); err != nil || exists {
+			t.Errorf("UserExists after removing = %t, %v", exists, err)
+		}
+		if _, err := store.FindUserByEmail(ctx, "b@x.com"); err != ErrNotFound {
+			t.Errorf("finding an unknown user returned %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestInsertExpenseDuplicate(t *testing.T) {
+	forEachStore(t, "a@x.com", func(t *testing.T, store Store) {
+		ctx := context.Background()
+		expense := testExpense("a@x.com", "Coffee", 300, 1)
+
+		if err := store.InsertExpense(ctx, expense); err != nil {
+			t.Fatal(err)
+		}
+		again := expense
+		again.Title = "Tea"
+		if err := store.InsertExpense(ctx, again); err != ErrDuplicate {
+			t.Errorf("inserting the expense again returned %v, want ErrDuplicate", err)
+		}
+
+		// The first one is left as it was, not overwritten or stored twice
+		expenses, err := store.FindAllExpenses(ctx, "a@x.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expenses) != 1 || expenses[0].Title != "Coffee" {
+			t.Errorf("stored expenses = %+v, want just the first", expenses)
+		}
+	})
+}
+
+func TestFindExpenses(t *testing.T) {
+	price := model.Money(500)
+
+	tests := []struct {
+		name  string
+		query ExpenseQuery
+		want  []string
+	}{
+		{name: "everything", query: ExpenseQuery{Sort: SortByDate}, want: []string{"Coffee", "Lunch", "Taxi", "Cinema"}},
+		{name: "newest first", query: ExpenseQuery{Sort: SortByDate, Descending: true}, want: []string{"Cinema", "Taxi", "Lunch", "Coffee"}},
+		{name: "date range", query: ExpenseQuery{Sort: SortByDate, From: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), To: time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC)}, want: []string{"Lunch", "Taxi"}},
+		{name: "title", query: ExpenseQuery{Sort: SortByDate, Title: "UNC"}, want: []string{"Lunch"}},
+		{name: "minimum price", query: ExpenseQuery{Sort: SortByDate, MinPrice: &price}, want: []string{"Lunch", "Cinema"}},
+		{name: "dearest first", query: ExpenseQuery{Sort: SortByPrice, Descending: true}, want: []string{"Lunch", "Cinema", "Taxi", "Coffee"}},
+		{name: "by title", query: ExpenseQuery{Sort: SortByTitle}, want: []string{"Cinema", "Coffee", "Lunch", "Taxi"}},
+	}
+
+	forEachStore(t, "a@x.com", func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		for _, expense := range []model.Expense{
+			testExpense("a@x.com", "Coffee", 300, 1, "food"),
+			testExpense("a@x.com", "Lunch", 1200, 2, "food", "work"),
+			testExpense("a@x.com", "Taxi", 400, 3, "travel"),
+			testExpense("a@x.com", "Cinema", 900, 4),
+		} {
+			if err := store.InsertExpense(ctx, expense); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				expenses, _, err := store.FindExpenses(ctx, "a@x.com", tt.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got := titles(expenses); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+
+		t.Run("pages", func(t *testing.T) {
+			var pages [][]string
+			q := ExpenseQuery{Sort: SortByDate, Limit: 3}
+			for {
+				expenses, next, err := store.FindExpenses(ctx, "a@x.com", q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pages = append(pages, titles(expenses))
+				if next == nil {
+					break
+				}
+				q.After = next
+			}
+
+			want := [][]string{{"Coffee", "Lunch", "Taxi"}, {"Cinema"}}
+			if !reflect.DeepEqual(pages, want) {
+				t.Errorf("pages = %v, want %v", pages, want)
+			}
+		})
+	})
+}
+
+func TestFindExpensesByTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		query ExpenseQuery
+		want  []string
+	}{
+		{name: "any tag", query: ExpenseQuery{Sort: SortByDate, Tags: []string{"food", "travel"}}, want: []string{"Coffee", "Lunch", "Taxi"}},
+		{name: "all tags", query: ExpenseQuery{Sort: SortByDate, Tags: []string{"food", "work"}, AllTags: true}, want: []string{"Lunch"}},
+		{name: "unused tag", query: ExpenseQuery{Sort: SortByDate, Tags: []string{"gifts"}}, want: nil},
+	}
+
+	forEachStore(t, "a@x.com", func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		for _, expense := range []model.Expense{
+			testExpense("a@x.com", "Coffee", 300, 1, "food"),
+			testExpense("a@x.com", "Lunch", 1200, 2, "food", "work"),
+			testExpense("a@x.com", "Taxi", 400, 3, "travel"),
+			testExpense("a@x.com", "Cinema", 900, 4),
+		} {
+			if err := store.InsertExpense(ctx, expense); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				expenses, _, err := store.FindExpenses(ctx, "a@x.com", tt.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := titles(expenses); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+
+		// Renaming a tag onto one the expense already has merges the two
+		changed, err := store.ReplaceTag(ctx, "a@x.com", "work", "food")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != 1 {
+			t.Errorf("ReplaceTag changed %d expenses, want 1", changed)
+		}
+
+		counts, err := store.TagCounts(ctx, "a@x.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]int{"food": 2, "travel": 1}
+		got := map[string]int{}
+		for _, count := range counts {
+			got[count.Tag] = count.Count
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("tag counts = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestRefreshTokenFamily(t *testing.T) {
+	forEachStore(t, "a@x.com", func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		first, _ := model.NewRefreshToken("a@x.com", "", time.Hour)
+		second, _ := model.NewRefreshToken("a@x.com", first.FamilyID, time.Hour)
+		other, _ := model.NewRefreshToken("a@x.com", "", time.Hour)
+		for _, token := range []model.RefreshToken{first, second, other} {
+			if err := store.InsertRefreshToken(ctx, token); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := store.UseRefreshToken(ctx, first.ID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.UseRefreshToken(ctx, first.ID, time.Now()); err != ErrTokenUsed {
+			t.Errorf("using the token again returned %v, want ErrTokenUsed", err)
+		}
+
+		if err := store.RemoveTokenFamily(ctx, first.FamilyID); err != nil {
+			t.Fatal(err)
+		}
+		for _, token := range []model.RefreshToken{first, second} {
+			if _, err := store.FindRefreshToken(ctx, token.ID); err != ErrNotFound {
+				t.Errorf("token of the removed family returned %v, want ErrNotFound", err)
+			}
+		}
+		if _, err := store.FindRefreshToken(ctx, other.ID); err != nil {
+			t.Errorf("token of another family returned %v", err)
+		}
+
+		families, err := store.FindTokenFamilies(ctx, "a@x.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(families) != 1 || families[0] != other.FamilyID {
+			t.Errorf("families left = %v, want [%s]", families, other.FamilyID)
+		}
+	})
+}
+
+func TestRevocations(t *testing.T) {
+	forEachStore(t, "a@x.com", func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		if err := store.RevokeToken(ctx, "family", time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RevokeToken(ctx, "expired", time.Now().Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			ids  []string
+			want bool
+		}{
+			{ids: []string{"token", "family"}, want: true},
+			{ids: []string{"token"}, want: false},
+			{ids: []string{"expired"}, want: false},
+		}
+
+		for _, tt := range tests {
+			revoked, err := store.TokenRevoked(ctx, tt.ids...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revoked != tt.want {
+				t.Errorf("TokenRevoked(%v) = %t, want %t", tt.ids, revoked, tt.want)
+			}
+		}
+	})
+}
+
+func TestConsumeUserToken(t *testing.T) {
+	forEachStore(t, "a@x.com", func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		token, _ := model.NewUserToken("a@x.com", model.TokenPasswordReset, time.Hour)
+		if err := store.InsertUserToken(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.ConsumeUserToken(ctx, token.ID, model.TokenEmailVerification); err != ErrNotFound {
+			t.Errorf("consuming for another purpose returned %v, want ErrNotFound", err)
+		}
+		if _, err := store.ConsumeUserToken(ctx, token.ID, model.TokenPasswordReset); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ConsumeUserToken(ctx, token.ID, model.TokenPasswordReset); err != ErrNotFound {
+			t.Errorf("consuming twice returned %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func titles(expenses []model.Expense) []string {
+	var titles []string
+	for _, expense := range expenses {
+		titles = append(titles, expense.Title)
+	}
+
+	return titles
+}
+
+// A migrated SQLite store in a file of its own, closed when the test ends
+func newSQLiteStore(t *testing.T) *SQLStore {
+	store, err := NewSQLStore("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.db.Close() })
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestMigrateRecordsEachVersionOnce(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteStore(t)
+
+	// Everything is applied already, so nothing runs again
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var applied, distinct int
+	if err := store.db.QueryRowContext(ctx, "SELECT COUNT(*), COUNT(DISTINCT version) FROM schema_migrations").Scan(&applied, &distinct); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(migrations) || distinct != applied {
+		t.Errorf("schema_migrations holds %d rows for %d versions, want one for each of the %d migrations", applied, distinct, len(migrations))
+	}
+}
+
+// Free-form dates that can't be parsed stop the migration, rather than being lost when the old column is dropped
+func TestMigrateRefusesUnparseableDates(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := NewSQLStore("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.db.Close() })
+
+	// Migrate as far as the free-form dates
+	all := migrations
+	migrations = all[:4]
+	err = store.Migrate(ctx)
+	migrations = all
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stmt := range []string{
+		`INSERT INTO users (email, password, token, currency) VALUES ('a@x.com', '', '', 'GBP')`,
+		`INSERT INTO expenses (id, user_id, title, date, is_saving, icon, price, currency) VALUES ('good', 'a@x.com', 'Coffee', '2019-08-15', FALSE, '', 300, 'GBP')`,
+		`INSERT INTO expenses (id, user_id, title, date, is_saving, icon, price, currency) VALUES ('bad', 'a@x.com', 'Lunch', 'last Tuesday', FALSE, '', 800, 'GBP')`,
+	} {
+		if _, err := store.db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.Migrate(ctx); err == nil || !strings.Contains(err.Error(), "bad") || strings.Contains(err.Error(), "good") {
+		t.Fatalf("migrate returned %v, want it to name the expense whose date can't be parsed", err)
+	}
+
+	var date string
+	if err := store.db.QueryRowContext(ctx, "SELECT date FROM expenses WHERE id = 'bad'").Scan(&date); err != nil || date != "last Tuesday" {
+		t.Errorf("date was left as %q, %v, want it untouched", date, err)
+	}
+
+	// Once it's corrected the migration carries on
+	if _, err := store.db.ExecContext(ctx, "UPDATE expenses SET date = '13/08/2019' WHERE id = 'bad'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string]time.Time{
+		"good": time.Date(2019, 8, 15, 0, 0, 0, 0, time.UTC),
+		"bad":  time.Date(2019, 8, 13, 0, 0, 0, 0, time.UTC),
+	} {
+		expense, err := store.FindExpenseByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !expense.Date.Equal(want) {
+			t.Errorf("expense %s is dated %s, want %s", id, expense.Date, want)
+		}
+	}
+}
+
+// Removing a user takes their rows with them through the foreign keys, on every connection of the pool
+func TestSQLiteForeignKeys(t *testing.T) {
+	ctx := context.Background()
+
+	store := newSQLiteStore(t)
+
+	// The connection is replaced after every use, as a pool might do at any time
+	store.db.SetConnMaxLifetime(time.Nanosecond)
+	store.db.SetMaxIdleConns(0)
+
+	if err := store.InsertExpense(ctx, testExpense("nobody@x.com", "Coffee", 300, 1)); err == nil {
+		t.Error("inserted an expense for a user that doesn't exist")
+	}
+
+	if err := store.InsertUser(ctx, model.User{Email: "a@x.com"}); err != nil {
+		t.Fatal(err)
+	}
+	expense := testExpense("a@x.com", "Coffee", 300, 1)
+	if err := store.InsertExpense(ctx, expense); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.RemoveUserByEmail(ctx, "a@x.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.FindExpenseByID(ctx, expense.ID); err != ErrNotFound {
+		t.Errorf("expense of the removed user returned %v, want ErrNotFound", err)
+	}
+}
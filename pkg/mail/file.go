@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FileMailer - Writes every email as an .eml file under a directory instead of sending it,
+// so mail can be opened in a mail client while testing locally
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+var _ Mailer = (*FileMailer)(nil)
+
+// NewFileMailer - Returns a mailer writing under dir, which is created when the first email is sent
+func NewFileMailer(dir string, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+// Send - Writes the message to a file named after when it was sent
+func (f *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+
+	content, err := msg.format(f.from, now)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(f.dir, fmt.Sprintf("%s-*.eml", now.UTC().Format("20060102T150405.000000000")))
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
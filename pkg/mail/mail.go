@@ -0,0 +1,99 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// ErrInvalidHeader - Returned for messages whose address or subject could inject headers
+var ErrInvalidHeader = errors.New("Invalid mail header")
+
+// Message - A plain text email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer - Sends email, independent of how it is delivered
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer - Writes every email to the log instead of sending it, for local development
+type LogMailer struct{}
+
+var _ Mailer = LogMailer{}
+
+// Send - Logs the message
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := msg.check(); err != nil {
+		return err
+	}
+
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+
+	return nil
+}
+
+// Rejects line breaks in the headers and recipients that aren't a single address
+func (msg Message) check() error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return ErrInvalidHeader
+	}
+
+	return nil
+}
+
+// Lays the message out as an RFC 5322 email from the sender, with the body quoted-printable
+// so any line length and character set gets through
+func (msg Message) format(from string, now time.Time) ([]byte, error) {
+	if err := msg.check(); err != nil {
+		return nil, err
+	}
+
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	domain := sender.Address[strings.LastIndex(sender.Address, "@")+1:]
+
+	var buf bytes.Buffer
+	buf.WriteString("From: " + sender.String() + "\r\n")
+	buf.WriteString("To: " + msg.To + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	buf.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("Message-ID: <" + hex.EncodeToString(id[:]) + "@" + domain + ">\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
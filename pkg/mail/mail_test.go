@@ -0,0 +1,77 @@
+package mail
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatRejectsHeaderInjection(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{name: "line break in the recipient", msg: Message{To: "a@x.com\r\nBcc: b@x.com", Subject: "Hi"}},
+		{name: "line break in the subject", msg: Message{To: "a@x.com", Subject: "Hi\nBcc: b@x.com"}},
+		{name: "several recipients", msg: Message{To: "a@x.com, b@x.com", Subject: "Hi"}},
+		{name: "not an address", msg: Message{To: "someone", Subject: "Hi"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.msg.format("Money Tracker <no-reply@x.com>", time.Now()); err != ErrInvalidHeader {
+				t.Errorf("format returned %v, want ErrInvalidHeader", err)
+			}
+		})
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := NewFileMailer(dir, "Money Tracker <no-reply@x.com>")
+
+	msg := Message{To: "a@x.com", Subject: "Grüße", Body: "Follow this link:\n\nhttps://app.example.com/reset?token=" + strings.Repeat("a", 100) + "\n"}
+	if err := mailer.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("found %v, %v, want one email", files, err)
+	}
+
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// The file reads back as the same message
+	parsed, err := mail.ReadMessage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to := parsed.Header.Get("To"); to != msg.To {
+		t.Errorf("To = %q, want %q", to, msg.To)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q, %v, want %q", subject, err, msg.Subject)
+	}
+
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.ReplaceAll(string(body), "\r\n", "\n"); got != msg.Body {
+		t.Errorf("body = %q, want %q", got, msg.Body)
+	}
+}
@@ -0,0 +1,27 @@
+package model
+
+// Kinds of account a user can hold
+var accountTypes = map[string]bool{
+	"cash":    true,
+	"current": true,
+	"savings": true,
+	"credit":  true,
+}
+
+// Account - Somewhere the user keeps money, such as a wallet, a current account or a credit card.
+// Its balance is the opening balance plus the flow of every transaction linked to it.
+type Account struct {
+	ID     string `bson:"_id" json:"id"`
+	UserID string `bson:"userID" json:"userID"`
+	Name   string `bson:"name" json:"name"`
+	// Type is cash, current, savings or credit
+	Type     string `bson:"type" json:"type"`
+	Currency string `bson:"currency" json:"currency"`
+	// OpeningBalance is what the account held before its first transaction, negative for money owed
+	OpeningBalance Money `bson:"openingBalance" json:"openingBalance"`
+}
+
+// ValidAccountType - Checks the type is cash, current, savings or credit
+func ValidAccountType(t string) bool {
+	return accountTypes[t]
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Attachment - A file such as a receipt photo kept with an expense. The content itself is
+// held in blob storage under Key, this only describes it.
+type Attachment struct {
+	ID        string `bson:"_id" json:"id"`
+	ExpenseID string `bson:"expenseID" json:"expenseID"`
+	// UserID is whoever recorded the expense, so the attachment goes when they do
+	UserID   string `bson:"userID" json:"userID"`
+	FileName string `bson:"fileName" json:"fileName"`
+	// ContentType is detected from the content rather than trusted from the upload
+	ContentType string    `bson:"contentType" json:"contentType"`
+	Size        int64     `bson:"size" json:"size"`
+	Created     time.Time `bson:"created" json:"created"`
+}
+
+// Key - Where the attachment's content is kept in blob storage
+func (a Attachment) Key() string {
+	return "attachments/" + a.ExpenseID + "/" + a.ID
+}
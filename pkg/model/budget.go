@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+)
+
+// DefaultAlertPercent - Share of a budget spent at which the first alert is sent, when the budget doesn't say
+const DefaultAlertPercent = 80
+
+// budgetPeriods maps budget periods to the period names understood by PeriodRange
+var budgetPeriods = map[string]string{
+	"weekly":  "week",
+	"monthly": "month",
+	"yearly":  "year",
+}
+
+// Budget - A spending limit per period, for all of a user's spending or just one category or tag
+type Budget struct {
+	ID       string `bson:"_id" json:"id"`
+	UserID   string `bson:"userID" json:"userID"`
+	Name     string `bson:"name" json:"name"`
+	Amount   Money  `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency"`
+	// Period is weekly, monthly or yearly
+	Period string `bson:"period" json:"period"`
+	// CategoryID and Tag narrow the budget, empty means every expense counts
+	CategoryID string `bson:"categoryID" json:"categoryID"`
+	Tag        string `bson:"tag" json:"tag"`
+	// AlertPercent is when the first alert is sent, a second is always sent when the budget is exceeded
+	AlertPercent int `bson:"alertPercent" json:"alertPercent"`
+}
+
+// ValidBudgetPeriod - Checks the period is weekly, monthly or yearly
+func ValidBudgetPeriod(period string) bool {
+	_, ok := budgetPeriods[period]
+	return ok
+}
+
+// Range - Start and exclusive end of the budget period containing t, in t's location
+func (b Budget) Range(t time.Time) (time.Time, time.Time) {
+	start, end, _ := PeriodRange(budgetPeriods[b.Period], t)
+	return start, end
+}
+
+// BudgetAlert - Sent over the expense stream when an expense takes a budget past a threshold
+type BudgetAlert struct {
+	// Type tells alerts apart from the expenses sharing the stream, always "budgetAlert"
+	Type     string    `json:"type"`
+	UserID   string    `json:"userID"`
+	BudgetID string    `json:"budgetID"`
+	Name     string    `json:"name"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Amount   Money     `json:"amount"`
+	Spent    Money     `json:"spent"`
+	Currency string    `json:"currency"`
+	// Percent is the threshold that was crossed, 100 or more means the budget is exceeded
+	Percent  int  `json:"percent"`
+	Exceeded bool `json:"exceeded"`
+}
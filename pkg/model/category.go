@@ -0,0 +1,44 @@
+package model
+
+import (
+	"regexp"
+)
+
+// Category - A user's own classification for expenses, optionally nested under a parent category
+type Category struct {
+	ID       string `bson:"_id" json:"id"`
+	UserID   string `bson:"userID" json:"userID"`
+	Name     string `bson:"name" json:"name"`
+	Icon     string `bson:"icon" json:"icon"`
+	Colour   string `bson:"colour" json:"colour"`
+	ParentID string `bson:"parentID" json:"parentID"`
+}
+
+var colourCode = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ValidColour - Checks the colour is a hex code such as #4caf50
+func ValidColour(colour string) bool {
+	return colourCode.MatchString(colour)
+}
+
+// DefaultCategories - The set every new user starts with, owned by the user and with fresh IDs
+func DefaultCategories(user string) []Category {
+	defaults := []Category{
+		{Name: "Groceries", Icon: "shopping_cart", Colour: "#4caf50"},
+		{Name: "Eating out", Icon: "restaurant", Colour: "#ff9800"},
+		{Name: "Transport", Icon: "directions_bus", Colour: "#2196f3"},
+		{Name: "Housing", Icon: "home", Colour: "#795548"},
+		{Name: "Bills", Icon: "receipt", Colour: "#607d8b"},
+		{Name: "Entertainment", Icon: "movie", Colour: "#9c27b0"},
+		{Name: "Health", Icon: "local_hospital", Colour: "#f44336"},
+		{Name: "Savings", Icon: "savings", Colour: "#009688"},
+		{Name: "Other", Icon: "category", Colour: "#9e9e9e"},
+	}
+
+	for i := range defaults {
+		defaults[i].ID = NewID()
+		defaults[i].UserID = user
+	}
+
+	return defaults
+}
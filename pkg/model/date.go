@@ -0,0 +1,237 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// CalendarDate - Layout for dates without a time of day
+const CalendarDate = "2006-01-02"
+
+// ErrInvalidDate - Returned when a client sends a date that is neither RFC 3339 nor a calendar date
+var ErrInvalidDate = errors.New("Date must be an RFC 3339 timestamp or a calendar date such as 2019-08-15")
+
+// Layouts free-form dates were stored in before dates were typed, tried in order by ParseLegacyDate
+var legacyDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05",
+	CalendarDate,
+	"2006/01/02",
+	"02/01/2006",
+	"02-01-2006",
+	"Mon Jan 02 2006 15:04:05 GMT-0700",
+	"Mon Jan 02 2006",
+	"Mon Jan _2 2006",
+	"2 January 2006",
+	"January 2, 2006",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// Date - When something happened, stored as a native date in every backend.
+// Clients may send RFC 3339 timestamps or calendar dates, responses are always RFC 3339 in UTC.
+type Date struct {
+	time.Time
+
+	// Set when parsed from a calendar date, which has no timezone until Resolve gives it one
+	calendar bool
+}
+
+// NewDate - Wraps a time, normalised to UTC
+func NewDate(t time.Time) Date {
+	return Date{Time: t.UTC()}
+}
+
+// ParseDate - Parses an RFC 3339 timestamp or a calendar date.
+// Calendar dates are held as midnight UTC until Resolve places them in the user's timezone.
+func ParseDate(s string) (Date, error) {
+	s = strings.TrimSpace(s)
+
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return NewDate(t), nil
+	}
+
+	if t, err := time.Parse(CalendarDate, s); err == nil {
+		return Date{Time: t, calendar: true}, nil
+	}
+
+	return Date{}, ErrInvalidDate
+}
+
+// ParseLegacyDate - Leniently parses the formats clients used to send free-form dates in, assuming UTC
+func ParseLegacyDate(s string) (Date, error) {
+	s = strings.TrimSpace(s)
+
+	for _, layout := range legacyDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return NewDate(t), nil
+		}
+	}
+
+	// Milliseconds since the epoch, as produced by JavaScript's Date.now()
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return NewDate(time.Unix(0, ms*int64(time.Millisecond))), nil
+	}
+
+	return Date{}, ErrInvalidDate
+}
+
+// Resolve - Places a calendar date at midnight in loc. Timestamps already carry an offset and are unchanged.
+func (d Date) Resolve(loc *time.Location) Date {
+	if !d.calendar {
+		return d
+	}
+
+	return NewDate(time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc))
+}
+
+// IsCalendarDate - Whether the date was given without a time of day
+func (d Date) IsCalendarDate() bool {
+	return d.calendar
+}
+
+// MarshalJSON - Writes RFC 3339 in UTC, or null for a missing date
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+
+	return []byte(strconv.Quote(d.UTC().Format(time.RFC3339))), nil
+}
+
+// UnmarshalJSON - Accepts an RFC 3339 timestamp, a calendar date, or null
+func (d *Date) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*d = Date{}
+		return nil
+	}
+
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return ErrInvalidDate
+	}
+
+	if s == "" {
+		*d = Date{}
+		return nil
+	}
+
+	parsed, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+
+	return nil
+}
+
+// MarshalBSONValue - Stores the date as a BSON datetime
+func (d Date) MarshalBSONValue() (byte, []byte, error) {
+	var typ bson.Type
+	var data []byte
+	var err error
+
+	if d.IsZero() {
+		typ, data, err = bson.MarshalValue(nil)
+	} else {
+		typ, data, err = bson.MarshalValue(d.UTC())
+	}
+
+	return byte(typ), data, err
+}
+
+// UnmarshalBSONValue - Reads a BSON datetime, or a free-form string written before dates were typed
+func (d *Date) UnmarshalBSONValue(typ byte, data []byte) error {
+	raw := bson.RawValue{Type: bson.Type(typ), Value: data}
+
+	switch raw.Type {
+	case bson.TypeDateTime:
+		var t time.Time
+		if err := raw.Unmarshal(&t); err != nil {
+			return err
+		}
+		*d = NewDate(t)
+	case bson.TypeString:
+		// Written before dates were typed, the migration refuses to finish while any can't be parsed
+		parsed, err := ParseLegacyDate(raw.StringValue())
+		if err != nil {
+			return err
+		}
+		*d = parsed
+	default:
+		*d = Date{}
+	}
+
+	return nil
+}
+
+// Value - Stores the date as a SQL timestamp in UTC.
+// Truncated to whole seconds so SQLite, which keeps timestamps as text, still compares them in order.
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+
+	return d.UTC().Truncate(time.Second), nil
+}
+
+// Scan - Reads a SQL timestamp. Some SQLite drivers hand timestamps back as text.
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Date{}
+	case time.Time:
+		*d = NewDate(v)
+	case string:
+		return d.scanText(v)
+	case []byte:
+		return d.scanText(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into a date", src)
+	}
+
+	return nil
+}
+
+func (d *Date) scanText(s string) error {
+	parsed, err := ParseLegacyDate(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+
+	return nil
+}
+
+// PeriodRange - Start and exclusive end of the day, week, month or year containing t, in t's location.
+// Weeks start on Monday.
+func PeriodRange(period string, t time.Time) (time.Time, time.Time, error) {
+	y, m, d := t.Date()
+	loc := t.Location()
+
+	switch period {
+	case "day":
+		start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 1), nil
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		start := time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 7), nil
+	case "month":
+		start := time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0), nil
+	case "year":
+		start := time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(1, 0, 0), nil
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown period %q", period)
+}
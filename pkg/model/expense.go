@@ -1,15 +1,121 @@
-package model
-
-import (
-	"gopkg.in/mgo.v2/bson"
-)
-
-type Expense struct {
-	ID       bson.ObjectId `bson:"_id" json:"id"`
-	UserID   string        `bson:"userID" json:"userID"`
-	Title    string        `bson:"title" json:"title"`
-	Price    float32       `bson:"price" json:"price"`
-	Date     string        `bson:"date" json:"date"`
-	IsSaving bool          `bson:"isSaving" json:"isSaving"`
-	Icon     string        `bson:"icon" json:"icon"`
-}
+package model
+
+// Transaction types an expense entry can record. Entries stored before types existed have none
+// and are treated as expenses, or savings when IsSaving is set.
+const (
+	TypeExpense  = "expense"
+	TypeIncome   = "income"
+	TypeSaving   = "saving"
+	TypeTransfer = "transfer"
+	// TypeSettlement pays back money owed between the members of a shared ledger
+	TypeSettlement = "settlement"
+)
+
+// Expense - The ID is an opaque string so any storage backend can key it
+type Expense struct {
+	ID string `bson:"-" json:"id"`
+	// UserID is whoever recorded the expense, their categories, accounts and goals are the ones it links to
+	UserID string `bson:"userID" json:"userID"`
+	// LedgerID is the shared ledger the expense belongs to, empty when it is private to the user
+	LedgerID string `bson:"ledgerID,omitempty" json:"ledgerID,omitempty"`
+	// PaidBy is the ledger member who paid, whoever recorded the expense when empty
+	PaidBy   string `bson:"paidBy,omitempty" json:"paidBy,omitempty"`
+	Title    string `bson:"title" json:"title"`
+	Price    Money  `bson:"price" json:"price"`
+	Currency string `bson:"currency" json:"currency"`
+	Date     Date   `bson:"date" json:"date"`
+	// Type is expense, income, saving, transfer or settlement
+	Type string `bson:"type" json:"type"`
+	// IsSaving is kept in step with Type for clients that predate it
+	IsSaving bool   `bson:"isSaving" json:"isSaving"`
+	Icon     string `bson:"icon" json:"icon"`
+	// AccountID is the account the money came out of or went into, empty when not tracked
+	AccountID string `bson:"accountID,omitempty" json:"accountID,omitempty"`
+	// TransferID pairs the two entries of a transfer or settlement, Incoming marks the one receiving the money
+	TransferID string `bson:"transferID,omitempty" json:"transferID,omitempty"`
+	Incoming   bool   `bson:"incoming,omitempty" json:"incoming,omitempty"`
+	// CategoryID refers to one of the user's categories, empty when uncategorised
+	CategoryID string `bson:"categoryID" json:"categoryID"`
+	// Tags are free-form labels, normalised to lower case, unique and sorted
+	Tags []string `bson:"tags,omitempty" json:"tags,omitempty"`
+	// Splits divide the price between categories or people. They add up to the price,
+	// and when there are any the expense itself has no category.
+	Splits []Split `bson:"splits,omitempty" json:"splits,omitempty"`
+	// GoalID links a saving to the savings goal it counts towards
+	GoalID string `bson:"goalID,omitempty" json:"goalID,omitempty"`
+	// RecurrenceID is set on expenses created by a recurring rule
+	RecurrenceID string `bson:"recurrenceID,omitempty" json:"recurrenceID,omitempty"`
+
+	// Converted is only filled in on responses, when the client asks for another currency
+	Converted *Conversion `bson:"-" json:"converted,omitempty"`
+}
+
+// ValidTransactionType - Checks the type is expense, income, saving, transfer or settlement
+func ValidTransactionType(t string) bool {
+	switch t {
+	case TypeExpense, TypeIncome, TypeSaving, TypeTransfer, TypeSettlement:
+		return true
+	}
+
+	return false
+}
+
+// ResolveType - Fills in a missing Type from IsSaving, then keeps IsSaving in step with Type
+func (e *Expense) ResolveType() {
+	e.Type, e.IsSaving = resolveType(e.Type, e.IsSaving)
+}
+
+func resolveType(t string, isSaving bool) (string, bool) {
+	if t == "" {
+		t = TypeExpense
+		if isSaving {
+			t = TypeSaving
+		}
+	}
+
+	return t, t == TypeSaving
+}
+
+// Flow - What the entry does to its account's balance: income and the incoming side of transfers
+// and settlements add to it, everything else takes away from it
+func (e Expense) Flow() Money {
+	if e.Type == TypeIncome || e.Incoming {
+		return e.Price
+	}
+
+	return -e.Price
+}
+
+// Payer - The ledger member who paid for the expense
+func (e Expense) Payer() string {
+	if e.PaidBy != "" {
+		return e.PaidBy
+	}
+
+	return e.UserID
+}
+
+// Split - One line of a split expense
+type Split struct {
+	Amount     Money  `bson:"amount" json:"amount"`
+	CategoryID string `bson:"categoryID" json:"categoryID"`
+	// Person is who the line is for, empty for the user's own share
+	Person string `bson:"person,omitempty" json:"person,omitempty"`
+	Note   string `bson:"note,omitempty" json:"note,omitempty"`
+}
+
+// Lines - The split lines, or a single line for the whole price when the expense isn't split
+func (e Expense) Lines() []Split {
+	if len(e.Splits) > 0 {
+		return e.Splits
+	}
+
+	return []Split{{Amount: e.Price, CategoryID: e.CategoryID}}
+}
+
+// Conversion - An amount converted into another currency on request, never stored
+type Conversion struct {
+	Price    Money  `json:"price"`
+	Currency string `json:"currency"`
+	Rate     string `json:"rate"`
+}
@@ -0,0 +1,14 @@
+package model
+
+// SavingsGoal - An amount the user is saving towards, optionally by a deadline.
+// Saving expenses count towards the goal they are linked to with GoalID.
+type SavingsGoal struct {
+	ID       string `bson:"_id" json:"id"`
+	UserID   string `bson:"userID" json:"userID"`
+	Name     string `bson:"name" json:"name"`
+	Target   Money  `bson:"target" json:"target"`
+	Currency string `bson:"currency" json:"currency"`
+	// Deadline is optional, without one no monthly contribution is worked out
+	Deadline  Date `bson:"deadline" json:"deadline"`
+	CreatedAt Date `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// NewID - Generates a 24 character hex ID laid out like a MongoDB ObjectId:
+// a 4 byte timestamp followed by 8 random bytes, so IDs sort roughly by creation time.
+func NewID() string {
+	var b [12]byte
+
+	binary.BigEndian.PutUint32(b[:4], uint32(time.Now().Unix()))
+	if _, err := rand.Read(b[4:]); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,71 @@
+package model
+
+import "time"
+
+// Roles a member can hold in a ledger
+const (
+	// RoleOwner can do everything, including managing members and deleting the ledger
+	RoleOwner = "owner"
+	// RoleEditor can add, change and remove expenses
+	RoleEditor = "editor"
+	// RoleViewer can only read the ledger's expenses
+	RoleViewer = "viewer"
+)
+
+// Ledger - A set of expenses shared between several users, such as a couple or a household.
+// Expenses without a ledger are private to the user who recorded them.
+type Ledger struct {
+	ID   string `bson:"_id" json:"id"`
+	Name string `bson:"name" json:"name"`
+	// Members always include exactly one owner
+	Members []LedgerMember `bson:"members" json:"members"`
+}
+
+// LedgerMember - A user and what they are allowed to do in a ledger
+type LedgerMember struct {
+	UserID string `bson:"userID" json:"userID"`
+	// Role is owner, editor or viewer
+	Role string `bson:"role" json:"role"`
+}
+
+// LedgerInvite - An invitation for whoever holds the email to join a ledger, pending until accepted or declined
+type LedgerInvite struct {
+	ID       string `bson:"_id" json:"id"`
+	LedgerID string `bson:"ledgerID" json:"ledgerID"`
+	Email    string `bson:"email" json:"email"`
+	// Role is the one the member gets on accepting, editor or viewer
+	Role      string    `bson:"role" json:"role"`
+	InvitedBy string    `bson:"invitedBy" json:"invitedBy"`
+	Created   time.Time `bson:"created" json:"created"`
+}
+
+// ValidMemberRole - Checks the role is one that can be given to an invited member, editor or viewer
+func ValidMemberRole(role string) bool {
+	return role == RoleEditor || role == RoleViewer
+}
+
+// CanEdit - Whether the role allows changing the ledger's expenses
+func CanEdit(role string) bool {
+	return role == RoleOwner || role == RoleEditor
+}
+
+// Role - The user's role in the ledger, empty when they aren't a member
+func (l Ledger) Role(user string) string {
+	for _, member := range l.Members {
+		if member.UserID == user {
+			return member.Role
+		}
+	}
+
+	return ""
+}
+
+// MemberIDs - The users belonging to the ledger
+func (l Ledger) MemberIDs() []string {
+	ids := make([]string, 0, len(l.Members))
+	for _, member := range l.Members {
+		ids = append(ids, member.UserID)
+	}
+
+	return ids
+}
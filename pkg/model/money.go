@@ -0,0 +1,105 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money - An exact amount counted in minor units (hundredths, e.g. pence or cents),
+// so sums never drift the way float32 prices did.
+// Serialised to JSON as a fixed-point string such as "12.34", but plain JSON numbers are accepted too.
+type Money int64
+
+// ErrInvalidMoney - Returned when an amount isn't a number or has more than two decimal places
+var ErrInvalidMoney = errors.New("Amount must be a number with at most two decimal places")
+
+var hundred = big.NewRat(100, 1)
+
+// Plain decimals only, big.Rat would also take fractions, exponents, hex, binary and underscores
+var decimal = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+// ParseMoney - Parses a decimal string such as "12.34" or "-5" without going through a float
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if !decimal.MatchString(s) {
+		return 0, ErrInvalidMoney
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, ErrInvalidMoney
+	}
+
+	r.Mul(r, hundred)
+	if !r.IsInt() || !r.Num().IsInt64() {
+		return 0, ErrInvalidMoney
+	}
+
+	return Money(r.Num().Int64()), nil
+}
+
+// String - Formats the amount with exactly two decimal places
+func (m Money) String() string {
+	sign := ""
+	minor := uint64(m)
+	if m < 0 {
+		sign = "-"
+		minor = -minor
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, minor/100, minor%100)
+}
+
+// MarshalJSON - Encodes the amount as a fixed-point string
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
+
+// UnmarshalJSON - Accepts either "12.34" or 12.34
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+
+	if strings.HasPrefix(s, `"`) {
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return ErrInvalidMoney
+		}
+		s = unquoted
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+
+	return nil
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ISO 4217 codes whose minor unit isn't a hundredth, which Money can't hold
+var notHundredths = map[string]bool{
+	// No decimal places
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true, "KMF": true, "KRW": true, "PYG": true,
+	"RWF": true, "UGX": true, "UYI": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+	// Three decimal places
+	"BHD": true, "IQD": true, "JOD": true, "KWD": true, "LYD": true, "OMR": true, "TND": true,
+	// Four decimal places
+	"CLF": true, "UYW": true,
+	// Precious metals, funds and testing codes, which have no minor unit
+	"XAG": true, "XAU": true, "XBA": true, "XBB": true, "XBC": true, "XBD": true, "XDR": true, "XPD": true, "XPT": true,
+	"XSU": true, "XTS": true, "XUA": true, "XXX": true,
+}
+
+// ValidCurrency - Checks the code looks like an ISO 4217 currency code such as GBP, counted in hundredths
+func ValidCurrency(code string) bool {
+	return currencyCode.MatchString(code) && !notHundredths[code]
+}
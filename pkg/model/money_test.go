@@ -0,0 +1,63 @@
+package model
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		err  error
+	}{
+		{in: "12.34", want: 1234},
+		{in: "-5", want: -500},
+		{in: " 0.1 ", want: 10},
+		{in: "1.5", want: 150},
+		{in: "92233720368547758.07", want: 9223372036854775807},
+		{in: "1.234", err: ErrInvalidMoney},
+		{in: "92233720368547758.08", err: ErrInvalidMoney},
+		{in: "", err: ErrInvalidMoney},
+		{in: "abc", err: ErrInvalidMoney},
+		{in: "1/2", err: ErrInvalidMoney},
+		{in: "0x10", err: ErrInvalidMoney},
+		{in: "0b11", err: ErrInvalidMoney},
+		{in: "0o17", err: ErrInvalidMoney},
+		{in: "1_000", err: ErrInvalidMoney},
+		{in: "1e2", err: ErrInvalidMoney},
+		{in: "+5", err: ErrInvalidMoney},
+		{in: ".5", err: ErrInvalidMoney},
+		{in: "5.", err: ErrInvalidMoney},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if err != tt.err || got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, %v, want %d, %v", tt.in, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidCurrency(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{code: "GBP", want: true},
+		{code: "USD", want: true},
+		{code: "EUR", want: true},
+		{code: "gbp", want: false},
+		{code: "GB", want: false},
+		{code: "JPY", want: false},
+		{code: "KRW", want: false},
+		{code: "KWD", want: false},
+		{code: "CLF", want: false},
+		{code: "XAU", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidCurrency(tt.code); got != tt.want {
+			t.Errorf("ValidCurrency(%q) = %t, want %t", tt.code, got, tt.want)
+		}
+	}
+}
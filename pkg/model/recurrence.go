@@ -0,0 +1,225 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Frequencies a recurring expense can repeat at, as in RFC 5545 RRULE FREQ
+var frequencies = map[string]bool{
+	"daily":   true,
+	"weekly":  true,
+	"monthly": true,
+	"yearly":  true,
+}
+
+// Recurrence - A rule creating the same expense on a schedule, such as rent on the first of every month.
+// Occurrences are calendar days in the rule's timezone.
+type Recurrence struct {
+	ID     string `bson:"_id" json:"id"`
+	UserID string `bson:"userID" json:"userID"`
+
+	// The expense created on every occurrence
+	Title      string   `bson:"title" json:"title"`
+	Price      Money    `bson:"price" json:"price"`
+	Currency   string   `bson:"currency" json:"currency"`
+	Type       string   `bson:"type" json:"type"`
+	IsSaving   bool     `bson:"isSaving" json:"isSaving"`
+	Icon       string   `bson:"icon" json:"icon"`
+	AccountID  string   `bson:"accountID,omitempty" json:"accountID,omitempty"`
+	CategoryID string   `bson:"categoryID" json:"categoryID"`
+	Tags       []string `bson:"tags,omitempty" json:"tags,omitempty"`
+
+	// Frequency is daily, weekly, monthly or yearly, repeating every Interval of them
+	Frequency string `bson:"frequency" json:"frequency"`
+	Interval  int    `bson:"interval" json:"interval"`
+	// MonthDay is the day of monthly and yearly occurrences, the last day in shorter months.
+	// Monthly rules must set it, for yearly ones zero keeps the day of Start.
+	MonthDay int `bson:"monthDay" json:"monthDay"`
+	// Start is the first day occurrences may fall on and Until the last, Until is optional
+	Start    Date   `bson:"start" json:"start"`
+	Until    Date   `bson:"until" json:"until"`
+	Timezone string `bson:"timezone" json:"timezone"`
+
+	// Next is the occurrence still to be created, null once the rule has ended
+	Next Date `bson:"next" json:"next"`
+}
+
+// ValidFrequency - Checks the frequency is daily, weekly, monthly or yearly
+func ValidFrequency(frequency string) bool {
+	return frequencies[frequency]
+}
+
+// ResolveType - Fills in a missing Type from IsSaving, then keeps IsSaving in step with Type
+func (r *Recurrence) ResolveType() {
+	r.Type, r.IsSaving = resolveType(r.Type, r.IsSaving)
+}
+
+// Location - The timezone occurrences are counted in, UTC when unset or unknown
+func (r Recurrence) Location() *time.Location {
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// Occurrence - Midnight of the nth day the rule produces, counting from zero.
+// Monthly and yearly rules may produce days before Start for n = 0.
+func (r Recurrence) Occurrence(n int) time.Time {
+	return r.occurrence(n, r.Location())
+}
+
+func (r Recurrence) occurrence(n int, loc *time.Location) time.Time {
+	y, m, d := r.Start.In(loc).Date()
+	step := n * r.Interval
+
+	switch r.Frequency {
+	case "daily":
+		return time.Date(y, m, d+step, 0, 0, 0, 0, loc)
+	case "weekly":
+		return time.Date(y, m, d+7*step, 0, 0, 0, 0, loc)
+	case "monthly":
+		m += time.Month(step)
+	case "yearly":
+		y += step
+	}
+
+	if r.MonthDay > 0 {
+		d = r.MonthDay
+	}
+
+	// Normalise the month first, then keep the day inside it
+	first := time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+
+	return time.Date(first.Year(), first.Month(), d, 0, 0, 0, 0, loc)
+}
+
+// Index of an occurrence falling before day, or of the first on or after it, worked out from the
+// distance to Start so occurrences don't have to be counted one at a time
+func (r Recurrence) firstIndex(day time.Time, loc *time.Location) int {
+	sy, sm, sd := r.Start.In(loc).Date()
+	dy, dm, dd := day.In(loc).Date()
+
+	n := 0
+	switch r.Frequency {
+	case "daily", "weekly":
+		// Counted in UTC, where every day is 24 hours long
+		days := int(time.Date(dy, dm, dd, 0, 0, 0, 0, time.UTC).Sub(time.Date(sy, sm, sd, 0, 0, 0, 0, time.UTC)) / (24 * time.Hour))
+		period := r.Interval
+		if r.Frequency == "weekly" {
+			period *= 7
+		}
+		n = days / period
+	case "monthly":
+		// One interval short, as MonthDay can move the occurrence either side of day within its month
+		n = ((dy-sy)*12+int(dm-sm))/r.Interval - 1
+	case "yearly":
+		n = (dy-sy)/r.Interval - 1
+	}
+
+	if n < 0 {
+		return 0
+	}
+
+	return n
+}
+
+// NextOnOrAfter - The first occurrence falling on or after t's day in the rule's timezone,
+// false when the rule has ended by then
+func (r Recurrence) NextOnOrAfter(t time.Time) (time.Time, bool) {
+	return r.nextOnOrAfter(t, r.Location())
+}
+
+func (r Recurrence) nextOnOrAfter(t time.Time, loc *time.Location) (time.Time, bool) {
+	if !ValidFrequency(r.Frequency) || r.Interval < 1 {
+		return time.Time{}, false
+	}
+
+	y, m, d := t.In(loc).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	if r.Start.After(day) {
+		day = r.Start.In(loc)
+	}
+
+	for n := r.firstIndex(day, loc); ; n++ {
+		occurrence := r.occurrence(n, loc)
+		if !r.Until.IsZero() && occurrence.After(r.Until.Time) {
+			return time.Time{}, false
+		}
+		if !occurrence.Before(day) {
+			return occurrence, true
+		}
+	}
+}
+
+// NextAfter - The occurrence following the one on day, false when the rule has ended
+func (r Recurrence) NextAfter(day time.Time) (time.Time, bool) {
+	loc := r.Location()
+
+	return r.nextOnOrAfter(day.In(loc).AddDate(0, 0, 1), loc)
+}
+
+// Due - Up to limit occurrences from Next that fall at or before now, followed by the occurrence
+// to carry on from, which is zero once the rule has ended
+func (r Recurrence) Due(now time.Time, limit int) ([]time.Time, time.Time) {
+	if r.Next.IsZero() || !ValidFrequency(r.Frequency) || r.Interval < 1 {
+		return nil, time.Time{}
+	}
+
+	loc := r.Location()
+	from := r.Next.In(loc)
+	if r.Start.After(from) {
+		from = r.Start.In(loc)
+	}
+
+	var days []time.Time
+	for n := r.firstIndex(from, loc); ; n++ {
+		occurrence := r.occurrence(n, loc)
+		// Days a timezone skipped land on a neighbouring day, which mustn't be counted twice
+		if occurrence.Before(from) || (len(days) > 0 && !occurrence.After(days[len(days)-1])) {
+			continue
+		}
+		if !r.Until.IsZero() && occurrence.After(r.Until.Time) {
+			return days, time.Time{}
+		}
+		if occurrence.After(now) || len(days) == limit {
+			return days, occurrence
+		}
+		days = append(days, occurrence)
+	}
+}
+
+// Expense - The expense for the occurrence on day. Its ID is derived from the rule and the day,
+// so creating the same occurrence twice is caught by the storage backend as a duplicate.
+func (r Recurrence) Expense(day time.Time) Expense {
+	r.ResolveType()
+
+	return Expense{
+		ID:           RecurringExpenseID(r.ID, day.In(r.Location())),
+		UserID:       r.UserID,
+		Title:        r.Title,
+		Price:        r.Price,
+		Currency:     r.Currency,
+		Date:         NewDate(day),
+		Type:         r.Type,
+		IsSaving:     r.IsSaving,
+		Icon:         r.Icon,
+		AccountID:    r.AccountID,
+		CategoryID:   r.CategoryID,
+		Tags:         append([]string(nil), r.Tags...),
+		RecurrenceID: r.ID,
+	}
+}
+
+// RecurringExpenseID - Stable ID for the expense a rule creates on a day, in the same format as NewID
+func RecurringExpenseID(recurrenceID string, day time.Time) string {
+	sum := sha256.Sum256([]byte(recurrenceID + "/" + day.Format(CalendarDate)))
+
+	return hex.EncodeToString(sum[:12])
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOccurrence(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(y int, m time.Month, d int, loc *time.Location) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name       string
+		recurrence Recurrence
+		n          int
+		want       time.Time
+	}{
+		{
+			name:       "daily every other day",
+			recurrence: Recurrence{Frequency: "daily", Interval: 2, Start: NewDate(day(2020, 1, 30, time.UTC))},
+			n:          2,
+			want:       day(2020, 2, 3, time.UTC),
+		},
+		{
+			name:       "weekly",
+			recurrence: Recurrence{Frequency: "weekly", Interval: 1, Start: NewDate(day(2020, 1, 1, time.UTC))},
+			n:          3,
+			want:       day(2020, 1, 22, time.UTC),
+		},
+		{
+			name:       "monthly on the last day of a shorter month",
+			recurrence: Recurrence{Frequency: "monthly", Interval: 1, MonthDay: 31, Start: NewDate(day(2020, 1, 31, time.UTC))},
+			n:          1,
+			want:       day(2020, 2, 29, time.UTC),
+		},
+		{
+			name:       "monthly carries on from the month day after a short month",
+			recurrence: Recurrence{Frequency: "monthly", Interval: 1, MonthDay: 31, Start: NewDate(day(2020, 1, 31, time.UTC))},
+			n:          2,
+			want:       day(2020, 3, 31, time.UTC),
+		},
+		{
+			name:       "monthly every quarter",
+			recurrence: Recurrence{Frequency: "monthly", Interval: 3, MonthDay: 15, Start: NewDate(day(2020, 11, 15, time.UTC))},
+			n:          1,
+			want:       day(2021, 2, 15, time.UTC),
+		},
+		{
+			name:       "yearly from a leap day",
+			recurrence: Recurrence{Frequency: "yearly", Interval: 1, Start: NewDate(day(2020, 2, 29, time.UTC))},
+			n:          1,
+			want:       day(2021, 2, 28, time.UTC),
+		},
+		{
+			name:       "daily across the clocks going forward",
+			recurrence: Recurrence{Frequency: "daily", Interval: 1, Timezone: "Europe/London", Start: NewDate(day(2020, 3, 28, london))},
+			n:          2,
+			want:       day(2020, 3, 30, london),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.recurrence.Occurrence(tt.n); !got.Equal(tt.want) {
+				t.Errorf("Occurrence(%d) = %v, want %v", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDue(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		until    time.Time
+		limit    int
+		wantDays int
+		wantNext time.Time
+	}{
+		{name: "everything up to now", limit: 100, wantDays: 10, wantNext: start.AddDate(0, 0, 10)},
+		{name: "limited", limit: 4, wantDays: 4, wantNext: start.AddDate(0, 0, 4)},
+		{name: "ended", until: start.AddDate(0, 0, 5), limit: 100, wantDays: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Recurrence{Frequency: "daily", Interval: 1, Start: NewDate(start), Next: NewDate(start)}
+			if !tt.until.IsZero() {
+				r.Until = NewDate(tt.until)
+			}
+
+			days, next := r.Due(now, tt.limit)
+			if len(days) != tt.wantDays {
+				t.Errorf("Due returned %d days, want %d", len(days), tt.wantDays)
+			}
+			if !next.Equal(tt.wantNext) {
+				t.Errorf("Due carries on from %v, want %v", next, tt.wantNext)
+			}
+			for i, day := range days {
+				if want := start.AddDate(0, 0, i); !day.Equal(want) {
+					t.Errorf("day %d = %v, want %v", i, day, want)
+				}
+			}
+		})
+	}
+}
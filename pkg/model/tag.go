@@ -0,0 +1,56 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// MaxTagLength - Longest tag accepted, in characters
+const MaxTagLength = 50
+
+// ErrInvalidTag - Returned for a tag that is empty, too long or contains a comma or slash
+var ErrInvalidTag = errors.New("Tags must be 1 to 50 characters and can't contain commas or slashes")
+
+// TagCount - A tag and the number of the user's expenses carrying it
+type TagCount struct {
+	Tag   string `bson:"_id" json:"tag"`
+	Count int    `bson:"count" json:"count"`
+}
+
+// NormaliseTag - Trims and lower cases a tag so "Work-Trip " and "work-trip" are the same tag
+func NormaliseTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+
+	if tag == "" || len([]rune(tag)) > MaxTagLength || strings.ContainsAny(tag, ",/") {
+		return "", ErrInvalidTag
+	}
+
+	return tag, nil
+}
+
+// NormaliseTags - Normalises every tag, dropping duplicates and sorting the result
+func NormaliseTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool, len(tags))
+	normalised := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag, err := NormaliseTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalised = append(normalised, tag)
+	}
+
+	sort.Strings(normalised)
+
+	return normalised, nil
+}
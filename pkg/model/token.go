@@ -0,0 +1,102 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// RefreshToken - A long lived token exchanged at /api/user/refresh for a new access token and a new
+// refresh token. Each can only be exchanged once, and every token descending from the same login
+// shares a family so all of them can be revoked when one is reused.
+type RefreshToken struct {
+	// ID is the SHA-256 hash of the token, which itself is only ever given to the client
+	ID       string    `bson:"_id" json:"id"`
+	FamilyID string    `bson:"familyID" json:"familyID"`
+	UserID   string    `bson:"userID" json:"userID"`
+	Created  time.Time `bson:"created" json:"created"`
+	Expires  time.Time `bson:"expires" json:"expires"`
+	// Used is when the token was exchanged, zero until then
+	Used time.Time `bson:"used" json:"used"`
+}
+
+// NewRefreshToken - Generates a refresh token for the user in the family, returning the record to
+// store and the token to give the client. An empty family starts a new one.
+func NewRefreshToken(user string, family string, ttl time.Duration) (RefreshToken, string) {
+	token := newSecret()
+
+	now := time.Now().UTC()
+	record := RefreshToken{
+		ID:       HashRefreshToken(token),
+		FamilyID: family,
+		UserID:   user,
+		Created:  now,
+		Expires:  now.Add(ttl),
+	}
+	if record.FamilyID == "" {
+		record.FamilyID = NewID()
+	}
+
+	return record, token
+}
+
+// HashRefreshToken - The ID a refresh token is stored under, so a leaked store can't be used to refresh
+func HashRefreshToken(token string) string {
+	return hashSecret(token)
+}
+
+// Purposes of the tokens mailed to users
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+// UserToken - A single use token mailed to a user, proving they can read mail sent to their address.
+// Only its hash is kept, the token itself is only ever in the email.
+type UserToken struct {
+	// ID is the SHA-256 hash of the token
+	ID      string    `bson:"_id" json:"id"`
+	UserID  string    `bson:"userID" json:"userID"`
+	Purpose string    `bson:"purpose" json:"purpose"`
+	Created time.Time `bson:"created" json:"created"`
+	Expires time.Time `bson:"expires" json:"expires"`
+}
+
+// NewUserToken - Generates a token for the purpose, returning the record to store and the token to mail the user
+func NewUserToken(user string, purpose string, ttl time.Duration) (UserToken, string) {
+	token := newSecret()
+
+	now := time.Now().UTC()
+	record := UserToken{
+		ID:      HashUserToken(token),
+		UserID:  user,
+		Purpose: purpose,
+		Created: now,
+		Expires: now.Add(ttl),
+	}
+
+	return record, token
+}
+
+// HashUserToken - The ID a mailed token is stored under
+func HashUserToken(token string) string {
+	return hashSecret(token)
+}
+
+// 256 random bits, URL safe so they can be put in links
+func newSecret() string {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+func hashSecret(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -1,31 +1,44 @@
-package model
-
-import (
-	"github.com/dgrijalva/jwt-go"
-
-	"github.com/wilsonth122/money-tracker-api/pkg/config"
-)
-
-// Token JWT Claims struct
-type Token struct {
-	UserID string
-	jwt.StandardClaims
-}
-
-// User struct
-type User struct {
-	Email    string `bson:"email" json:"email"`
-	Password string `bson:"password" json:"password"`
-	Token    string `bson:"token" json:"token"`
-}
-
-// GenerateToken - Generates and signs a new JWT
-func GenerateToken(id string) string {
-	conf := config.New()
-
-	tk := &Token{UserID: id}
-	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
-	tokenString, _ := token.SignedString([]byte(conf.Auth.TokenPassword))
-
-	return tokenString
-}
+package model
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Token - Claims of a JWT access token. Expiry, issue time, issuer, audience and a unique ID (jti)
+// are always set, the ID being what a single token is revoked by.
+type Token struct {
+	UserID string
+	// FamilyID is the login the token descends from, shared with its refresh tokens, so logging out revokes them all
+	FamilyID string `json:"fam,omitempty"`
+	jwt.StandardClaims
+}
+
+// User struct
+type User struct {
+	Email    string `bson:"email" json:"email"`
+	Password string `bson:"password" json:"password"`
+	// Token is the access token sent on logging in. Tokens are checked by their signature and
+	// revocations, never against what is stored here.
+	Token string `bson:"token" json:"token"`
+	// RefreshToken and ExpiresIn, the seconds until Token expires, are only sent with a new Token
+	RefreshToken string `bson:"-" json:"refreshToken,omitempty"`
+	ExpiresIn    int64  `bson:"-" json:"expiresIn,omitempty"`
+	// Currency is the default for new expenses and reports, an ISO 4217 code
+	Currency string `bson:"currency" json:"currency"`
+	// Timezone is an IANA name such as Europe/London, deciding where days and months begin
+	Timezone string `bson:"timezone" json:"timezone"`
+	// Verified is set once the user follows the link emailed to them on signing up
+	Verified bool `bson:"verified" json:"verified"`
+}
+
+// Location - The user's timezone, UTC when unset or unknown
+func (user User) Location() *time.Location {
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
@@ -0,0 +1,70 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// FileProvider - Serves rates from a JSON file quoted against a single base currency:
+//
+//	{"base": "EUR", "rates": {"GBP": "0.85", "USD": "1.08"}}
+//
+// Rates are strings so they are parsed exactly. Cross rates are derived through the base.
+type FileProvider struct {
+	base  string
+	rates map[string]*big.Rat
+}
+
+var _ Provider = (*FileProvider)(nil)
+
+type rateFile struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+}
+
+// LoadFile - Reads and validates a rates file
+func LoadFile(path string) (*FileProvider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file rateFile
+	if err := json.NewDecoder(f).Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	p := &FileProvider{
+		base:  file.Base,
+		rates: map[string]*big.Rat{file.Base: big.NewRat(1, 1)},
+	}
+
+	for currency, value := range file.Rates {
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("%s: invalid rate %q for %s", path, value, currency)
+		}
+		p.rates[currency] = rate
+	}
+
+	return p, nil
+}
+
+// Rate - Returns how many units of `to` one unit of `from` buys
+func (p *FileProvider) Rate(ctx context.Context, from string, to string) (*big.Rat, error) {
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return nil, ErrUnknownCurrency
+	}
+
+	toRate, ok := p.rates[to]
+	if !ok {
+		return nil, ErrUnknownCurrency
+	}
+
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
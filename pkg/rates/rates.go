@@ -0,0 +1,51 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// ErrUnknownCurrency - Returned when the provider has no rate for one of the currencies
+var ErrUnknownCurrency = errors.New("No exchange rate available for currency")
+
+// Provider - Supplies the exchange rate to multiply an amount in one currency by to get another
+type Provider interface {
+	Rate(ctx context.Context, from string, to string) (*big.Rat, error)
+}
+
+// Convert - Converts an amount between currencies, rounding half away from zero to the nearest minor unit.
+// Returns the rate that was applied alongside the converted amount.
+func Convert(ctx context.Context, p Provider, amount model.Money, from string, to string) (model.Money, *big.Rat, error) {
+	if from == to {
+		return amount, big.NewRat(1, 1), nil
+	}
+
+	rate, err := p.Rate(ctx, from, to)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	converted := new(big.Rat).Mul(big.NewRat(int64(amount), 1), rate)
+
+	return model.Money(round(converted)), rate, nil
+}
+
+// Rounds half away from zero
+func round(r *big.Rat) int64 {
+	num := new(big.Int).Abs(r.Num())
+	q, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+
+	// Round up when the remainder is at least half the denominator
+	if rem.Mul(rem, big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+
+	return q.Int64()
+}
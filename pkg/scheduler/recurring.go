@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+	"github.com/wilsonth122/money-tracker-api/pkg/stream"
+)
+
+// Most expenses created for one rule in a run, so a rule far behind can't hold up everyone else's
+const maxOccurrences = 100
+
+// Recurring - Turns due recurring rules into expenses.
+// Several instances may run against the same storage: every occurrence has a fixed expense ID,
+// so an occurrence that was already created is rejected as a duplicate instead of being created twice.
+type Recurring struct {
+	Recurrences dao.RecurrenceStore
+	Expenses    dao.ExpenseStore
+
+	// Interval is how often due rules are looked for
+	Interval time.Duration
+}
+
+// Run - Creates due expenses straight away and then every Interval, until ctx is done
+func (s *Recurring) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunOnce(ctx, time.Now()); err != nil {
+			log.Printf("Recurring expenses: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunOnce - Creates every occurrence due at or before now
+func (s *Recurring) RunOnce(ctx context.Context, now time.Time) error {
+	due, err := s.Recurrences.FindDueRecurrences(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, recurrence := range due {
+		// One broken rule shouldn't hold up everybody else's
+		if err := s.materialise(ctx, recurrence, now); err != nil {
+			log.Printf("Recurring expense %s: %s", recurrence.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Creates the rule's expenses up to now, then moves the rule on past them. At most maxOccurrences
+// are created in one go, a rule that is further behind carries on at the next run.
+func (s *Recurring) materialise(ctx context.Context, recurrence model.Recurrence, now time.Time) error {
+	days, next := recurrence.Due(now, maxOccurrences)
+
+	for _, day := range days {
+		expense := recurrence.Expense(day)
+
+		switch err := s.Expenses.InsertExpense(ctx, expense); err {
+		case nil:
+			go stream.Writer(&expense)
+		case dao.ErrDuplicate:
+			// Created by another instance, or by a run that stopped before advancing the rule
+		default:
+			return err
+		}
+	}
+
+	to := model.Date{}
+	if !next.IsZero() {
+		to = model.NewDate(next)
+	}
+
+	return s.Recurrences.AdvanceRecurrence(ctx, recurrence.ID, recurrence.Next, to)
+}
@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+// The days of the user's expenses, in order
+func expenseDays(t *testing.T, store dao.ExpenseStore, user string) []time.Time {
+	t.Helper()
+
+	expenses, err := store.FindAllExpenses(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	days := make([]time.Time, 0, len(expenses))
+	for _, expense := range expenses {
+		days = append(days, expense.Date.Time)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	return days
+}
+
+func dailyRule(start time.Time) model.Recurrence {
+	return model.Recurrence{
+		ID:        model.NewID(),
+		UserID:    "a@x.com",
+		Title:     "Coffee",
+		Price:     300,
+		Currency:  "GBP",
+		Frequency: "daily",
+		Interval:  1,
+		Start:     model.NewDate(start),
+		Next:      model.NewDate(start),
+	}
+}
+
+func TestRunOnceAfterRestartCreatesEachDayOnce(t *testing.T) {
+	ctx := context.Background()
+	store := dao.NewMemoryStore()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2020, 1, 5, 12, 0, 0, 0, time.UTC)
+
+	recurrence := dailyRule(start)
+	if err := store.InsertRecurrence(ctx, recurrence); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Recurring{Recurrences: store, Expenses: store}).RunOnce(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The instance died after creating the expenses but before moving the rule on, so a
+	// new instance finds the same occurrences due again
+	if err := store.UpdateRecurrence(ctx, recurrence); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Recurring{Recurrences: store, Expenses: store}).RunOnce(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	days := expenseDays(t, store, recurrence.UserID)
+	if len(days) != 5 {
+		t.Fatalf("created expenses on %v, want one on each of the 5 days", days)
+	}
+	for i, day := range days {
+		if want := start.AddDate(0, 0, i); !day.Equal(want) {
+			t.Errorf("expense %d is on %v, want %v", i, day, want)
+		}
+	}
+
+	stored, err := store.FindRecurrenceByID(ctx, recurrence.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := start.AddDate(0, 0, 5); !stored.Next.Equal(want) {
+		t.Errorf("rule moved on to %v, want %v", stored.Next.Time, want)
+	}
+}
+
+func TestRunOnceCapsBackfill(t *testing.T) {
+	ctx := context.Background()
+	store := dao.NewMemoryStore()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.AddDate(0, 0, maxOccurrences+50)
+
+	recurrence := dailyRule(start)
+	if err := store.InsertRecurrence(ctx, recurrence); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Recurring{Recurrences: store, Expenses: store}
+
+	// The first run stops at the cap and the next one picks up where it left off
+	for _, want := range []int{maxOccurrences, maxOccurrences + 51} {
+		if err := s.RunOnce(ctx, now); err != nil {
+			t.Fatal(err)
+		}
+
+		days := expenseDays(t, store, recurrence.UserID)
+		if len(days) != want {
+			t.Fatalf("%d expenses after the run, want %d", len(days), want)
+		}
+		if last := days[len(days)-1]; !last.Equal(start.AddDate(0, 0, want-1)) {
+			t.Errorf("last expense is on %v, want %v", last, start.AddDate(0, 0, want-1))
+		}
+	}
+}
@@ -1,151 +1,282 @@
-package stream
-
-import (
-	"log"
-	"net/http"
-	"time"
-
-	"github.com/gorilla/websocket"
-
-	"github.com/wilsonth122/money-tracker-api/pkg/auth"
-	"github.com/wilsonth122/money-tracker-api/pkg/model"
-)
-
-type authClient struct {
-	userID string
-	conn   *websocket.Conn
-}
-
-type tokenString struct {
-	Token string `json:"token"`
-}
-
-const (
-	// Time allowed to write a message to the peer.
-	writeWait = 10 * time.Second
-
-	// Time allowed to read the next pong message from the peer.
-	pongWait = 30 * time.Second
-
-	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
-)
-
-var clients = make(map[authClient]bool)
-var broadcast = make(chan *model.Expense)
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
-func Init() {
-	go expense_stream()
-}
-
-func Writer(expense *model.Expense) {
-	broadcast <- expense
-}
-
-func WsHandler(w http.ResponseWriter, r *http.Request) {
-	ws, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("Upgrade error: %s", err)
-	}
-
-	err = ws.WriteMessage(websocket.TextMessage, []byte("Waiting for AuthToken"))
-	if err != nil {
-		log.Printf("Websocket write error: %s", err)
-		ws.Close()
-		return
-	}
-
-	// Wait for client to send users auth token before continuing
-	token := tokenString{}
-	err = ws.ReadJSON(&token)
-	if err != nil {
-		log.Printf("Websocket read error: %s", err)
-		ws.Close()
-		return
-	}
-
-	tk, err := auth.ParseToken(token.Token)
-	if err != nil {
-		log.Printf("Websocket auth error: %s", err)
-		ws.Close()
-		return
-	}
-
-	var client authClient
-	client.userID = tk.UserID
-	client.conn = ws
-
-	// Register client
-	clients[client] = true
-
-	err = ws.WriteMessage(websocket.TextMessage, []byte("Connected"))
-	if err != nil {
-		log.Printf("Websocket write error: %s", err)
-		ws.Close()
-	}
-
-	log.Println("Connected")
-
-	clientDone := make(chan struct{})
-	go ping(client, clientDone)
-	read(client, clientDone)
-}
-
-func expense_stream() {
-	for {
-		expense := <-broadcast
-
-		// Send updated expense to clients that have authenticated as the current user
-		for client := range clients {
-			if expense.UserID == client.userID {
-				err := client.conn.WriteJSON(expense)
-				if err != nil {
-					log.Printf("Stream, Websocket error: %s", err)
-					client.conn.Close()
-					delete(clients, client)
-				}
-			}
-		}
-	}
-}
-
-func ping(client authClient, done chan struct{}) {
-	ticker := time.NewTicker(pingPeriod)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			if err := client.conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(writeWait)); err != nil {
-				log.Printf("Ping, Websocket error: %s", err)
-				client.conn.Close()
-				delete(clients, client)
-				return
-			}
-		case <-done:
-			return
-		}
-	}
-}
-
-func read(client authClient, done chan struct{}) {
-	defer client.conn.Close()
-	client.conn.SetReadDeadline(time.Now().Add(pongWait))
-	client.conn.SetPongHandler(func(string) error { client.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
-
-	for {
-		_, _, err := client.conn.ReadMessage()
-		if err != nil {
-			log.Printf("Read, Websocket error: %s", err)
-			client.conn.Close()
-			delete(clients, client)
-			close(done)
-			return
-		}
-	}
-}
+package stream
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/wilsonth122/money-tracker-api/pkg/auth"
+	"github.com/wilsonth122/money-tracker-api/pkg/dao"
+	"github.com/wilsonth122/money-tracker-api/pkg/model"
+)
+
+type authClient struct {
+	userID string
+	conn   *websocket.Conn
+	// token the client authenticated with, its expiry is checked before each message and whether it was
+	// revoked on every ping
+	token       model.Token
+	revocations dao.RevocationStore
+	// version of the stream the client asked for, see WsHandler
+	version int
+}
+
+// event - A message for every client authenticated as one of the users
+type event struct {
+	userIDs []string
+	payload message
+}
+
+// message - What version 2 clients are sent, the type tells expenses and budget alerts apart.
+// Version 1 clients are only sent the data of expenses.
+type message struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+type tokenString struct {
+	Token string `json:"token"`
+}
+
+const (
+	// Time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong message from the peer.
+	pongWait = 30 * time.Second
+
+	// Send pings to peer with this period. Must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+)
+
+// clients is shared by the handler, ping and read goroutines of every connection and the stream
+var clients = make(map[*authClient]bool)
+var clientsMu sync.Mutex
+var broadcast = make(chan event)
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+func Init() {
+	go expense_stream()
+}
+
+func Writer(expense *model.Expense) {
+	broadcast <- event{userIDs: []string{expense.UserID}, payload: message{Type: "expense", Data: expense}}
+}
+
+// LedgerWriter - Sends an expense in a shared ledger to the clients of every member
+func LedgerWriter(expense *model.Expense, members []string) {
+	broadcast <- event{userIDs: members, payload: message{Type: "expense", Data: expense}}
+}
+
+// Alert - Sends a budget alert to the user's version 2 clients alongside their expenses
+func Alert(alert *model.BudgetAlert) {
+	broadcast <- event{userIDs: []string{alert.UserID}, payload: message{Type: "budgetAlert", Data: alert}}
+}
+
+// WsHandler - Streams the expenses of whoever authenticates with a token verified by the keys that hasn't been revoked.
+// The stream is closed once the token expires or is revoked.
+// By default each message is an expense. Connecting with ?v=2 sends {"type": "expense" | "budgetAlert", "data": ...}
+// instead, so budget alerts can be streamed too.
+func WsHandler(w http.ResponseWriter, r *http.Request, keys *auth.KeyManager, revocations dao.RevocationStore) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Upgrade error: %s", err)
+	}
+
+	err = ws.WriteMessage(websocket.TextMessage, []byte("Waiting for AuthToken"))
+	if err != nil {
+		log.Printf("Websocket write error: %s", err)
+		ws.Close()
+		return
+	}
+
+	// Wait for client to send users auth token before continuing
+	token := tokenString{}
+	err = ws.ReadJSON(&token)
+	if err != nil {
+		log.Printf("Websocket read error: %s", err)
+		ws.Close()
+		return
+	}
+
+	tk, err := keys.ParseToken(token.Token)
+	if err != nil {
+		log.Printf("Websocket auth error: %s", err)
+		ws.Close()
+		return
+	}
+
+	client := &authClient{userID: tk.UserID, conn: ws, token: tk, revocations: revocations, version: 1}
+	if r.URL.Query().Get("v") == "2" {
+		client.version = 2
+	}
+
+	if err := client.authorised(r.Context()); err != nil {
+		log.Printf("Websocket auth error: %s", err)
+		ws.Close()
+		return
+	}
+
+	register(client)
+
+	err = ws.WriteMessage(websocket.TextMessage, []byte("Connected"))
+	if err != nil {
+		log.Printf("Websocket write error: %s", err)
+		ws.Close()
+	}
+
+	log.Println("Connected")
+
+	clientDone := make(chan struct{})
+	go ping(client, clientDone)
+	read(client, clientDone)
+}
+
+func expense_stream() {
+	for {
+		e := <-broadcast
+
+		// Send the event to clients that have authenticated as one of its users, and whose token hasn't expired.
+		// Looking up revocations here would hold up every other client, so the ping checks those instead.
+		for _, client := range recipients(e) {
+			err := client.expired()
+			if err == nil {
+				err = client.send(e.payload)
+			}
+			if err != nil {
+				log.Printf("Stream, Websocket error: %s", err)
+				client.conn.Close()
+				unregister(client)
+			}
+		}
+	}
+}
+
+// Writes the message in the client's version of the stream, version 1 clients are only sent expenses
+func (client *authClient) send(msg message) error {
+	if client.version >= 2 {
+		return client.conn.WriteJSON(msg)
+	}
+	if msg.Type != "expense" {
+		return nil
+	}
+
+	return client.conn.WriteJSON(msg.Data)
+}
+
+func register(client *authClient) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	clients[client] = true
+}
+
+func unregister(client *authClient) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	delete(clients, client)
+}
+
+// The clients the event is for, taken under the lock so it isn't held while writing to them
+func recipients(e event) []*authClient {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	var to []*authClient
+	for client := range clients {
+		if addressedTo(e, client.userID) {
+			to = append(to, client)
+		}
+	}
+
+	return to
+}
+
+func (client *authClient) expired() error {
+	if time.Now().Unix() >= client.token.ExpiresAt {
+		return errors.New("token has expired")
+	}
+
+	return nil
+}
+
+// Whether the client's token still lets it receive messages, it mustn't have expired or been revoked by logging out
+func (client *authClient) authorised(ctx context.Context) error {
+	if err := client.expired(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, writeWait)
+	defer cancel()
+
+	revoked, err := auth.Revoked(ctx, client.revocations, client.token)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return errors.New("token has been revoked")
+	}
+
+	return nil
+}
+
+func addressedTo(e event, userID string) bool {
+	for _, id := range e.userIDs {
+		if id == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ping(client *authClient, done chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Clients that are sent nothing are also closed soon after logging out
+			err := client.authorised(context.Background())
+			if err == nil {
+				err = client.conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(writeWait))
+			}
+			if err != nil {
+				log.Printf("Ping, Websocket error: %s", err)
+				client.conn.Close()
+				unregister(client)
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func read(client *authClient, done chan struct{}) {
+	defer client.conn.Close()
+	client.conn.SetReadDeadline(time.Now().Add(pongWait))
+	client.conn.SetPongHandler(func(string) error { client.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+
+	for {
+		_, _, err := client.conn.ReadMessage()
+		if err != nil {
+			log.Printf("Read, Websocket error: %s", err)
+			client.conn.Close()
+			unregister(client)
+			close(done)
+			return
+		}
+	}
+}
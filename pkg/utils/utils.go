@@ -1,19 +1,19 @@
-package utils
-
-import (
-	"encoding/json"
-	"net/http"
-)
-
-// RespondWithError - Returns an error as a JSON response
-func RespondWithError(w http.ResponseWriter, code int, msg string) {
-	RespondWithJSON(w, code, map[string]string{"error": msg})
-}
-
-// RespondWithJSON - Returns data as a JSON payload
-func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	response, _ := json.Marshal(payload)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	w.Write(response)
-}
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RespondWithError - Returns an error as a JSON response
+func RespondWithError(w http.ResponseWriter, code int, msg string) {
+	RespondWithJSON(w, code, map[string]string{"error": msg})
+}
+
+// RespondWithJSON - Returns data as a JSON payload
+func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, _ := json.Marshal(payload)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}